@@ -6,10 +6,10 @@ import (
 	"log"
 	"time"
 
+	"github.com/clin211/grpc/mtls"
 	pb "github.com/clin211/grpc/rpc"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 var (
@@ -19,11 +19,18 @@ var (
 func main() {
 	// 解析命令行参数
 	flag.Parse()
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	creds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
 	// 创建一个连接到服务器的客户端
 	// grpc.NewClient函数用于创建一个新的客户端，需要传入服务器地址和凭证
 	// grpc.WithTransportCredentials函数用于设置传输层凭证
-	// insecure.NewCredentials函数用于创建不安全的凭证
-	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// creds 在设置了 GRPC_TLS_* 环境变量时是 TLS 凭证，否则是不安全的明文凭证
+	conn, err := grpc.NewClient(*addr, creds)
 	// 如果创建连接失败，输出错误日志并退出
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
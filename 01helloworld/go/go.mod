@@ -1,8 +1,10 @@
 module github.com/clin211/grpc
 
-go 1.22.0
+go 1.23.4
 
 require (
+	github.com/clin211/grpc/health v0.0.0-00010101000000-000000000000
+	github.com/clin211/grpc/mtls v0.0.0-00010101000000-000000000000
 	google.golang.org/grpc v1.69.2
 	google.golang.org/protobuf v1.36.1
 )
@@ -13,3 +15,7 @@ require (
 	golang.org/x/text v0.19.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
 )
+
+replace github.com/clin211/grpc/health => ../../04health/go
+
+replace github.com/clin211/grpc/mtls => ../../mtls
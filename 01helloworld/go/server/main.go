@@ -9,6 +9,10 @@ import (
 	"log"
 	"net"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
+	"github.com/clin211/grpc/mtls"
 	pb "github.com/clin211/grpc/rpc"
 	"google.golang.org/grpc"
 )
@@ -26,7 +30,11 @@ type server struct {
 }
 
 // 实现SayHello方法，处理客户端的SayHello请求
-func (s *server) SayHello(_ context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	// 开启双向 TLS 时记录客户端证书中的身份
+	if id, ok := mtls.PeerIdentity(ctx); ok {
+		log.Printf("Peer identity: %v", id)
+	}
 	// 输出日志，记录接收到的请求
 	log.Printf("Received: %v", in.GetName())
 	// 返回一个HelloReply消息，包含了一个问候语
@@ -45,18 +53,42 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
 	// 创建一个gRPC服务器
-	s := grpc.NewServer()
+	s := grpc.NewServer(creds)
 
 	// 注册GreeterServer服务
 	pb.RegisterGreeterServer(s, &server{})
 
-	// 输出日志，记录服务器监听地址
-	log.Printf("server listening at %v", lis.Addr())
+	// 注册健康检查服务，整体状态（空服务名）表示 Greeter 是否可用
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
 
-	// 启动服务器，开始监听客户端请求
-	if err := s.Serve(lis); err != nil {
-		// 如果启动服务器失败，输出错误日志并退出
-		log.Fatalf("failed to serve: %v", err)
-	}
+	// 收到 SIGINT/SIGTERM 时置为 NOT_SERVING，等待客户端摘除本实例后 GracefulStop，
+	// 进行中的 SayHello 处理完即退出，超过 GracePeriod 后 Stop
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{s},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	})
+
+	// 在后台启动服务器，开始监听客户端请求
+	go func() {
+		// 输出日志，记录服务器监听地址
+		log.Printf("server listening at %v", lis.Addr())
+		if err := s.Serve(lis); err != nil {
+			// 如果启动服务器失败，输出错误日志并退出
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+
+	// 等待关闭流程结束
+	lc.Wait()
 }
@@ -2,33 +2,50 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/clin211/grpc/02etcd/discovery"
 	proto "github.com/clin211/grpc/02etcd/rpc"
-	"go.etcd.io/etcd/api/v3/mvccpb"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"github.com/clin211/grpc/mtls"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/resolver"
 )
 
 var (
-	cli         *clientv3.Client
-	Schema      = "ns"
 	ServiceName = "helloService"   //服务名称
 	EtcdAddr    = "127.0.0.1:2379" //etcd地址
+
+	// 切换服务发现方式只需修改 target，例如：
+	//   ns://barry/helloService
+	//   file:///etc/grpc/hello.yaml
+	//   dnssrv:///_grpc._tcp.hello.example.com
+	//   consul://127.0.0.1:8500/helloService
+	target = flag.String("target", "ns://barry/"+ServiceName, "the target to resolve")
 )
 
 func main() {
-	r := NewEtcdResolver(EtcdAddr)
-	resolver.Register(r)
-
-	address := r.Scheme() + "://barry/" + ServiceName
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	flag.Parse()
+
+	// authority 为 barry 的 target 使用这里配置的集群，其余使用默认的 EtcdAddr
+	resolver.Register(discovery.NewEtcdResolver(EtcdAddr, map[string]string{"barry": EtcdAddr}))
+	resolver.Register(discovery.NewFileResolver(time.Second))
+	resolver.Register(discovery.NewDNSSRVResolver(30 * time.Second))
+	resolver.Register(discovery.NewConsulResolver(nil))
+
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	creds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		fmt.Printf("load tls credentials err : %s\n", err)
+		return
+	}
+	conn, err := grpc.NewClient(*target, creds)
 	if err != nil {
 		fmt.Printf("connect err : %s", err)
+		return
 	}
 	defer func() {
 		err := conn.Close()
@@ -46,92 +63,3 @@ func main() {
 	}
 	fmt.Printf("resp : %v", resp)
 }
-
-type EtcdResolver struct {
-	etcdAddr   string
-	clientConn resolver.ClientConn
-}
-
-func NewEtcdResolver(etcdAddr string) resolver.Builder {
-	return &EtcdResolver{etcdAddr: etcdAddr}
-}
-
-func (r *EtcdResolver) Scheme() string {
-	return Schema
-}
-
-func (r *EtcdResolver) ResolveNow(rn resolver.ResolveNowOptions) {
-	fmt.Println(rn)
-}
-
-func (r *EtcdResolver) Close() {}
-
-// Build 构建解析器 grpc.Dial()时调用
-func (r *EtcdResolver) Build(target resolver.Target, clientConn resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
-	var err error
-	//构建etcd client
-	if cli == nil {
-		cli, err = clientv3.New(clientv3.Config{
-			Endpoints:   strings.Split(r.etcdAddr, ";"),
-			DialTimeout: 15 * time.Second,
-		})
-		if err != nil {
-			fmt.Printf("connect etcd err : %s\n", err)
-			return nil, err
-		}
-	}
-	r.clientConn = clientConn
-	go r.watch("/" + target.URL.Scheme + "/" + target.Endpoint() + "/")
-	return r, nil
-}
-
-// watch机制：监听etcd中某个key前缀的服务地址列表的变化
-func (r *EtcdResolver) watch(keyPrefix string) {
-	var addrList []resolver.Address
-	resp, err := cli.Get(context.Background(), keyPrefix, clientv3.WithPrefix())
-	if err != nil {
-		fmt.Println("get service list err : ", err)
-	} else {
-		for i := range resp.Kvs {
-			addrList = append(addrList, resolver.Address{Addr: strings.TrimPrefix(string(resp.Kvs[i].Key), keyPrefix)})
-		}
-	}
-	r.clientConn.UpdateState(resolver.State{Addresses: addrList})
-	//监听服务地址列表的变化
-	rch := cli.Watch(context.Background(), keyPrefix, clientv3.WithPrefix())
-	for n := range rch {
-		for _, ev := range n.Events {
-			addr := strings.TrimPrefix(string(ev.Kv.Key), keyPrefix)
-			switch ev.Type {
-			case mvccpb.PUT:
-				if !exists(addrList, addr) {
-					addrList = append(addrList, resolver.Address{Addr: addr})
-					r.clientConn.UpdateState(resolver.State{Addresses: addrList})
-				}
-			case mvccpb.DELETE:
-				if s, ok := remove(addrList, addr); ok {
-					r.clientConn.UpdateState(resolver.State{Addresses: s})
-				}
-			}
-		}
-	}
-}
-
-func exists(l []resolver.Address, addr string) bool {
-	for i := range l {
-		if l[i].Addr == addr {
-			return true
-		}
-	}
-	return false
-}
-
-func remove(s []resolver.Address, addr string) ([]resolver.Address, bool) {
-	for i := range s {
-		if s[i].Addr == addr {
-			s[i] = s[len(s)-1]
-			return s[:len(s)-1], true
-		}
-	}
-	return nil, false
-}
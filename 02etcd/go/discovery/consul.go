@@ -0,0 +1,184 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+// ConsulScheme Consul 解析器的 scheme
+const ConsulScheme = "consul"
+
+const (
+	consulWait        = 30 * time.Second // 阻塞查询的最长等待时间
+	consulMinInterval = time.Second      // 两次请求开始的最小间隔，防止没有阻塞的请求空转
+)
+
+// consulBuilder 通过 Consul 风格的 HTTP catalog 接口解析实例列表
+type consulBuilder struct {
+	client *http.Client
+}
+
+// NewConsulResolver 创建 Consul 解析器构建器，target 形如：
+//
+//	consul://127.0.0.1:8500/helloService?dc=dc1&tag=primary
+//
+// authority 为 Consul agent 的地址（也可以是 httptest.Server 的地址），
+// 使用 /v1/catalog/service/<service> 的阻塞查询（index/wait）监听变化。
+// ServiceMeta 中的 version、zone 分别映射为实例的版本和可用区，其余作为标签；
+// ServiceWeights.Passing 映射为实例权重。client 为 nil 时使用 http.DefaultClient。
+func NewConsulResolver(client *http.Client) resolver.Builder {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &consulBuilder{client: client}
+}
+
+func (b *consulBuilder) Scheme() string {
+	return ConsulScheme
+}
+
+func (b *consulBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	if target.URL.Host == "" {
+		return nil, fmt.Errorf("consul resolver: missing agent address in target %q", target.URL.String())
+	}
+	query := url.Values{}
+	for _, key := range []string{"dc", "tag", "near"} {
+		if v := target.URL.Query().Get(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+	f := &consulFetcher{
+		client:  b.client,
+		baseURL: "http://" + target.URL.Host + "/v1/catalog/service/" + url.PathEscape(target.Endpoint()),
+		query:   query,
+	}
+	// 阻塞查询本身会等待数据变化，拉取间隔为 0
+	return newPollResolver(cc, 0, f.fetch), nil
+}
+
+// consulService /v1/catalog/service 返回的条目，只保留需要的字段
+type consulService struct {
+	Address        string
+	ServiceAddress string
+	ServicePort    int
+	ServiceTags    []string
+	ServiceMeta    map[string]string
+	ServiceWeights struct {
+		Passing int
+	}
+}
+
+// consulFetcher 记录上一次的 X-Consul-Index，下一次请求时作为阻塞查询的 index
+type consulFetcher struct {
+	client  *http.Client
+	baseURL string
+	query   url.Values
+	index   uint64
+	last    time.Time // 上一次请求开始的时间
+}
+
+func (f *consulFetcher) fetch(ctx context.Context) ([]registry.Endpoint, error) {
+	// 缺少 X-Consul-Index 的响应、index 重置后的请求以及不支持阻塞查询的实现都会立即返回，
+	// 这里保证两次请求之间至少间隔 consulMinInterval；真正阻塞过的请求不受影响
+	if wait := consulMinInterval - time.Since(f.last); !f.last.IsZero() && wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	f.last = time.Now()
+
+	query := url.Values{}
+	for k, v := range f.query {
+		query[k] = v
+	}
+	if f.index > 0 {
+		query.Set("index", strconv.FormatUint(f.index, 10))
+		query.Set("wait", consulWait.String())
+	}
+	u := f.baseURL
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, consulWait+listTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul catalog %s: %s", u, resp.Status)
+	}
+
+	var services []consulService
+	if err := json.NewDecoder(resp.Body).Decode(&services); err != nil {
+		return nil, fmt.Errorf("decode consul catalog: %w", err)
+	}
+
+	// index 变小说明 Consul 的状态被重置，需要从头开始阻塞查询；
+	// 按 Consul 文档的建议，index 缺失或为 0 时取 1，之后的请求仍然是阻塞查询
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if index < f.index {
+		index = 0
+	} else {
+		index = max(index, 1)
+	}
+	f.index = index
+
+	endpoints := make([]registry.Endpoint, 0, len(services))
+	for _, s := range services {
+		endpoints = append(endpoints, s.endpoint())
+	}
+	return endpoints, nil
+}
+
+// endpoint 把 catalog 条目转换为实例信息，ServiceAddress 为空时使用节点地址
+func (s consulService) endpoint() registry.Endpoint {
+	host := s.ServiceAddress
+	if host == "" {
+		host = s.Address
+	}
+	ep := registry.Endpoint{
+		Addr:   net.JoinHostPort(host, strconv.Itoa(s.ServicePort)),
+		Weight: int32(s.ServiceWeights.Passing),
+	}
+	for k, v := range s.ServiceMeta {
+		switch k {
+		case "version":
+			ep.Version = v
+		case "zone":
+			ep.Zone = v
+		default:
+			if ep.Labels == nil {
+				ep.Labels = make(map[string]string)
+			}
+			ep.Labels[k] = v
+		}
+	}
+	if len(s.ServiceTags) > 0 {
+		if ep.Labels == nil {
+			ep.Labels = make(map[string]string)
+		}
+		ep.Labels["tags"] = strings.Join(s.ServiceTags, ",")
+	}
+	return ep
+}
@@ -0,0 +1,90 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+// DNSSRVScheme DNS SRV 解析器的 scheme
+const DNSSRVScheme = "dnssrv"
+
+// dnsSRVBuilder 通过 DNS SRV 记录解析实例列表
+type dnsSRVBuilder struct {
+	interval time.Duration
+}
+
+// NewDNSSRVResolver 创建 DNS SRV 解析器构建器，target 形如：
+//
+//	dnssrv:///_grpc._tcp.hello.example.com
+//	dnssrv://8.8.8.8:53/hello.example.com?service=grpc&proto=tcp
+//
+// authority 不为空时使用它作为 DNS 服务器。SRV 记录的 weight 映射为实例权重，
+// priority 放在标签 priority 中。每隔 interval 重新解析一次，ResolveNow 会立即触发解析。
+func NewDNSSRVResolver(interval time.Duration) resolver.Builder {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &dnsSRVBuilder{interval: interval}
+}
+
+func (b *dnsSRVBuilder) Scheme() string {
+	return DNSSRVScheme
+}
+
+func (b *dnsSRVBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	query := target.URL.Query()
+	f := &dnsSRVFetcher{
+		service:  query.Get("service"),
+		proto:    query.Get("proto"),
+		name:     target.Endpoint(),
+		resolver: net.DefaultResolver,
+	}
+	if f.service != "" && f.proto == "" {
+		f.proto = "tcp"
+	}
+	if server := target.URL.Host; server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		f.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return newPollResolver(cc, b.interval, f.fetch), nil
+}
+
+type dnsSRVFetcher struct {
+	service  string
+	proto    string
+	name     string
+	resolver *net.Resolver
+}
+
+func (f *dnsSRVFetcher) fetch(ctx context.Context) ([]registry.Endpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+	_, srvs, err := f.resolver.LookupSRV(ctx, f.service, f.proto, f.name)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]registry.Endpoint, 0, len(srvs))
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		endpoints = append(endpoints, registry.Endpoint{
+			Addr:   net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+			Weight: int32(srv.Weight),
+			Labels: map[string]string{"priority": strconv.Itoa(int(srv.Priority))},
+		})
+	}
+	return endpoints, nil
+}
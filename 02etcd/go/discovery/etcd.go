@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/resolver"
+)
+
+// NewEtcdResolver 创建基于 etcd 的解析器构建器，scheme 为 registry.DefaultSchema。
+// etcdAddr 为默认集群，clusters 把 target 中的 authority 映射到对应的 etcd 集群，地址之间用逗号分隔。
+// 同一个集群的多个 ClientConn 共享一个 etcd 客户端，最后一个解析器关闭时客户端随之关闭。
+func NewEtcdResolver(etcdAddr string, clusters map[string]string) resolver.Builder {
+	c := &etcdClusters{etcdAddr: etcdAddr, clusters: clusters}
+	return NewBuilder(registry.DefaultSchema, c.open)
+}
+
+// etcdClusters 根据 target 选择 etcd 集群
+type etcdClusters struct {
+	etcdAddr string            // 默认集群地址
+	clusters map[string]string // authority -> 集群地址
+}
+
+func (c *etcdClusters) open(target resolver.Target) (registry.Registry, func(), error) {
+	endpoints, err := c.clusterEndpoints(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	//获取该集群共享的etcd client
+	cli, err := pool.acquire(endpoints)
+	if err != nil {
+		fmt.Printf("connect etcd err : %s\n", err)
+		return nil, nil, err
+	}
+	return registry.NewEtcd(cli), func() { pool.release(cli) }, nil
+}
+
+// clientPool 按 etcd 集群共享客户端，并用引用计数管理其生命周期
+type clientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	cli  *clientv3.Client
+	refs int
+}
+
+var pool = &clientPool{clients: make(map[string]*pooledClient)}
+
+// acquire 获取指定集群的客户端，不存在时新建；用完后需要调用 release
+func (p *clientPool) acquire(endpoints []string) (*clientv3.Client, error) {
+	key := strings.Join(endpoints, ",")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pc, ok := p.clients[key]; ok {
+		pc.refs++
+		return pc.cli, nil
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 15 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = &pooledClient{cli: cli, refs: 1}
+	return cli, nil
+}
+
+// release 释放一次引用，引用归零时关闭客户端
+func (p *clientPool) release(cli *clientv3.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, pc := range p.clients {
+		if pc.cli != cli {
+			continue
+		}
+		if pc.refs--; pc.refs == 0 {
+			delete(p.clients, key)
+			if err := pc.cli.Close(); err != nil {
+				fmt.Printf("close etcd client err : %s\n", err)
+			}
+		}
+		return
+	}
+}
+
+// clusterEndpoints 根据 target 选择 etcd 集群，优先级依次为：
+//   - 查询参数 endpoints，例如 ns:///helloService?endpoints=10.0.0.1:2379,10.0.0.2:2379
+//   - authority 对应的具名集群，例如 ns://barry/helloService
+//   - authority 本身就是 etcd 地址，例如 ns://10.0.0.1:2379,10.0.0.2:2379/helloService
+//   - authority 为空时使用默认集群
+//
+// authority 是未配置的集群名时返回错误，避免拼写错误把流量导向默认集群。
+func (c *etcdClusters) clusterEndpoints(target resolver.Target) ([]string, error) {
+	query, err := url.ParseQuery(target.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("parse target query %q: %w", target.URL.RawQuery, err)
+	}
+	addr := c.etcdAddr
+	authority := target.URL.Host
+	if v := query.Get("endpoints"); v != "" {
+		addr = v
+	} else if v, ok := c.clusters[authority]; ok {
+		addr = v
+	} else if strings.Contains(authority, ":") {
+		addr = authority
+	} else if authority != "" {
+		return nil, fmt.Errorf("unknown etcd cluster %q in target %q", authority, target.URL.String())
+	}
+	return splitEndpoints(addr), nil
+}
+
+// splitEndpoints 拆分以逗号或分号分隔的地址列表，排序后作为共享客户端的 key
+func splitEndpoints(addr string) []string {
+	endpoints := strings.FieldsFunc(addr, func(r rune) bool { return r == ',' || r == ';' })
+	slices.Sort(endpoints)
+	return slices.Compact(endpoints)
+}
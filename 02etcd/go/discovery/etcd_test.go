@@ -0,0 +1,55 @@
+package discovery
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func TestEtcdClusterEndpoints(t *testing.T) {
+	c := &etcdClusters{
+		etcdAddr: "127.0.0.1:2379",
+		clusters: map[string]string{"barry": "10.0.0.2:2379,10.0.0.1:2379"},
+	}
+	tests := []struct {
+		target  string
+		want    []string
+		wantErr bool
+	}{
+		{target: "ns:///hello", want: []string{"127.0.0.1:2379"}},
+		{target: "ns://barry/hello", want: []string{"10.0.0.1:2379", "10.0.0.2:2379"}},
+		{target: "ns://10.0.0.3:2379;10.0.0.4:2379/hello", want: []string{"10.0.0.3:2379", "10.0.0.4:2379"}},
+		{target: "ns:///hello?endpoints=10.0.0.5:2379", want: []string{"10.0.0.5:2379"}},
+		// 查询参数优先于 authority
+		{target: "ns://nobody/hello?endpoints=10.0.0.5:2379", want: []string{"10.0.0.5:2379"}},
+		// 拼写错误的集群名不能退回默认集群
+		{target: "ns://bary/hello", wantErr: true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.target)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.target, err)
+		}
+		got, err := c.clusterEndpoints(resolver.Target{URL: *u})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: endpoints = %v, want error", tt.target, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: endpoints = %v, %v, want %v", tt.target, got, err, tt.want)
+		}
+	}
+}
+
+// 未配置的集群名在 Build 时就返回错误，不会连接任何 etcd
+func TestEtcdResolverUnknownCluster(t *testing.T) {
+	b := NewEtcdResolver("127.0.0.1:2379", map[string]string{"barry": "127.0.0.1:2379"})
+	u, _ := url.Parse("ns://bary/hello")
+	if _, err := b.Build(resolver.Target{URL: *u}, newFakeClientConn(), resolver.BuildOptions{}); err == nil {
+		t.Fatal("Build with an unknown cluster succeeded")
+	}
+}
@@ -0,0 +1,87 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+// FileScheme 文件解析器的 scheme
+const FileScheme = "file"
+
+// fileBuilder 从本地文件读取实例列表，文件内容变化后自动重新加载
+type fileBuilder struct {
+	interval time.Duration
+}
+
+// NewFileResolver 创建文件解析器构建器，target 形如 file:///etc/grpc/hello.yaml。
+// 文件内容为 registry.Endpoint 的列表，扩展名为 .yaml/.yml 时按 YAML 解析，否则按 JSON 解析：
+//
+//	# hello.yaml
+//	- addr: 127.0.0.1:3000
+//	  version: v1.0.0
+//	  zone: zone-a
+//	  weight: 10
+//
+// 每隔 interval 检查一次文件，内容有变化时推送新的地址列表。
+func NewFileResolver(interval time.Duration) resolver.Builder {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &fileBuilder{interval: interval}
+}
+
+func (b *fileBuilder) Scheme() string {
+	return FileScheme
+}
+
+func (b *fileBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	path := target.URL.Path
+	if path == "" {
+		return nil, fmt.Errorf("file resolver: missing path in target %q", target.URL.String())
+	}
+	f := &fileFetcher{path: filepath.Clean(path)}
+	return newPollResolver(cc, b.interval, f.fetch), nil
+}
+
+// fileFetcher 读取文件，内容未变化时直接返回上一次的结果
+type fileFetcher struct {
+	path      string
+	content   []byte
+	endpoints []registry.Endpoint
+}
+
+func (f *fileFetcher) fetch(ctx context.Context) ([]registry.Endpoint, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if f.endpoints != nil && bytes.Equal(content, f.content) {
+		return f.endpoints, nil
+	}
+
+	var endpoints []registry.Endpoint
+	switch strings.ToLower(filepath.Ext(f.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &endpoints)
+	default:
+		err = json.Unmarshal(content, &endpoints)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", f.path, err)
+	}
+	if endpoints == nil {
+		endpoints = []registry.Endpoint{}
+	}
+	f.content, f.endpoints = content, endpoints
+	return endpoints, nil
+}
@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+// fetchFunc 拉取一次服务实例列表。
+// 实现可以阻塞直到数据发生变化（例如 Consul 的阻塞查询），ctx 取消时应尽快返回。
+type fetchFunc func(ctx context.Context) ([]registry.Endpoint, error)
+
+// pollResolver 周期性拉取实例列表的解析器，文件、DNS SRV 和 Consul 解析器都基于它实现。
+// 列表发生变化时才推送给 ClientConn；拉取失败时上报错误并退避重试。
+type pollResolver struct {
+	fetch      fetchFunc
+	interval   time.Duration // 两次拉取的间隔，0 表示立即开始下一次（由 fetch 自己阻塞）
+	clientConn resolver.ClientConn
+	resolveNow chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func newPollResolver(cc resolver.ClientConn, interval time.Duration, fetch fetchFunc) *pollResolver {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &pollResolver{
+		fetch:      fetch,
+		interval:   interval,
+		clientConn: cc,
+		resolveNow: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// ResolveNow 立即触发一次拉取
+func (r *pollResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close 停止拉取并等待后台协程退出
+func (r *pollResolver) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *pollResolver) run() {
+	defer close(r.done)
+
+	var last []registry.Endpoint
+	updated := false
+	backoff := minBackoff
+	for {
+		endpoints, err := r.fetch(r.ctx)
+		if r.ctx.Err() != nil {
+			return
+		}
+		wait := r.interval
+		if err != nil {
+			fmt.Println("resolve service list err : ", err)
+			r.clientConn.ReportError(err)
+			wait = backoff
+			backoff = min(backoff*2, maxBackoff)
+		} else {
+			backoff = minBackoff
+			sortEndpoints(endpoints)
+			if !updated || !slices.EqualFunc(last, endpoints, func(a, b registry.Endpoint) bool { return a.Equal(b) }) {
+				last, updated = endpoints, true
+				if err := r.clientConn.UpdateState(newState(endpoints)); err != nil {
+					fmt.Println("update state err : ", err)
+				}
+			}
+		}
+
+		if wait <= 0 {
+			continue
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-r.resolveNow:
+			t.Stop()
+		case <-r.ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// newState 把实例列表转换为 resolver.State，所有解析器产生的地址格式一致：
+// 实例信息通过 registry.SetEndpoint 放在地址的 BalancerAttributes 中。
+func newState(endpoints []registry.Endpoint) resolver.State {
+	addrs := make([]resolver.Address, 0, len(endpoints))
+	for _, ep := range endpoints {
+		addrs = append(addrs, ep.Address())
+	}
+	return resolver.State{Addresses: addrs}
+}
+
+// sortEndpoints 按地址排序，便于比较两次拉取的结果
+func sortEndpoints(endpoints []registry.Endpoint) {
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Addr < endpoints[j].Addr })
+}
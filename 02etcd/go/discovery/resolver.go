@@ -0,0 +1,219 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	minBackoff  = 100 * time.Millisecond // 重连的初始退避时间
+	maxBackoff  = 30 * time.Second       // 重连的最大退避时间
+	listTimeout = 5 * time.Second        // 全量拉取的超时时间
+	stableWatch = 10 * time.Second       // watch 持续这么久后认为连接已恢复，重置退避时间
+)
+
+// Opener 为 target 打开注册中心，返回的 release 在解析器关闭时调用
+type Opener func(target resolver.Target) (reg registry.Registry, release func(), err error)
+
+// registryBuilder 基于 registry.Registry 的解析器构建器，每次 Build 创建一个独立的解析器
+type registryBuilder struct {
+	scheme string
+	open   Opener
+}
+
+// NewBuilder 创建基于注册中心的解析器构建器。
+// 服务地址的 key 前缀为 /<scheme>/<service>/，与 registry.Registrar 写入的 key 对应。
+func NewBuilder(scheme string, open Opener) resolver.Builder {
+	return &registryBuilder{scheme: scheme, open: open}
+}
+
+func (b *registryBuilder) Scheme() string {
+	return b.scheme
+}
+
+// Build 构建解析器 grpc.Dial()时调用
+func (b *registryBuilder) Build(target resolver.Target, clientConn resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	reg, release, err := b.open(target)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registryResolver{
+		reg:        reg,
+		release:    release,
+		keyPrefix:  "/" + target.URL.Scheme + "/" + target.Endpoint() + "/",
+		clientConn: clientConn,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go r.watch()
+	return r, nil
+}
+
+// registryResolver 监听注册中心中某个服务的地址列表并推送给 ClientConn
+type registryResolver struct {
+	reg        registry.Registry
+	release    func()
+	keyPrefix  string
+	clientConn resolver.ClientConn
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// ResolveNow watch 会持续推送变化，这里无需额外处理
+func (r *registryResolver) ResolveNow(rn resolver.ResolveNowOptions) {}
+
+// Close 停止 watch，等待后台协程退出后释放注册中心
+func (r *registryResolver) Close() {
+	r.cancel()
+	<-r.done
+	if r.release != nil {
+		r.release()
+	}
+}
+
+// watch机制：监听某个key前缀的服务地址列表的变化。
+// 先全量拉取，再从拉取时的 revision+1 开始 watch，保证两次调用之间的变化不会丢失；
+// 遇到压缩（compaction）时重新全量拉取，注册中心不可用时退避重连。
+func (r *registryResolver) watch() {
+	defer close(r.done)
+
+	endpoints := make(map[string]registry.Endpoint)
+	var rev int64 // 下一次 watch 的起始 revision，0 表示需要重新全量拉取
+	backoff := minBackoff
+	for {
+		if rev == 0 {
+			listRev, err := r.list(endpoints)
+			if err != nil {
+				if r.ctx.Err() != nil {
+					return
+				}
+				fmt.Println("get service list err : ", err)
+				r.clientConn.ReportError(err)
+				if !r.sleep(backoff) {
+					return
+				}
+				backoff = min(backoff*2, maxBackoff)
+				continue
+			}
+			rev = listRev + 1
+			backoff = minBackoff
+			r.updateState(endpoints)
+		}
+
+		//监听服务地址列表的变化
+		start, startRev := time.Now(), rev
+		var err error
+		rev, err = r.watchFrom(rev, endpoints)
+		if r.ctx.Err() != nil {
+			return
+		}
+		// watch 收到过事件或持续了一段时间，说明注册中心是健康的，
+		// 之后的错误从最小退避时间重新开始
+		if rev > startRev || time.Since(start) >= stableWatch {
+			backoff = minBackoff
+		}
+		if err == nil {
+			continue
+		}
+		fmt.Println("watch service list err : ", err)
+		if rev != 0 {
+			// 压缩后立即重新全量拉取，其它错误上报后退避重连
+			r.clientConn.ReportError(err)
+			if !r.sleep(backoff) {
+				return
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}
+}
+
+// list 全量拉取服务地址列表，返回本次读取的 revision
+func (r *registryResolver) list(endpoints map[string]registry.Endpoint) (int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, listTimeout)
+	defer cancel()
+	kvs, rev, err := r.reg.List(ctx, r.keyPrefix)
+	if err != nil {
+		return 0, err
+	}
+	clear(endpoints)
+	for _, kv := range kvs {
+		putEndpoint(endpoints, r.keyPrefix, kv)
+	}
+	return rev, nil
+}
+
+// watchFrom 从 rev 开始 watch，直到 watch 被取消或出错。
+// 返回下一次 watch 的起始 revision；发生压缩时返回 0 表示需要重新全量拉取。
+func (r *registryResolver) watchFrom(rev int64, endpoints map[string]registry.Endpoint) (int64, error) {
+	// 每次 watch 使用独立的 ctx，提前返回时能释放底层的 watch 流
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+
+	for n := range r.reg.Watch(ctx, r.keyPrefix, rev) {
+		if n.CompactRevision != 0 {
+			return 0, fmt.Errorf("watch revision %d compacted at %d: %w", rev, n.CompactRevision, n.Err)
+		}
+		if n.Err != nil {
+			return rev, n.Err
+		}
+		for _, ev := range n.Events {
+			switch ev.Type {
+			case registry.EventPut:
+				putEndpoint(endpoints, r.keyPrefix, ev.KV)
+			case registry.EventDelete:
+				delete(endpoints, strings.TrimPrefix(ev.KV.Key, r.keyPrefix))
+			}
+		}
+		rev = n.Revision + 1
+		if len(n.Events) > 0 {
+			r.updateState(endpoints)
+		}
+	}
+	if r.ctx.Err() != nil {
+		return rev, nil
+	}
+	return rev, errors.New("watch channel closed")
+}
+
+// updateState 把当前的地址列表推送给 ClientConn
+func (r *registryResolver) updateState(endpoints map[string]registry.Endpoint) {
+	eps := slices.Collect(maps.Values(endpoints))
+	sortEndpoints(eps)
+	if err := r.clientConn.UpdateState(newState(eps)); err != nil {
+		fmt.Println("update state err : ", err)
+	}
+}
+
+// sleep 等待 d，resolver 关闭时返回 false
+func (r *registryResolver) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// putEndpoint 解析注册中心中的实例信息，地址以 key 的后缀为准
+func putEndpoint(endpoints map[string]registry.Endpoint, keyPrefix string, kv registry.KeyValue) {
+	addr := strings.TrimPrefix(kv.Key, keyPrefix)
+	ep, err := registry.Unmarshal(kv.Value)
+	if err != nil {
+		fmt.Printf("decode endpoint %s err : %s\n", addr, err)
+	}
+	ep.Addr = addr
+	endpoints[addr] = ep
+}
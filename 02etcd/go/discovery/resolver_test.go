@@ -0,0 +1,384 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+const testTimeout = 5 * time.Second
+
+// fakeClock 手动推进的时钟，配合 registry.NewMemoryWithClock 和 ExpireLeases 使用
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fakeClientConn 记录解析器推送的地址列表和错误
+type fakeClientConn struct {
+	resolver.ClientConn // 未实现的方法调用时会 panic
+	states              chan resolver.State
+	errs                chan error
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{
+		states: make(chan resolver.State, 16),
+		errs:   make(chan error, 16),
+	}
+}
+
+func (cc *fakeClientConn) UpdateState(s resolver.State) error {
+	cc.states <- s
+	return nil
+}
+
+func (cc *fakeClientConn) ReportError(err error) {
+	select {
+	case cc.errs <- err:
+	default:
+	}
+}
+
+// waitAddrs 等待下一次推送并返回其中的实例信息
+func (cc *fakeClientConn) waitAddrs(t *testing.T) []registry.Endpoint {
+	t.Helper()
+	select {
+	case s := <-cc.states:
+		eps := make([]registry.Endpoint, 0, len(s.Addresses))
+		for _, addr := range s.Addresses {
+			ep, ok := registry.EndpointFromAddress(addr)
+			if !ok || ep.Addr != addr.Addr {
+				t.Fatalf("address %v carries endpoint %v, %v", addr.Addr, ep, ok)
+			}
+			eps = append(eps, ep)
+		}
+		return eps
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for resolver state")
+	}
+	return nil
+}
+
+func addrsOf(eps []registry.Endpoint) []string {
+	addrs := make([]string, 0, len(eps))
+	for _, ep := range eps {
+		addrs = append(addrs, ep.Addr)
+	}
+	return addrs
+}
+
+func equalAddrs(eps []registry.Endpoint, want ...string) bool {
+	got := addrsOf(eps)
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// buildResolver 用内存注册中心构建 ns:///hello 的解析器
+func buildResolver(t *testing.T, m *registry.Memory) *fakeClientConn {
+	t.Helper()
+	b := NewBuilder("ns", func(resolver.Target) (registry.Registry, func(), error) {
+		return m, nil, nil
+	})
+	u, _ := url.Parse("ns:///hello")
+	cc := newFakeClientConn()
+	r, err := b.Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	t.Cleanup(r.Close)
+	return cc
+}
+
+func put(t *testing.T, m *registry.Memory, ep registry.Endpoint, lease registry.LeaseID) {
+	t.Helper()
+	val, _ := ep.Marshal()
+	if err := m.Put(context.Background(), registry.Key("ns", "hello", ep.Addr), val, lease); err != nil {
+		t.Fatalf("Put(%s): %v", ep.Addr, err)
+	}
+}
+
+func TestResolverListsThenWatches(t *testing.T) {
+	m := registry.NewMemoryWithClock((&fakeClock{}).Now)
+	defer m.Close()
+	put(t, m, registry.Endpoint{Addr: "127.0.0.1:3001", Zone: "zone-b", Weight: 5}, 0)
+	// 其它服务的 key 不应出现在结果中
+	m.Put(context.Background(), registry.Key("ns", "other", "127.0.0.1:9000"), []byte("127.0.0.1:9000"), 0)
+
+	cc := buildResolver(t, m)
+	eps := cc.waitAddrs(t)
+	if !equalAddrs(eps, "127.0.0.1:3001") || eps[0].Zone != "zone-b" || eps[0].Weight != 5 {
+		t.Fatalf("initial endpoints = %v", eps)
+	}
+
+	put(t, m, registry.Endpoint{Addr: "127.0.0.1:3000"}, 0)
+	if eps := cc.waitAddrs(t); !equalAddrs(eps, "127.0.0.1:3000", "127.0.0.1:3001") {
+		t.Fatalf("after put: %v", addrsOf(eps))
+	}
+
+	// 更新实例信息只修改属性，地址不变
+	put(t, m, registry.Endpoint{Addr: "127.0.0.1:3001", Zone: "zone-b", Weight: 20}, 0)
+	if eps := cc.waitAddrs(t); len(eps) != 2 || eps[1].Weight != 20 {
+		t.Fatalf("after update: %v", eps)
+	}
+
+	m.Delete(context.Background(), registry.Key("ns", "hello", "127.0.0.1:3000"))
+	if eps := cc.waitAddrs(t); !equalAddrs(eps, "127.0.0.1:3001") {
+		t.Fatalf("after delete: %v", addrsOf(eps))
+	}
+}
+
+// 租约过期（停止续期后推进时钟）和撤销时，解析器都会摘除对应的实例
+func TestResolverDropsLostLeases(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	m := registry.NewMemoryWithClock(clock.Now)
+	defer m.Close()
+	ctx := context.Background()
+
+	expiring, _ := m.Grant(ctx, 10)
+	revoked, _ := m.Grant(ctx, 10)
+	put(t, m, registry.Endpoint{Addr: "127.0.0.1:3000"}, expiring)
+	put(t, m, registry.Endpoint{Addr: "127.0.0.1:3001"}, revoked)
+	kctx, stopKeepAlive := context.WithCancel(ctx)
+	lost, _ := m.KeepAlive(kctx, expiring)
+	m.KeepAlive(ctx, revoked)
+
+	cc := buildResolver(t, m)
+	if eps := cc.waitAddrs(t); len(eps) != 2 {
+		t.Fatalf("initial endpoints = %v", addrsOf(eps))
+	}
+
+	// 续期中的租约不会过期
+	clock.Advance(time.Minute)
+	m.ExpireLeases()
+	select {
+	case s := <-cc.states:
+		t.Fatalf("unexpected update while kept alive: %v", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stopKeepAlive()
+	<-lost
+	clock.Advance(10 * time.Second)
+	m.ExpireLeases()
+	if eps := cc.waitAddrs(t); !equalAddrs(eps, "127.0.0.1:3001") {
+		t.Fatalf("after expiry: %v", addrsOf(eps))
+	}
+
+	if err := m.Revoke(ctx, revoked); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if eps := cc.waitAddrs(t); len(eps) != 0 {
+		t.Fatalf("after revoke: %v", addrsOf(eps))
+	}
+}
+
+// 跟随 Registrar 注册和注销，解析结果与注册中心保持一致
+func TestResolverFollowsRegistrar(t *testing.T) {
+	m := registry.NewMemoryWithClock((&fakeClock{}).Now)
+	defer m.Close()
+	ctx := context.Background()
+
+	cc := buildResolver(t, m)
+	if eps := cc.waitAddrs(t); len(eps) != 0 {
+		t.Fatalf("initial endpoints = %v", addrsOf(eps))
+	}
+
+	reg := registry.NewRegistrar(registry.Config{Registry: m, Schema: "ns", TTL: 10})
+	inst := reg.Instance("hello", registry.Endpoint{Addr: "127.0.0.1:3000", Version: "v1"})
+	if err := inst.Register(ctx); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if eps := cc.waitAddrs(t); !equalAddrs(eps, "127.0.0.1:3000") || eps[0].Version != "v1" {
+		t.Fatalf("after register: %v", eps)
+	}
+
+	if err := reg.Deregister(ctx); err != nil {
+		t.Fatalf("Deregister: %v", err)
+	}
+	if eps := cc.waitAddrs(t); len(eps) != 0 {
+		t.Fatalf("after deregister: %v", addrsOf(eps))
+	}
+}
+
+// 注册中心不可用时上报错误，Close 不会被退避重连阻塞，并释放注册中心
+func TestResolverReportsErrorsAndCloses(t *testing.T) {
+	m := registry.NewMemoryWithClock((&fakeClock{}).Now)
+	released := false
+	b := NewBuilder("ns", func(resolver.Target) (registry.Registry, func(), error) {
+		return m, func() { released = true }, nil
+	})
+	u, _ := url.Parse("ns:///hello")
+	cc := newFakeClientConn()
+	r, err := b.Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	cc.waitAddrs(t)
+
+	m.Close()
+	select {
+	case err := <-cc.errs:
+		if !errors.Is(err, registry.ErrClosed) {
+			t.Fatalf("reported error = %v, want ErrClosed", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for ReportError")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(testTimeout):
+		t.Fatal("Close blocked")
+	}
+	if !released {
+		t.Fatal("registry not released on Close")
+	}
+}
+
+func TestBuilderOpenError(t *testing.T) {
+	want := errors.New("open failed")
+	b := NewBuilder("ns", func(resolver.Target) (registry.Registry, func(), error) {
+		return nil, nil, want
+	})
+	u, _ := url.Parse("ns:///hello")
+	if _, err := b.Build(resolver.Target{URL: *u}, newFakeClientConn(), resolver.BuildOptions{}); !errors.Is(err, want) {
+		t.Fatalf("Build: err = %v, want %v", err, want)
+	}
+}
+
+// buildTarget 用 b 构建 target 的解析器
+func buildTarget(t *testing.T, b resolver.Builder, target string) *fakeClientConn {
+	t.Helper()
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("parse %q: %v", target, err)
+	}
+	cc := newFakeClientConn()
+	r, err := b.Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build(%s): %v", target, err)
+	}
+	t.Cleanup(r.Close)
+	return cc
+}
+
+// 阻塞查询带上一次响应的 X-Consul-Index，index 变化后解析器推送新的地址列表
+func TestConsulResolverFollowsIndex(t *testing.T) {
+	changed := make(chan struct{})
+	indexes := make(chan string, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/catalog/service/hello" || r.URL.Query().Get("dc") != "dc1" {
+			http.NotFound(w, r)
+			return
+		}
+		index := r.URL.Query().Get("index")
+		indexes <- index
+		services := `[{"Address":"127.0.0.1","ServicePort":3000,"ServiceMeta":{"zone":"zone-a"},"ServiceWeights":{"Passing":5}}]`
+		switch index {
+		case "":
+			w.Header().Set("X-Consul-Index", "5")
+		case "5":
+			// 阻塞到数据变化
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			w.Header().Set("X-Consul-Index", "6")
+			services = `[{"Address":"127.0.0.1","ServicePort":3000},{"Address":"10.0.0.1","ServiceAddress":"127.0.0.1","ServicePort":3001}]`
+		default:
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, services)
+	}))
+	t.Cleanup(srv.Close) // 先于解析器注册，解析器关闭后再关闭服务
+
+	cc := buildTarget(t, NewConsulResolver(srv.Client()), "consul://"+srv.Listener.Addr().String()+"/hello?dc=dc1")
+	eps := cc.waitAddrs(t)
+	if !equalAddrs(eps, "127.0.0.1:3000") || eps[0].Zone != "zone-a" || eps[0].Weight != 5 {
+		t.Fatalf("initial endpoints = %v", eps)
+	}
+
+	close(changed)
+	if eps := cc.waitAddrs(t); !equalAddrs(eps, "127.0.0.1:3000", "127.0.0.1:3001") {
+		t.Fatalf("after index change: %v", addrsOf(eps))
+	}
+	for _, want := range []string{"", "5", "6"} {
+		select {
+		case got := <-indexes:
+			if got != want {
+				t.Fatalf("request index = %q, want %q", got, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("timed out waiting for the request with index %q", want)
+		}
+	}
+}
+
+// 文件内容变化后重新加载，推送新的地址列表
+func TestFileResolverReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	write("- addr: 127.0.0.1:3000\n  version: v1\n")
+
+	cc := buildTarget(t, NewFileResolver(10*time.Millisecond), "file://"+path)
+	if eps := cc.waitAddrs(t); !equalAddrs(eps, "127.0.0.1:3000") || eps[0].Version != "v1" {
+		t.Fatalf("initial endpoints = %v", eps)
+	}
+
+	write("- addr: 127.0.0.1:3001\n  weight: 3\n- addr: 127.0.0.1:3002\n")
+	eps := cc.waitAddrs(t)
+	if !equalAddrs(eps, "127.0.0.1:3001", "127.0.0.1:3002") || eps[0].Weight != 3 {
+		t.Fatalf("after rewrite: %v", eps)
+	}
+
+	// 内容不变时不重复推送
+	write("- addr: 127.0.0.1:3001\n  weight: 3\n- addr: 127.0.0.1:3002\n")
+	select {
+	case s := <-cc.states:
+		t.Fatalf("unexpected update for unchanged file: %v", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
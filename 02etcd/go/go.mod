@@ -3,10 +3,13 @@ module github.com/clin211/grpc/02etcd
 go 1.23.4
 
 require (
+	github.com/clin211/grpc/health v0.0.0-00010101000000-000000000000
+	github.com/clin211/grpc/mtls v0.0.0-00010101000000-000000000000
 	go.etcd.io/etcd/api/v3 v3.5.17
 	go.etcd.io/etcd/client/v3 v3.5.17
 	google.golang.org/grpc v1.69.2
-	google.golang.org/protobuf v1.35.1
+	google.golang.org/protobuf v1.36.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -24,3 +27,7 @@ require (
 	google.golang.org/genproto/googleapis/api v0.0.0-20241015192408-796eee8c2d53 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
 )
+
+replace github.com/clin211/grpc/health => ../../04health/go
+
+replace github.com/clin211/grpc/mtls => ../../mtls
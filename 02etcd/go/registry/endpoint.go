@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Endpoint 注册到注册中心的服务实例信息，以 JSON 形式保存在 key 对应的 value 中
+type Endpoint struct {
+	Addr    string            `json:"addr" yaml:"addr"`                           // 服务地址 host:port
+	Version string            `json:"version,omitempty" yaml:"version,omitempty"` // 服务版本
+	Zone    string            `json:"zone,omitempty" yaml:"zone,omitempty"`       // 所在可用区
+	Weight  int32             `json:"weight,omitempty" yaml:"weight,omitempty"`   // 权重，0 表示未设置
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`   // 其它自定义标签
+}
+
+// Marshal 把实例信息编码为注册中心的 value
+func (e Endpoint) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Unmarshal 解码注册中心的 value。
+// 兼容旧版本只写入 host:port 的情况：value 不是 JSON 时把它当作地址。
+func Unmarshal(value []byte) (Endpoint, error) {
+	var ep Endpoint
+	if !strings.HasPrefix(strings.TrimSpace(string(value)), "{") {
+		ep.Addr = string(value)
+		return ep, nil
+	}
+	err := json.Unmarshal(value, &ep)
+	return ep, err
+}
+
+// Equal 实现 attributes 的比较接口（Labels 是 map，不能直接用 == 比较）
+func (e Endpoint) Equal(o any) bool {
+	oe, ok := o.(Endpoint)
+	if !ok {
+		return false
+	}
+	return e.Addr == oe.Addr &&
+		e.Version == oe.Version &&
+		e.Zone == oe.Zone &&
+		e.Weight == oe.Weight &&
+		maps.Equal(e.Labels, oe.Labels)
+}
+
+// String 便于在日志和 attributes 中打印实例信息
+func (e Endpoint) String() string {
+	return fmt.Sprintf("{addr: %s, version: %s, zone: %s, weight: %d, labels: %v}", e.Addr, e.Version, e.Zone, e.Weight, e.Labels)
+}
+
+type endpointKey struct{}
+
+// SetEndpoint 把实例信息放入地址的 BalancerAttributes。
+// 使用 BalancerAttributes 而不是 Attributes，权重等信息变化时不会导致 SubConn 重建。
+func SetEndpoint(addr resolver.Address, ep Endpoint) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(endpointKey{}, ep)
+	return addr
+}
+
+// EndpointFromAddress 从地址中取出实例信息
+func EndpointFromAddress(addr resolver.Address) (Endpoint, bool) {
+	ep, ok := addr.BalancerAttributes.Value(endpointKey{}).(Endpoint)
+	return ep, ok
+}
+
+// Address 把实例信息转换为 gRPC 的地址
+func (e Endpoint) Address() resolver.Address {
+	return SetEndpoint(resolver.Address{Addr: e.Addr}, e)
+}
@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"context"
+	"errors"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdRegistry 基于 etcd 的 Registry 实现
+type etcdRegistry struct {
+	cli *clientv3.Client
+}
+
+// NewEtcd 使用 etcd 客户端创建 Registry，客户端由调用方负责关闭
+func NewEtcd(cli *clientv3.Client) Registry {
+	return &etcdRegistry{cli: cli}
+}
+
+func (e *etcdRegistry) Grant(ctx context.Context, ttl int64) (LeaseID, error) {
+	resp, err := e.cli.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return LeaseID(resp.ID), nil
+}
+
+func (e *etcdRegistry) KeepAlive(ctx context.Context, id LeaseID) (<-chan struct{}, error) {
+	ch, err := e.cli.KeepAlive(ctx, clientv3.LeaseID(id))
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		// etcd 的 KeepAlive 通道在租约过期、续期失败或 ctx 取消时关闭
+		for range ch {
+		}
+	}()
+	return lost, nil
+}
+
+func (e *etcdRegistry) Revoke(ctx context.Context, id LeaseID) error {
+	_, err := e.cli.Revoke(ctx, clientv3.LeaseID(id))
+	return convertErr(err)
+}
+
+func (e *etcdRegistry) Put(ctx context.Context, key string, value []byte, lease LeaseID) error {
+	var opts []clientv3.OpOption
+	if lease != 0 {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(lease)))
+	}
+	_, err := e.cli.Put(ctx, key, string(value), opts...)
+	return convertErr(err)
+}
+
+func (e *etcdRegistry) Delete(ctx context.Context, key string) error {
+	_, err := e.cli.Delete(ctx, key)
+	return convertErr(err)
+}
+
+func (e *etcdRegistry) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	resp, err := e.cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	kvs := make([]KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, KeyValue{Key: string(kv.Key), Value: kv.Value, ModRevision: kv.ModRevision})
+	}
+	return kvs, resp.Header.Revision, nil
+}
+
+func (e *etcdRegistry) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	go func() {
+		defer close(out)
+		// 提前返回时取消底层的 watch 流；
+		// WithRequireLeader 让 etcd 集群失去 leader 时 watch 能及时返回错误
+		ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		defer cancel()
+
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+		for n := range e.cli.Watch(ctx, prefix, opts...) {
+			resp := WatchResponse{
+				Revision:        n.Header.Revision,
+				CompactRevision: n.CompactRevision,
+				Err:             convertErr(n.Err()),
+			}
+			for _, ev := range n.Events {
+				we := WatchEvent{
+					Type: EventPut,
+					KV:   KeyValue{Key: string(ev.Kv.Key), Value: ev.Kv.Value, ModRevision: ev.Kv.ModRevision},
+				}
+				if ev.Type == mvccpb.DELETE {
+					we.Type = EventDelete
+				}
+				resp.Events = append(resp.Events, we)
+			}
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				return
+			}
+			if resp.Err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// convertErr 把 etcd 的错误转换为 registry 包的错误
+func convertErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, rpctypes.ErrLeaseNotFound):
+		return ErrLeaseNotFound
+	case errors.Is(err, rpctypes.ErrCompacted):
+		return ErrCompacted
+	default:
+		return err
+	}
+}
@@ -0,0 +1,396 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory 进程内的 Registry 实现，语义与 etcd 保持一致：
+// 租约到期后其下的 key 被删除；每次变更递增 revision；watch 可以从历史 revision 回放，
+// 被 Compact 压缩掉的 revision 返回 CompactRevision。
+// 历史最多保留最近 DefaultHistoryRevisions 个 revision，更早的在写入时自动压缩，
+// 与 etcd 开启自动压缩时的行为一致。
+//
+// 使用 NewMemory 创建时后台按真实时间清理过期租约；
+// 使用 NewMemoryWithClock 创建时不启动后台清理，由调用方推进时钟后调用 ExpireLeases，
+// 便于在没有 etcd 的环境下编写确定性的测试。
+type Memory struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	rev       int64
+	compacted int64
+	retention int64 // 保留的历史 revision 数量
+	nextLease LeaseID
+	kvs       map[string]*memKV
+	leases    map[LeaseID]*memLease
+	history   []memEvent
+	watchers  map[*memWatcher]struct{}
+	closed    bool
+	stop      chan struct{}
+}
+
+type memKV struct {
+	value       []byte
+	lease       LeaseID
+	modRevision int64
+}
+
+type memLease struct {
+	ttl      time.Duration
+	deadline time.Time
+	keys     map[string]struct{}
+	keepers  int           // 正在续期的 KeepAlive 数量，大于 0 时租约不会过期
+	lost     chan struct{} // 租约被撤销或过期时关闭
+}
+
+// DefaultHistoryRevisions Memory 保留的历史 revision 数量
+const DefaultHistoryRevisions = 1000
+
+type memEvent struct {
+	rev    int64
+	events []WatchEvent
+}
+
+// NewMemory 创建内存注册中心，后台按真实时间清理过期租约
+func NewMemory() *Memory {
+	m := NewMemoryWithClock(time.Now)
+	go m.janitor(100 * time.Millisecond)
+	return m
+}
+
+// NewMemoryWithClock 使用指定时钟创建内存注册中心，过期检查由调用方通过 ExpireLeases 触发
+func NewMemoryWithClock(now func() time.Time) *Memory {
+	return &Memory{
+		now:       now,
+		retention: DefaultHistoryRevisions,
+		kvs:       make(map[string]*memKV),
+		leases:    make(map[LeaseID]*memLease),
+		watchers:  make(map[*memWatcher]struct{}),
+		stop:      make(chan struct{}),
+	}
+}
+
+func (m *Memory) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.ExpireLeases()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Close 关闭注册中心，结束所有 watch 和 KeepAlive
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.stop)
+	for w := range m.watchers {
+		w.push(WatchResponse{Revision: m.rev, Err: ErrClosed})
+		delete(m.watchers, w)
+	}
+	for _, l := range m.leases {
+		close(l.lost)
+	}
+	clear(m.leases)
+	return nil
+}
+
+// ExpireLeases 删除已经到期的租约及其下的 key；正在续期的租约会被顺延
+func (m *Memory) ExpireLeases() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var expired []LeaseID
+	for id, l := range m.leases {
+		if l.keepers > 0 {
+			l.deadline = now.Add(l.ttl)
+			continue
+		}
+		if !now.Before(l.deadline) {
+			expired = append(expired, id)
+		}
+	}
+	for _, id := range expired {
+		m.revokeLocked(id)
+	}
+}
+
+// Compact 丢弃 rev 及之前的历史，之后从这些 revision 开始的 watch 会收到 CompactRevision
+func (m *Memory) Compact(rev int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rev = min(rev, m.rev)
+	if rev <= m.compacted {
+		return
+	}
+	m.compactLocked(rev)
+}
+
+func (m *Memory) compactLocked(rev int64) {
+	m.compacted = rev
+	i := 0
+	for i < len(m.history) && m.history[i].rev <= rev {
+		i++
+	}
+	m.history = m.history[i:]
+}
+
+// Delete 删除 key，也可以用来模拟其它客户端的删除操作
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	kv, ok := m.kvs[key]
+	if !ok {
+		return nil
+	}
+	if l, ok := m.leases[kv.lease]; ok {
+		delete(l.keys, key)
+	}
+	delete(m.kvs, key)
+	m.rev++
+	m.publishLocked([]WatchEvent{{Type: EventDelete, KV: KeyValue{Key: key, ModRevision: m.rev}}})
+	return nil
+}
+
+func (m *Memory) Grant(ctx context.Context, ttl int64) (LeaseID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+	m.nextLease++
+	d := time.Duration(ttl) * time.Second
+	m.leases[m.nextLease] = &memLease{
+		ttl:      d,
+		deadline: m.now().Add(d),
+		keys:     make(map[string]struct{}),
+		lost:     make(chan struct{}),
+	}
+	return m.nextLease, nil
+}
+
+func (m *Memory) KeepAlive(ctx context.Context, id LeaseID) (<-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.leases[id]
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+	l.keepers++
+	l.deadline = m.now().Add(l.ttl)
+
+	out := make(chan struct{})
+	go func() {
+		defer close(out)
+		select {
+		case <-ctx.Done():
+			m.mu.Lock()
+			// 停止续期后租约从此刻开始重新计时
+			l.keepers--
+			l.deadline = m.now().Add(l.ttl)
+			m.mu.Unlock()
+		case <-l.lost:
+		}
+	}()
+	return out, nil
+}
+
+func (m *Memory) Revoke(ctx context.Context, id LeaseID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if _, ok := m.leases[id]; !ok {
+		return ErrLeaseNotFound
+	}
+	m.revokeLocked(id)
+	return nil
+}
+
+// revokeLocked 删除租约及其下的 key，所有删除在同一个 revision 中完成
+func (m *Memory) revokeLocked(id LeaseID) {
+	l := m.leases[id]
+	delete(m.leases, id)
+	close(l.lost)
+	if len(l.keys) == 0 {
+		return
+	}
+	m.rev++
+	events := make([]WatchEvent, 0, len(l.keys))
+	for key := range l.keys {
+		delete(m.kvs, key)
+		events = append(events, WatchEvent{Type: EventDelete, KV: KeyValue{Key: key, ModRevision: m.rev}})
+	}
+	m.publishLocked(events)
+}
+
+func (m *Memory) Put(ctx context.Context, key string, value []byte, lease LeaseID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	var l *memLease
+	if lease != 0 {
+		var ok bool
+		if l, ok = m.leases[lease]; !ok {
+			return ErrLeaseNotFound
+		}
+	}
+	if old, ok := m.kvs[key]; ok && old.lease != lease {
+		if ol, ok := m.leases[old.lease]; ok {
+			delete(ol.keys, key)
+		}
+	}
+	if l != nil {
+		l.keys[key] = struct{}{}
+	}
+	m.rev++
+	value = append([]byte(nil), value...)
+	m.kvs[key] = &memKV{value: value, lease: lease, modRevision: m.rev}
+	m.publishLocked([]WatchEvent{{Type: EventPut, KV: KeyValue{Key: key, Value: value, ModRevision: m.rev}}})
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, 0, ErrClosed
+	}
+	var kvs []KeyValue
+	for key, kv := range m.kvs {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, KeyValue{Key: key, Value: kv.value, ModRevision: kv.modRevision})
+		}
+	}
+	return kvs, m.rev, nil
+}
+
+func (m *Memory) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	w := &memWatcher{
+		prefix: prefix,
+		out:    make(chan WatchResponse),
+		notify: make(chan struct{}, 1),
+	}
+	// 先在持锁时完成注册，返回后再启动发送协程
+	defer func() {
+		go w.run(ctx, func() {
+			m.mu.Lock()
+			delete(m.watchers, w)
+			m.mu.Unlock()
+		})
+	}()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.closed:
+		w.push(WatchResponse{Revision: m.rev, Err: ErrClosed})
+		return w.out
+	case rev > 0 && rev <= m.compacted:
+		w.push(WatchResponse{Revision: m.rev, CompactRevision: m.compacted, Err: ErrCompacted})
+		return w.out
+	}
+	// 回放 rev 之后的历史事件
+	if rev > 0 {
+		for _, h := range m.history {
+			if h.rev >= rev {
+				w.send(h)
+			}
+		}
+	}
+	m.watchers[w] = struct{}{}
+	return w.out
+}
+
+// publishLocked 记录历史并通知所有 watcher，超出保留范围的历史被压缩
+func (m *Memory) publishLocked(events []WatchEvent) {
+	h := memEvent{rev: m.rev, events: events}
+	m.history = append(m.history, h)
+	if m.rev-m.compacted > m.retention {
+		m.compactLocked(m.rev - m.retention)
+	}
+	for w := range m.watchers {
+		w.send(h)
+	}
+}
+
+// memWatcher 在内存中缓存待发送的事件，避免在持锁时阻塞
+type memWatcher struct {
+	prefix string
+	out    chan WatchResponse
+	notify chan struct{}
+
+	mu      sync.Mutex
+	pending []WatchResponse
+	done    bool // 已经推送了带错误的响应，之后不再接收事件
+}
+
+// send 过滤出前缀匹配的事件并排队
+func (w *memWatcher) send(h memEvent) {
+	var events []WatchEvent
+	for _, ev := range h.events {
+		if strings.HasPrefix(ev.KV.Key, w.prefix) {
+			events = append(events, ev)
+		}
+	}
+	if len(events) > 0 {
+		w.push(WatchResponse{Events: events, Revision: h.rev})
+	}
+}
+
+func (w *memWatcher) push(resp WatchResponse) {
+	w.mu.Lock()
+	if w.done {
+		w.mu.Unlock()
+		return
+	}
+	w.pending = append(w.pending, resp)
+	w.done = resp.Err != nil
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memWatcher) run(ctx context.Context, unregister func()) {
+	defer close(w.out)
+	defer unregister()
+	for {
+		w.mu.Lock()
+		pending := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+		for _, resp := range pending {
+			select {
+			case w.out <- resp:
+			case <-ctx.Done():
+				return
+			}
+			if resp.Err != nil {
+				return
+			}
+		}
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟，配合 NewMemoryWithClock 和 ExpireLeases 使用
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+const testTimeout = 5 * time.Second
+
+// recv 从 watch 通道读取一个响应，超时时测试失败
+func recv(t *testing.T, ch <-chan WatchResponse) WatchResponse {
+	t.Helper()
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			t.Fatal("watch channel closed")
+		}
+		return resp
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for watch response")
+	}
+	return WatchResponse{}
+}
+
+// waitClosed 等待通道关闭，超时时测试失败
+func waitClosed(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for channel to close")
+	}
+}
+
+func keys(t *testing.T, m *Memory, prefix string) map[string]string {
+	t.Helper()
+	kvs, _, err := m.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("List(%q): %v", prefix, err)
+	}
+	got := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		got[kv.Key] = string(kv.Value)
+	}
+	return got
+}
+
+func TestMemoryLeaseExpiresWithClock(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMemoryWithClock(clock.Now)
+	defer m.Close()
+	ctx := context.Background()
+
+	lease, err := m.Grant(ctx, 10)
+	if err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if err := m.Put(ctx, "/ns/svc/a", []byte("a"), lease); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	_, rev, _ := m.List(ctx, "/ns/")
+	w := m.Watch(ctx, "/ns/", rev+1)
+
+	clock.Advance(9 * time.Second)
+	m.ExpireLeases()
+	if got := keys(t, m, "/ns/"); len(got) != 1 {
+		t.Fatalf("before deadline: keys = %v, want 1 key", got)
+	}
+
+	clock.Advance(time.Second)
+	m.ExpireLeases()
+	if got := keys(t, m, "/ns/"); len(got) != 0 {
+		t.Fatalf("after deadline: keys = %v, want none", got)
+	}
+	resp := recv(t, w)
+	if len(resp.Events) != 1 || resp.Events[0].Type != EventDelete || resp.Events[0].KV.Key != "/ns/svc/a" {
+		t.Fatalf("watch events = %+v, want one delete of /ns/svc/a", resp.Events)
+	}
+	if err := m.Revoke(ctx, lease); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("Revoke expired lease: err = %v, want ErrLeaseNotFound", err)
+	}
+}
+
+// 续期中的租约永远不会过期，只有停止续期（ctx 取消）后才从那一刻重新计时
+func TestMemoryKeepAliveCancelRestartsTTL(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMemoryWithClock(clock.Now)
+	defer m.Close()
+
+	lease, _ := m.Grant(context.Background(), 10)
+	if err := m.Put(context.Background(), "/ns/svc/a", []byte("a"), lease); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	lost, err := m.KeepAlive(ctx, lease)
+	if err != nil {
+		t.Fatalf("KeepAlive: %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	m.ExpireLeases()
+	if got := keys(t, m, "/ns/"); len(got) != 1 {
+		t.Fatalf("while kept alive: keys = %v, want 1 key", got)
+	}
+
+	cancel()
+	waitClosed(t, lost)
+	clock.Advance(9 * time.Second)
+	m.ExpireLeases()
+	if got := keys(t, m, "/ns/"); len(got) != 1 {
+		t.Fatalf("9s after cancel: keys = %v, want 1 key", got)
+	}
+	clock.Advance(time.Second)
+	m.ExpireLeases()
+	if got := keys(t, m, "/ns/"); len(got) != 0 {
+		t.Fatalf("10s after cancel: keys = %v, want none", got)
+	}
+}
+
+func TestMemoryRevokeDeletesKeysInOneRevision(t *testing.T) {
+	m := NewMemoryWithClock(newFakeClock().Now)
+	defer m.Close()
+	ctx := context.Background()
+
+	lease, _ := m.Grant(ctx, 10)
+	for _, key := range []string{"/ns/svc/a", "/ns/svc/b"} {
+		if err := m.Put(ctx, key, []byte(key), lease); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	if err := m.Put(ctx, "/ns/svc/c", []byte("c"), 0); err != nil {
+		t.Fatalf("Put without lease: %v", err)
+	}
+	lost, err := m.KeepAlive(ctx, lease)
+	if err != nil {
+		t.Fatalf("KeepAlive: %v", err)
+	}
+	_, rev, _ := m.List(ctx, "/ns/")
+	w := m.Watch(ctx, "/ns/", rev+1)
+
+	if err := m.Revoke(ctx, lease); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	waitClosed(t, lost)
+
+	resp := recv(t, w)
+	if resp.Revision != rev+1 || len(resp.Events) != 2 {
+		t.Fatalf("watch response = %+v, want 2 deletes at revision %d", resp, rev+1)
+	}
+	for _, ev := range resp.Events {
+		if ev.Type != EventDelete {
+			t.Fatalf("event %+v, want delete", ev)
+		}
+	}
+	if got := keys(t, m, "/ns/"); len(got) != 1 || got["/ns/svc/c"] != "c" {
+		t.Fatalf("keys = %v, want only /ns/svc/c", got)
+	}
+}
+
+func TestMemoryWatchReplayAndCompaction(t *testing.T) {
+	m := NewMemoryWithClock(newFakeClock().Now)
+	defer m.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m.Put(ctx, "/ns/svc/a", []byte("a"), 0) // rev 1
+	m.Put(ctx, "/ns/other/x", []byte("x"), 0)
+	m.Put(ctx, "/ns/svc/b", []byte("b"), 0) // rev 3
+
+	// 从 revision 1 回放，只收到前缀匹配的事件
+	w := m.Watch(ctx, "/ns/svc/", 1)
+	for _, want := range []string{"/ns/svc/a", "/ns/svc/b"} {
+		resp := recv(t, w)
+		if len(resp.Events) != 1 || resp.Events[0].KV.Key != want {
+			t.Fatalf("replayed events = %+v, want put of %s", resp.Events, want)
+		}
+	}
+	m.Delete(ctx, "/ns/svc/a")
+	if resp := recv(t, w); len(resp.Events) != 1 || resp.Events[0].Type != EventDelete {
+		t.Fatalf("live events = %+v, want delete", resp.Events)
+	}
+
+	m.Compact(3)
+	resp := recv(t, m.Watch(ctx, "/ns/svc/", 2))
+	if !errors.Is(resp.Err, ErrCompacted) || resp.CompactRevision != 3 {
+		t.Fatalf("watch from compacted revision = %+v, want ErrCompacted at 3", resp)
+	}
+	// 压缩点之后的 revision 仍然可以 watch
+	resp = recv(t, m.Watch(ctx, "/ns/svc/", 4))
+	if resp.Err != nil || len(resp.Events) != 1 || resp.Revision != 4 {
+		t.Fatalf("watch from revision 4 = %+v, want the delete at 4", resp)
+	}
+}
+
+func TestMemoryCloseEndsWatchAndKeepAlive(t *testing.T) {
+	m := NewMemoryWithClock(newFakeClock().Now)
+	ctx := context.Background()
+
+	lease, _ := m.Grant(ctx, 10)
+	lost, _ := m.KeepAlive(ctx, lease)
+	w := m.Watch(ctx, "/ns/", 0)
+
+	m.Close()
+	waitClosed(t, lost)
+	if resp := recv(t, w); !errors.Is(resp.Err, ErrClosed) {
+		t.Fatalf("watch after Close: err = %v, want ErrClosed", resp.Err)
+	}
+	if _, _, err := m.List(ctx, "/ns/"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("List after Close: err = %v, want ErrClosed", err)
+	}
+}
+
+// 超出保留范围的历史在写入时自动压缩，从被压缩的 revision 开始 watch 返回 ErrCompacted
+func TestMemoryHistoryRetention(t *testing.T) {
+	m := NewMemoryWithClock(newFakeClock().Now)
+	defer m.Close()
+	m.retention = 3
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		m.Put(ctx, "/ns/svc/"+key, []byte(key), 0) // rev 1..5
+	}
+	if len(m.history) != 3 {
+		t.Fatalf("history holds %d revisions, want 3", len(m.history))
+	}
+
+	resp := recv(t, m.Watch(ctx, "/ns/svc/", 1))
+	if !errors.Is(resp.Err, ErrCompacted) || resp.CompactRevision != 2 {
+		t.Fatalf("watch from revision 1 = %+v, want ErrCompacted at 2", resp)
+	}
+	w := m.Watch(ctx, "/ns/svc/", 3)
+	for _, want := range []string{"/ns/svc/c", "/ns/svc/d", "/ns/svc/e"} {
+		if resp := recv(t, w); resp.Err != nil || len(resp.Events) != 1 || resp.Events[0].KV.Key != want {
+			t.Fatalf("replayed %+v, want put of %s", resp, want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSchema = "ns" // 默认的 key 前缀
+	DefaultTTL    = 10   // 默认租约时长（秒）
+)
+
+// ErrDeregistered 注册器已经注销后再调用 Register 时返回
+var ErrDeregistered = errors.New("registry: registrar is deregistered")
+
+// State 注册器的状态
+type State int
+
+const (
+	StateRegistering  State = iota // 正在申请租约并写入 key
+	StateRegistered                // 所有 key 已写入，租约续期中
+	StateLeaseLost                 // 租约丢失（过期或续期失败），即将重新注册
+	StateDeregistered              // 已注销，租约已撤销
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRegistering:
+		return "REGISTERING"
+	case StateRegistered:
+		return "REGISTERED"
+	case StateLeaseLost:
+		return "LEASE_LOST"
+	case StateDeregistered:
+		return "DEREGISTERED"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Event 注册器状态变化事件
+type Event struct {
+	State State
+	Lease LeaseID
+	Err   error
+}
+
+// Config 注册器配置
+type Config struct {
+	Registry Registry // 注册中心，例如 NewEtcd 或 NewMemory
+	Schema   string   // key 前缀，默认 DefaultSchema
+	TTL      int64    // 租约时长（秒），默认 DefaultTTL
+}
+
+// Registrar 把一个进程内的多个服务地址注册到注册中心。
+// 所有 key 共用同一个租约：租约续期失败或过期后会重新申请租约并写回全部 key，
+// Deregister 撤销租约从而一次性删除所有 key。
+type Registrar struct {
+	reg    Registry
+	schema string
+	ttl    int64
+
+	mu      sync.Mutex
+	keys    map[string][]byte // key -> 编码后的 Endpoint
+	lease   LeaseID           // 当前租约，0 表示尚未持有
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+
+	events chan Event
+}
+
+// NewRegistrar 创建注册器
+func NewRegistrar(cfg Config) *Registrar {
+	if cfg.Schema == "" {
+		cfg.Schema = DefaultSchema
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	return &Registrar{
+		reg:    cfg.Registry,
+		schema: cfg.Schema,
+		ttl:    cfg.TTL,
+		keys:   make(map[string][]byte),
+		events: make(chan Event, 16),
+	}
+}
+
+// Key 返回服务地址在注册中心中的 key：/<schema>/<service>/<addr>
+func Key(schema, serviceName, addr string) string {
+	return "/" + schema + "/" + serviceName + "/" + addr
+}
+
+// Events 返回状态变化通道。通道带缓冲，消费不及时的事件会被丢弃；Deregister 之后通道会被关闭。
+func (r *Registrar) Events() <-chan Event {
+	return r.events
+}
+
+// Register 注册一个服务实例，首次调用时启动租约续期循环。
+// 同一地址重复注册会覆盖之前的实例信息。
+func (r *Registrar) Register(ctx context.Context, serviceName string, ep Endpoint) error {
+	key := Key(r.schema, serviceName, ep.Addr)
+	val, err := ep.Marshal()
+	if err != nil {
+		return fmt.Errorf("registry: marshal endpoint %s: %w", ep.Addr, err)
+	}
+
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return ErrDeregistered
+	}
+	r.keys[key] = val
+	lease := r.lease
+	if r.cancel == nil {
+		loopCtx, cancel := context.WithCancel(context.Background())
+		r.cancel = cancel
+		r.done = make(chan struct{})
+		go r.run(loopCtx)
+	}
+	r.mu.Unlock()
+
+	// 还没有租约时由续期循环负责写入
+	if lease == 0 {
+		return nil
+	}
+	if err := r.reg.Put(ctx, key, val, lease); err != nil {
+		return fmt.Errorf("registry: put %s: %w", key, err)
+	}
+	return nil
+}
+
+// Unregister 删除单个服务实例，租约续期循环继续运行，之后可以再次 Register。
+// 租约丢失后重新注册时也不会再写回该实例。
+func (r *Registrar) Unregister(ctx context.Context, serviceName, addr string) error {
+	key := Key(r.schema, serviceName, addr)
+
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return ErrDeregistered
+	}
+	delete(r.keys, key)
+	lease := r.lease
+	r.mu.Unlock()
+
+	if lease == 0 {
+		return nil
+	}
+	if err := r.reg.Delete(ctx, key); err != nil {
+		return fmt.Errorf("registry: delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// Instance 返回绑定到该注册器的单个服务实例
+func (r *Registrar) Instance(serviceName string, ep Endpoint) *Instance {
+	return &Instance{r: r, serviceName: serviceName, ep: ep}
+}
+
+// Instance 可以单独注册和注销的服务实例，例如根据健康状态在注册中心上下线
+type Instance struct {
+	r           *Registrar
+	serviceName string
+	ep          Endpoint
+}
+
+// Register 把实例写入注册中心
+func (i *Instance) Register(ctx context.Context) error {
+	return i.r.Register(ctx, i.serviceName, i.ep)
+}
+
+// Deregister 把实例从注册中心删除，注册器的其它实例不受影响
+func (i *Instance) Deregister(ctx context.Context) error {
+	return i.r.Unregister(ctx, i.serviceName, i.ep.Addr)
+}
+
+// Deregister 停止续期并撤销租约，所有已注册的 key 随之删除
+func (r *Registrar) Deregister(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	r.mu.Lock()
+	lease := r.lease
+	r.lease = 0
+	r.mu.Unlock()
+
+	var err error
+	if lease != 0 {
+		if err = r.reg.Revoke(ctx, lease); err != nil {
+			err = fmt.Errorf("registry: revoke lease %x: %w", lease, err)
+		}
+	}
+	r.emit(Event{State: StateDeregistered, Lease: lease, Err: err})
+	close(r.events)
+	return err
+}
+
+// run 申请租约、写入 key 并续期；租约丢失后退避重试
+func (r *Registrar) run(ctx context.Context) {
+	defer close(r.done)
+
+	backoff := time.Second
+	maxBackoff := time.Duration(r.ttl) * time.Second
+	for {
+		r.emit(Event{State: StateRegistering})
+		lost, lease, err := r.register(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.emit(Event{State: StateRegistering, Err: err})
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = time.Second
+		r.emit(Event{State: StateRegistered, Lease: lease})
+
+		// KeepAlive 的通道在租约过期、续期失败或 ctx 取消时关闭
+		<-lost
+		if ctx.Err() != nil {
+			return
+		}
+
+		r.mu.Lock()
+		if r.lease == lease {
+			r.lease = 0
+		}
+		r.mu.Unlock()
+		r.emit(Event{State: StateLeaseLost, Lease: lease})
+	}
+}
+
+// register 申请新租约并把所有 key 写到该租约下
+func (r *Registrar) register(ctx context.Context) (<-chan struct{}, LeaseID, error) {
+	lease, err := r.reg.Grant(ctx, r.ttl)
+	if err != nil {
+		return nil, 0, fmt.Errorf("registry: grant lease: %w", err)
+	}
+
+	// 持锁写入，保证并发的 Register 不会漏掉新租约
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, val := range r.keys {
+		if err := r.reg.Put(ctx, key, val, lease); err != nil {
+			r.reg.Revoke(context.Background(), lease)
+			return nil, 0, fmt.Errorf("registry: put %s: %w", key, err)
+		}
+	}
+
+	lost, err := r.reg.KeepAlive(ctx, lease)
+	if err != nil {
+		r.reg.Revoke(context.Background(), lease)
+		return nil, 0, fmt.Errorf("registry: keep alive lease %x: %w", lease, err)
+	}
+	r.lease = lease
+	return lost, lease, nil
+}
+
+// emit 非阻塞地发送事件
+func (r *Registrar) emit(ev Event) {
+	select {
+	case r.events <- ev:
+	default:
+	}
+}
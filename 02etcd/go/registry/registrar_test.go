@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitState 读取事件直到出现 state，返回该事件
+func waitState(t *testing.T, events <-chan Event, state State) Event {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed while waiting for %s", state)
+			}
+			if ev.State == state && ev.Err == nil {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", state)
+		}
+	}
+}
+
+func newTestRegistrar(t *testing.T) (*Registrar, *Memory, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock()
+	m := NewMemoryWithClock(clock.Now)
+	t.Cleanup(func() { m.Close() })
+	return NewRegistrar(Config{Registry: m, Schema: "ns", TTL: 10}), m, clock
+}
+
+func TestRegistrarRegisterAndDeregister(t *testing.T) {
+	r, m, clock := newTestRegistrar(t)
+	ctx := context.Background()
+
+	a := Endpoint{Addr: "127.0.0.1:3000", Version: "v1", Zone: "zone-a", Weight: 10}
+	b := Endpoint{Addr: "127.0.0.1:3001"}
+	if err := r.Register(ctx, "hello", a); err != nil {
+		t.Fatalf("Register(a): %v", err)
+	}
+	ev := waitState(t, r.Events(), StateRegistered)
+	// 已经持有租约时 Register 直接写入
+	if err := r.Register(ctx, "world", b); err != nil {
+		t.Fatalf("Register(b): %v", err)
+	}
+
+	got := keys(t, m, "/ns/")
+	if len(got) != 2 {
+		t.Fatalf("keys = %v, want 2 keys", got)
+	}
+	ep, err := Unmarshal([]byte(got[Key("ns", "hello", a.Addr)]))
+	if err != nil || !ep.Equal(a) {
+		t.Fatalf("stored endpoint = %v (err %v), want %v", ep, err, a)
+	}
+
+	// 续期中的租约不会因为时钟推进而过期
+	clock.Advance(time.Minute)
+	m.ExpireLeases()
+	if got := keys(t, m, "/ns/"); len(got) != 2 {
+		t.Fatalf("keys after a minute = %v, want 2 keys", got)
+	}
+
+	if err := r.Deregister(ctx); err != nil {
+		t.Fatalf("Deregister: %v", err)
+	}
+	if got := keys(t, m, "/ns/"); len(got) != 0 {
+		t.Fatalf("keys after Deregister = %v, want none", got)
+	}
+	last := waitState(t, r.Events(), StateDeregistered)
+	if last.Lease != ev.Lease {
+		t.Fatalf("deregistered lease = %x, want %x", last.Lease, ev.Lease)
+	}
+	if _, ok := <-r.Events(); ok {
+		t.Fatal("events not closed after Deregister")
+	}
+	if err := r.Register(ctx, "hello", a); !errors.Is(err, ErrDeregistered) {
+		t.Fatalf("Register after Deregister: err = %v, want ErrDeregistered", err)
+	}
+	if err := r.Deregister(ctx); err != nil {
+		t.Fatalf("second Deregister: %v", err)
+	}
+}
+
+// 租约被撤销后注册器申请新租约并写回全部 key，之前 Unregister 的实例不会被写回
+func TestRegistrarReRegistersAfterLeaseRevoked(t *testing.T) {
+	r, m, _ := newTestRegistrar(t)
+	ctx := context.Background()
+
+	hello := r.Instance("hello", Endpoint{Addr: "127.0.0.1:3000"})
+	world := r.Instance("world", Endpoint{Addr: "127.0.0.1:3001"})
+	hello.Register(ctx)
+	world.Register(ctx)
+	first := waitState(t, r.Events(), StateRegistered)
+	if err := world.Deregister(ctx); err != nil {
+		t.Fatalf("Instance.Deregister: %v", err)
+	}
+	if got := keys(t, m, "/ns/"); len(got) != 1 {
+		t.Fatalf("keys after Instance.Deregister = %v, want 1 key", got)
+	}
+
+	if err := m.Revoke(ctx, first.Lease); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if ev := waitState(t, r.Events(), StateLeaseLost); ev.Lease != first.Lease {
+		t.Fatalf("lost lease = %x, want %x", ev.Lease, first.Lease)
+	}
+	second := waitState(t, r.Events(), StateRegistered)
+	if second.Lease == first.Lease {
+		t.Fatalf("re-registered with the revoked lease %x", first.Lease)
+	}
+
+	got := keys(t, m, "/ns/")
+	if _, ok := got[Key("ns", "hello", "127.0.0.1:3000")]; !ok || len(got) != 1 {
+		t.Fatalf("keys after re-register = %v, want only hello", got)
+	}
+	if err := r.Deregister(ctx); err != nil {
+		t.Fatalf("Deregister: %v", err)
+	}
+}
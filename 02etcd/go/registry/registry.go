@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrLeaseNotFound = errors.New("registry: lease not found")             // 租约不存在或已过期
+	ErrCompacted     = errors.New("registry: revision has been compacted") // watch 的起始 revision 已被压缩
+	ErrClosed        = errors.New("registry: registry is closed")          // 注册中心已关闭
+)
+
+// LeaseID 租约 ID
+type LeaseID int64
+
+// KeyValue 注册中心中的一条记录
+type KeyValue struct {
+	Key         string
+	Value       []byte
+	ModRevision int64
+}
+
+// EventType watch 事件类型
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+// WatchEvent 一次 key 的变化
+type WatchEvent struct {
+	Type EventType
+	KV   KeyValue
+}
+
+// WatchResponse 一批 watch 事件。
+// CompactRevision 不为 0 表示起始 revision 已被压缩，需要重新全量拉取；Err 不为 nil 时 watch 随后结束。
+type WatchResponse struct {
+	Events          []WatchEvent
+	Revision        int64
+	CompactRevision int64
+	Err             error
+}
+
+// Registry 服务注册中心需要提供的能力：带租约的 KV、按前缀读取以及从指定 revision 开始的 watch。
+// etcd 和内存实现都满足该接口，Registrar 和解析器只依赖它。
+type Registry interface {
+	// Grant 申请一个 ttl 秒后过期的租约
+	Grant(ctx context.Context, ttl int64) (LeaseID, error)
+	// KeepAlive 持续为租约续期，返回的通道在租约丢失或 ctx 取消时关闭
+	KeepAlive(ctx context.Context, id LeaseID) (<-chan struct{}, error)
+	// Revoke 撤销租约，租约下的 key 会被删除
+	Revoke(ctx context.Context, id LeaseID) error
+	// Put 写入 key，lease 为 0 时不绑定租约
+	Put(ctx context.Context, key string, value []byte, lease LeaseID) error
+	// Delete 删除 key，key 不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 读取前缀下的全部 key，同时返回读取时的 revision
+	List(ctx context.Context, prefix string) ([]KeyValue, int64, error)
+	// Watch 从 rev 开始监听前缀下的变化，ctx 取消或出错后通道关闭
+	Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse
+}
@@ -10,18 +10,25 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/clin211/grpc/02etcd/registry"
 	proto "github.com/clin211/grpc/02etcd/rpc"
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
+	"github.com/clin211/grpc/mtls"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
 )
 
 var (
-	cli         *clientv3.Client
 	Schema      = "ns"
 	Host        = "127.0.0.1"
 	Port        = 3000             //端口
 	ServiceName = "helloService"   //服务名称
 	EtcdAddr    = "127.0.0.1:2379" //etcd地址
+	Version     = "v1.0.0"         //服务版本
+	Zone        = "zone-a"         //可用区
+	Weight      = int32(10)        //权重
 )
 
 type HelloServer struct {
@@ -40,104 +47,92 @@ func main() {
 		fmt.Println("Listen network err :", err)
 		return
 	}
-	defer func() {
-		err := listener.Close()
-		if err != nil {
-			fmt.Printf("err %s", err)
-		}
-	}()
 
-	srv := grpc.NewServer()
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		fmt.Printf("load tls credentials err : %s\n", err)
+		return
+	}
+	srv := grpc.NewServer(creds)
 	proto.RegisterHelloServiceServer(srv, &HelloServer{})
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
 
-	err = register(EtcdAddr, ServiceName, fmt.Sprintf("%s:%d", Host, Port), 10)
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(EtcdAddr, ","),
+		DialTimeout: 5 * time.Second,
+	})
 	if err != nil {
-		fmt.Printf("register err %s", err)
+		fmt.Printf("connection server err : %s\n", err)
+		return
 	}
+	defer cli.Close()
 
-	//关闭信号处理
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL, syscall.SIGHUP, syscall.SIGQUIT)
+	reg := registry.NewRegistrar(registry.Config{Registry: registry.NewEtcd(cli), Schema: Schema, TTL: 10})
 	go func() {
-		s := <-ch
-		unRegister(ServiceName, fmt.Sprintf("%s:%d", Host, Port))
-		if i, ok := s.(syscall.Signal); ok {
-			os.Exit(int(i))
-		} else {
-			os.Exit(0)
+		for ev := range reg.Events() {
+			fmt.Printf("registry state: %s lease: %x err: %v\n", ev.State, ev.Lease, ev.Err)
 		}
 	}()
+	// 健康状态为 SERVING 时注册到 etcd，变为 NOT_SERVING 时删除，服务发现只返回健康的实例
+	instance := reg.Instance(ServiceName, registry.Endpoint{
+		Addr:    fmt.Sprintf("%s:%d", Host, Port),
+		Version: Version,
+		Zone:    Zone,
+		Weight:  Weight,
+		Labels:  map[string]string{"env": "dev"},
+	})
+	//健康状态同步在关闭时先停止，避免置为 NOT_SERVING 触发的删除和撤销租约同时进行
+	syncCtx, stopSync := context.WithCancel(context.Background())
+	syncDone := make(chan struct{})
+	go func() {
+		defer close(syncDone)
+		health.SyncRegistration(syncCtx, hs, "", instance)
+	}()
 
-	if srv.Serve(listener) != nil {
-		fmt.Println("rpc server err : ", err)
-	}
-}
-
-func register(etcdAddr, serviceName, serverAddr string, ttl int64) error {
-	var err error
-	cli, err = clientv3.New(clientv3.Config{
-		Endpoints:   strings.Split(etcdAddr, ","),
-		DialTimeout: 50 * time.Second,
+	//关闭信号处理：停止同步、置为 NOT_SERVING、撤销租约、等待客户端摘除、GracefulStop，超时后 Stop。
+	//SIGKILL 无法被捕获，不在这里处理
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{srv},
+		Health:  []*health.Server{hs},
+		//等同步循环退出后只撤销一次租约
+		Deregister: func(ctx context.Context) error {
+			stopSync()
+			<-syncDone
+			return reg.Deregister(ctx)
+		},
+		// 关闭时停止监视证书文件
+		OnStop:  []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+		Signals: []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT},
 	})
-	if err != nil {
-		fmt.Printf("connection server err : %s\n", err)
-		return err
-	}
-	//与etcd建立长连接，开启心跳检测
-	ticker := time.NewTicker(time.Second * time.Duration(ttl))
 	go func() {
-		for {
-			resp, err := cli.Get(context.TODO(), getKey(serviceName, serverAddr))
-			if err != nil {
-				fmt.Printf("get server address err : %s", err)
-			} else if resp.Count == 0 { //尚未注册
-				if keepAlive(serviceName, serverAddr, ttl) != nil {
-					fmt.Printf("keepAlive err : %s", err)
-				}
-			}
-			<-ticker.C
-		}
+		<-lc.Draining()
+		stopSync()
 	}()
-	return nil
-}
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
 
-func keepAlive(serviceName, serverAddr string, ttl int64) error {
-	//创建租约
-	leaseResp, err := cli.Grant(context.Background(), ttl)
-	if err != nil {
-		fmt.Printf("create grant err : %s\n", err)
-		return err
-	}
-	//将服务地址注册到etcd中
-	_, err = cli.Put(context.Background(), getKey(serviceName, serverAddr), serverAddr, clientv3.WithLease(leaseResp.ID))
-	if err != nil {
-		fmt.Printf("register service err : %s", err)
-		return err
-	}
-	//建立长连接
-	ch, err := cli.KeepAlive(context.Background(), leaseResp.ID)
-	if err != nil {
-		fmt.Printf("KeepAlive err : %s\n", err)
-		return err
-	}
-	//清空keepAlive返回的channel
+	// 收到 SIGUSR1 时切换健康状态，可以观察实例从 etcd 中下线和重新上线
 	go func() {
-		for {
-			<-ch
+		usr := make(chan os.Signal, 1)
+		signal.Notify(usr, syscall.SIGUSR1)
+		serving := true
+		for range usr {
+			serving = !serving
+			st := healthpb.HealthCheckResponse_NOT_SERVING
+			if serving {
+				st = healthpb.HealthCheckResponse_SERVING
+			}
+			fmt.Printf("health status -> %s\n", st)
+			hs.SetServingStatus("", st)
 		}
 	}()
-	return nil
-}
 
-func unRegister(serviceName, serverAddr string) {
-	if cli != nil {
-		response, err := cli.Delete(context.Background(), getKey(serviceName, serverAddr))
-		if err != nil {
-			fmt.Println("Listen network err :", err, response)
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			fmt.Println("rpc server err : ", err)
 		}
-	}
-}
-
-func getKey(serviceName, serverAddr string) string {
-	return "/" + Schema + "/" + serviceName + "/" + serverAddr
+	}()
+	lc.Wait()
 }
@@ -0,0 +1,127 @@
+// Package balancertest 提供测试负载均衡策略用的 SubConn 和 ClientConn，
+// 不需要真实的连接就能驱动 SubConn 的状态变化并取得均衡器生成的 picker。
+package balancertest
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+)
+
+// SubConn 记录地址和状态监听函数，未实现的方法调用时会 panic
+type SubConn struct {
+	balancer.SubConn
+	Addr     string
+	listener func(balancer.SubConnState)
+
+	mu       sync.Mutex
+	shutdown bool
+}
+
+// NewSubConn 创建只用于 picker 测试的 SubConn，没有状态监听函数
+func NewSubConn(addr string) *SubConn {
+	return &SubConn{Addr: addr}
+}
+
+func (sc *SubConn) Connect() {}
+
+func (sc *SubConn) Shutdown() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.shutdown = true
+}
+
+// IsShutdown 报告均衡器是否关闭了该 SubConn
+func (sc *SubConn) IsShutdown() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.shutdown
+}
+
+// SetState 把状态变化通知给创建 SubConn 的均衡器
+func (sc *SubConn) SetState(state connectivity.State) {
+	sc.listener(balancer.SubConnState{ConnectivityState: state})
+}
+
+func (sc *SubConn) String() string {
+	return sc.Addr
+}
+
+// ClientConn 记录均衡器创建的 SubConn 和最近一次更新的状态
+type ClientConn struct {
+	balancer.ClientConn
+
+	mu       sync.Mutex
+	subConns map[string]*SubConn
+	state    balancer.State
+}
+
+func NewClientConn() *ClientConn {
+	return &ClientConn{subConns: make(map[string]*SubConn)}
+}
+
+func (cc *ClientConn) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	sc := &SubConn{Addr: addrs[0].Addr, listener: opts.StateListener}
+	cc.subConns[sc.Addr] = sc
+	return sc, nil
+}
+
+func (cc *ClientConn) UpdateState(s balancer.State) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.state = s
+}
+
+func (cc *ClientConn) ResolveNow(resolver.ResolveNowOptions) {}
+
+// SubConn 返回为 addr 创建的最新的 SubConn，不存在时返回 nil
+func (cc *ClientConn) SubConn(addr string) *SubConn {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.subConns[addr]
+}
+
+// State 返回最近一次更新的状态
+func (cc *ClientConn) State() balancer.State {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.state
+}
+
+// SetAllStates 把 addrs 对应的 SubConn 都切换到 state
+func (cc *ClientConn) SetAllStates(state connectivity.State, addrs ...string) {
+	for _, addr := range addrs {
+		cc.SubConn(addr).SetState(state)
+	}
+}
+
+// Addrs 把地址字符串转换为 resolver.Address
+func Addrs(addrs ...string) []resolver.Address {
+	out := make([]resolver.Address, 0, len(addrs))
+	for _, addr := range addrs {
+		out = append(out, resolver.Address{Addr: addr})
+	}
+	return out
+}
+
+// Pick 用 p 选择一次，md 不为空时作为请求的元数据，返回选中的地址
+func Pick(p balancer.Picker, md metadata.MD) (string, error) {
+	ctx := context.Background()
+	if md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		return "", err
+	}
+	if res.Done != nil {
+		res.Done(balancer.DoneInfo{})
+	}
+	return res.SubConn.(*SubConn).Addr, nil
+}
@@ -0,0 +1,211 @@
+// Package locality 实现按可用区优先的负载均衡策略。
+//
+// 解析器通过 SetZone 为地址标注可用区，没有标注时使用注册中心实例信息（registry.Endpoint）中的可用区。与客户端同一可用区的后端优先级最高（priority 0），
+// 其它可用区为 priority 1。只要本可用区 READY 的后端占比不低于 minHealthyRatio，请求只在本可用区内轮询；
+// 低于阈值时溢出到所有可用区的 READY 后端；本可用区没有可用后端时完全切换到其它可用区。
+// 当前生效的优先级变化时会输出日志。通过服务配置启用：
+//
+//	{"loadBalancingConfig": [{"zone_aware":{"localZone":"zone-a","minHealthyRatio":0.7}}]}
+package locality
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// Name 负载均衡策略名称
+const Name = "zone_aware"
+
+const defaultMinHealthyRatio = 0.7
+
+var logger = grpclog.Component("locality")
+
+func init() {
+	balancer.Register(&localityBuilder{})
+}
+
+type zoneKey struct{}
+
+// SetZone 设置地址所在的可用区
+func SetZone(addr resolver.Address, zone string) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(zoneKey{}, zone)
+	return addr
+}
+
+// GetZone 返回地址所在的可用区。优先使用 SetZone 设置的值，
+// 其次是基于注册中心的解析器写入的 registry.Endpoint，都没有时返回空字符串。
+func GetZone(addr resolver.Address) string {
+	if zone, ok := addr.BalancerAttributes.Value(zoneKey{}).(string); ok {
+		return zone
+	}
+	ep, _ := registry.EndpointFromAddress(addr)
+	return ep.Zone
+}
+
+// LBConfig 负载均衡配置
+type LBConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	LocalZone string `json:"localZone,omitempty"` // 客户端所在的可用区
+	// 本可用区 READY 后端占比低于该值时溢出，未设置时为 0.7；
+	// 显式设置为 0 表示本可用区只要还有 READY 的后端就不溢出
+	MinHealthyRatio *float64 `json:"minHealthyRatio,omitempty"`
+}
+
+// minHealthyRatio 返回生效的溢出阈值
+func (c *LBConfig) minHealthyRatio() float64 {
+	if c.MinHealthyRatio == nil {
+		return defaultMinHealthyRatio
+	}
+	return *c.MinHealthyRatio
+}
+
+// Priority 当前生效的优先级
+type Priority int
+
+const (
+	PriorityLocal    Priority = iota // 只使用本可用区
+	PrioritySpill                    // 本可用区 + 其它可用区
+	PriorityFailover                 // 本可用区没有可用后端，只使用其它可用区
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLocal:
+		return "LOCAL"
+	case PrioritySpill:
+		return "SPILL"
+	case PriorityFailover:
+		return "FAILOVER"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+type localityBuilder struct{}
+
+func (*localityBuilder) Name() string {
+	return Name
+}
+
+// ParseConfig 解析服务配置中的负载均衡配置
+func (*localityBuilder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &LBConfig{}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("locality: unable to unmarshal LBConfig: %v", err)
+	}
+	if r := cfg.minHealthyRatio(); r < 0 || r > 1 {
+		return nil, fmt.Errorf("locality: minHealthyRatio must be in [0, 1], got %v", r)
+	}
+	return cfg, nil
+}
+
+// Build 复用 base 均衡器管理 SubConn。base 只把 READY 的 SubConn 交给 picker 构建器，
+// 所以在每次解析结果更新时记录各地址的可用区和每个可用区的后端总数，用来计算健康占比。
+func (*localityBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &localityPickerBuilder{
+		cfg:      &LBConfig{},
+		priority: -1,
+	}
+	return &localityBalancer{
+		Balancer: base.NewBalancerBuilder(Name, pb, base.Config{HealthCheck: true}).Build(cc, opts),
+		pb:       pb,
+	}
+}
+
+type localityBalancer struct {
+	balancer.Balancer
+	pb *localityPickerBuilder
+}
+
+func (b *localityBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	zones := make(map[string]string, len(s.ResolverState.Addresses))
+	for _, addr := range s.ResolverState.Addresses {
+		zones[addr.Addr] = GetZone(addr)
+	}
+	cfg, _ := s.BalancerConfig.(*LBConfig)
+	b.pb.update(cfg, zones)
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+type localityPickerBuilder struct {
+	mu       sync.Mutex
+	cfg      *LBConfig
+	zones    map[string]string // addr -> 可用区
+	priority Priority          // 上一次生效的优先级，用于在变化时输出日志
+}
+
+func (pb *localityPickerBuilder) update(cfg *LBConfig, zones map[string]string) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if cfg != nil {
+		pb.cfg = cfg
+	}
+	pb.zones = zones
+}
+
+func (pb *localityPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	localTotal := 0
+	for _, zone := range pb.zones {
+		if zone == pb.cfg.LocalZone {
+			localTotal++
+		}
+	}
+	var local, remote []balancer.SubConn
+	for sc, sci := range info.ReadySCs {
+		zone, ok := pb.zones[sci.Address.Addr]
+		if !ok {
+			zone = GetZone(sci.Address)
+		}
+		if zone == pb.cfg.LocalZone {
+			local = append(local, sc)
+		} else {
+			remote = append(remote, sc)
+		}
+	}
+
+	var priority Priority
+	var scs []balancer.SubConn
+	switch {
+	case len(local) == 0:
+		priority, scs = PriorityFailover, remote
+	case float64(len(local)) >= pb.cfg.minHealthyRatio()*float64(localTotal):
+		priority, scs = PriorityLocal, local
+	default:
+		priority, scs = PrioritySpill, append(local, remote...)
+	}
+	if priority != pb.priority {
+		logger.Infof("locality: active priority changed from %v to %v, local zone %q healthy %d/%d, remote ready %d",
+			pb.priority, priority, pb.cfg.LocalZone, len(local), localTotal, len(remote))
+		pb.priority = priority
+	}
+	return &rrPicker{subConns: scs, next: uint32(rand.IntN(len(scs)))}
+}
+
+// rrPicker 在选中的 SubConn 之间轮询
+type rrPicker struct {
+	subConns []balancer.SubConn
+	next     uint32
+}
+
+func (p *rrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	n := atomic.AddUint32(&p.next, 1)
+	return balancer.PickResult{SubConn: p.subConns[n%uint32(len(p.subConns))]}, nil
+}
@@ -0,0 +1,147 @@
+package locality
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"github.com/clin211/grpc/load-balance/balancer/internal/balancertest"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+var (
+	localAddrs  = []string{"a1", "a2", "a3", "a4"}
+	remoteAddrs = []string{"b1", "b2"}
+)
+
+// newBalancer 构建 localZone 为 zone-a 的均衡器，a1-a4 在 zone-a，b1、b2 在 zone-b，所有后端都是 READY
+func newBalancer(t *testing.T, config string) *balancertest.ClientConn {
+	t.Helper()
+	cfg, err := (&localityBuilder{}).ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("ParseConfig(%s): %v", config, err)
+	}
+	cc := balancertest.NewClientConn()
+	b := balancer.Get(Name).Build(cc, balancer.BuildOptions{})
+	t.Cleanup(b.Close)
+
+	var addrs []resolver.Address
+	for _, addr := range localAddrs {
+		addrs = append(addrs, SetZone(resolver.Address{Addr: addr}, "zone-a"))
+	}
+	// 没有 SetZone 时使用注册中心实例信息中的可用区
+	for _, addr := range remoteAddrs {
+		addrs = append(addrs, registry.Endpoint{Addr: addr, Zone: "zone-b"}.Address())
+	}
+	if err := b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState:  resolver.State{Addresses: addrs},
+		BalancerConfig: cfg,
+	}); err != nil {
+		t.Fatalf("UpdateClientConnState: %v", err)
+	}
+	cc.SetAllStates(connectivity.Ready, append(localAddrs, remoteAddrs...)...)
+	return cc
+}
+
+// backends 多次选择，返回被选中过的后端（已排序）
+func backends(t *testing.T, cc *balancertest.ClientConn) []string {
+	t.Helper()
+	seen := make(map[string]bool)
+	for range 60 {
+		addr, err := balancertest.Pick(cc.State().Picker, nil)
+		if err != nil {
+			t.Fatalf("Pick: %v", err)
+		}
+		seen[addr] = true
+	}
+	var addrs []string
+	for addr := range seen {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+func TestLocalityPriorities(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		down   []string
+		want   []string
+	}{
+		{
+			name:   "local healthy",
+			config: `{"localZone":"zone-a"}`,
+			want:   []string{"a1", "a2", "a3", "a4"},
+		},
+		{
+			name:   "at threshold stays local",
+			config: `{"localZone":"zone-a","minHealthyRatio":0.75}`,
+			down:   []string{"a1"},
+			want:   []string{"a2", "a3", "a4"},
+		},
+		{
+			name:   "below threshold spills",
+			config: `{"localZone":"zone-a","minHealthyRatio":0.75}`,
+			down:   []string{"a1", "a2"},
+			want:   []string{"a3", "a4", "b1", "b2"},
+		},
+		{
+			// 默认阈值 0.7：3/4 不溢出，2/4 溢出
+			name:   "default threshold spills",
+			config: `{"localZone":"zone-a"}`,
+			down:   []string{"a1", "a2"},
+			want:   []string{"a3", "a4", "b1", "b2"},
+		},
+		{
+			name:   "zero ratio never spills",
+			config: `{"localZone":"zone-a","minHealthyRatio":0}`,
+			down:   []string{"a1", "a2", "a3"},
+			want:   []string{"a4"},
+		},
+		{
+			name:   "no ready local fails over",
+			config: `{"localZone":"zone-a","minHealthyRatio":0}`,
+			down:   localAddrs,
+			want:   []string{"b1", "b2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := newBalancer(t, tt.config)
+			cc.SetAllStates(connectivity.TransientFailure, tt.down...)
+			if got := backends(t, cc); !slices.Equal(got, tt.want) {
+				t.Fatalf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 本可用区的后端恢复后流量回到本可用区
+func TestLocalityRecoversFromFailover(t *testing.T) {
+	cc := newBalancer(t, `{"localZone":"zone-a"}`)
+	cc.SetAllStates(connectivity.TransientFailure, localAddrs...)
+	if got := backends(t, cc); !slices.Equal(got, remoteAddrs) {
+		t.Fatalf("failover picked %v, want %v", got, remoteAddrs)
+	}
+
+	cc.SetAllStates(connectivity.Ready, localAddrs...)
+	if got := backends(t, cc); !slices.Equal(got, localAddrs) {
+		t.Fatalf("after recovery picked %v, want %v", got, localAddrs)
+	}
+
+	cc.SetAllStates(connectivity.TransientFailure, append(localAddrs, remoteAddrs...)...)
+	if _, err := balancertest.Pick(cc.State().Picker, nil); err == nil {
+		t.Fatalf("Pick with no READY backend: err = %v, want an error", err)
+	}
+}
+
+func TestParseConfigRejectsRatioOutOfRange(t *testing.T) {
+	for _, config := range []string{`{"minHealthyRatio":-0.1}`, `{"minHealthyRatio":1.5}`} {
+		if _, err := (&localityBuilder{}).ParseConfig([]byte(config)); err == nil {
+			t.Errorf("ParseConfig(%s) succeeded", config)
+		}
+	}
+}
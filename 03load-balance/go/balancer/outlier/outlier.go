@@ -0,0 +1,555 @@
+// Package outlier 实现异常实例摘除（outlier detection）负载均衡策略。
+//
+// 它包裹一个子策略（默认 round_robin），统计每个 SubConn 的调用结果：返回指定错误码或耗时超过
+// latencyThreshold 的调用记为失败。满足以下任一条件的 SubConn 会被暂时摘除：
+//
+//   - 连续失败次数达到 consecutiveFailures.threshold，失败发生后立即摘除；
+//   - 每个统计周期结束时，成功率低于所有实例平均值 stdevFactor/1000 个标准差。
+//
+// 被摘除的 SubConn 在子策略看来处于 TRANSIENT_FAILURE，不会再被选中。摘除时长为
+// baseEjectionTime * 2^(n-1)（n 为连续被摘除的次数），不超过 maxEjectionTime；
+// 同一时刻被摘除的实例不超过 maxEjectionPercent。通过服务配置启用：
+//
+//	{"loadBalancingConfig": [{"outlier_detection":{
+//	    "interval":"10s","baseEjectionTime":"30s","maxEjectionTime":"300s","maxEjectionPercent":50,
+//	    "consecutiveFailures":{"threshold":5},
+//	    "successRate":{"stdevFactor":1900,"minimumHosts":3,"requestVolume":100},
+//	    "childPolicy":[{"round_robin":{}}]}}]}
+package outlier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+)
+
+// Name 负载均衡策略名称
+const Name = "outlier_detection"
+
+var logger = grpclog.Component("outlier")
+
+// errEjected 被摘除的 SubConn 上报给子策略的连接错误
+var errEjected = errors.New("outlier: SubConn ejected")
+
+func init() {
+	balancer.Register(&outlierBuilder{})
+}
+
+// Duration 以 "10s"、"1m30s" 这样的字符串出现在 JSON 中的时长
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ConsecutiveFailures 连续失败摘除算法的配置
+type ConsecutiveFailures struct {
+	Threshold uint32 `json:"threshold,omitempty"` // 连续失败多少次后摘除，默认 5
+}
+
+// SuccessRate 成功率摘除算法的配置
+type SuccessRate struct {
+	StdevFactor           uint32 `json:"stdevFactor,omitempty"`           // 阈值为 平均成功率 - 标准差 * stdevFactor / 1000，默认 1900
+	EnforcementPercentage uint32 `json:"enforcementPercentage,omitempty"` // 满足条件时实际执行摘除的概率（百分比），默认 100
+	MinimumHosts          uint32 `json:"minimumHosts,omitempty"`          // 请求量达标的实例少于该值时不计算，默认 5
+	RequestVolume         uint32 `json:"requestVolume,omitempty"`         // 一个周期内请求数少于该值的实例不参与计算，默认 100
+}
+
+// LBConfig 负载均衡配置
+type LBConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	Interval           Duration `json:"interval,omitempty"`           // 统计周期，默认 10s
+	BaseEjectionTime   Duration `json:"baseEjectionTime,omitempty"`   // 首次摘除时长，默认 30s
+	MaxEjectionTime    Duration `json:"maxEjectionTime,omitempty"`    // 最长摘除时长，默认 300s
+	MaxEjectionPercent uint32   `json:"maxEjectionPercent,omitempty"` // 同时被摘除的实例占比上限（含），默认 10
+	LatencyThreshold   Duration `json:"latencyThreshold,omitempty"`   // 耗时超过该值的调用记为失败，为 0 时不按耗时判断
+	FailureCodes       []string `json:"failureCodes,omitempty"`       // 记为失败的错误码，默认 UNAVAILABLE、DEADLINE_EXCEEDED、INTERNAL、UNKNOWN
+
+	// 两种算法都为空时使用默认配置的连续失败算法
+	ConsecutiveFailures *ConsecutiveFailures `json:"consecutiveFailures,omitempty"`
+	SuccessRate         *SuccessRate         `json:"successRate,omitempty"`
+
+	ChildPolicy []map[string]json.RawMessage `json:"childPolicy,omitempty"` // 子策略，使用第一个已注册的策略，默认 round_robin
+
+	childName    string
+	childConfig  serviceconfig.LoadBalancingConfig
+	failureCodes map[codes.Code]bool
+}
+
+type outlierBuilder struct{}
+
+func (*outlierBuilder) Name() string {
+	return Name
+}
+
+// ParseConfig 解析服务配置中的负载均衡配置并填充默认值
+func (*outlierBuilder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &LBConfig{}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("outlier: unable to unmarshal LBConfig: %v", err)
+	}
+	if err := cfg.setDefaults(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *LBConfig) setDefaults() error {
+	if cfg.Interval <= 0 {
+		cfg.Interval = Duration(10 * time.Second)
+	}
+	if cfg.BaseEjectionTime <= 0 {
+		cfg.BaseEjectionTime = Duration(30 * time.Second)
+	}
+	if cfg.MaxEjectionTime <= 0 {
+		cfg.MaxEjectionTime = Duration(300 * time.Second)
+	}
+	if cfg.MaxEjectionTime < cfg.BaseEjectionTime {
+		cfg.MaxEjectionTime = cfg.BaseEjectionTime
+	}
+	if cfg.MaxEjectionPercent == 0 {
+		cfg.MaxEjectionPercent = 10
+	}
+	if cfg.MaxEjectionPercent > 100 {
+		return fmt.Errorf("outlier: maxEjectionPercent must be in [0, 100], got %d", cfg.MaxEjectionPercent)
+	}
+
+	if len(cfg.FailureCodes) == 0 {
+		cfg.FailureCodes = []string{"UNAVAILABLE", "DEADLINE_EXCEEDED", "INTERNAL", "UNKNOWN"}
+	}
+	cfg.failureCodes = make(map[codes.Code]bool, len(cfg.FailureCodes))
+	for _, name := range cfg.FailureCodes {
+		var c codes.Code
+		if err := c.UnmarshalJSON([]byte(`"` + name + `"`)); err != nil {
+			return fmt.Errorf("outlier: invalid failure code %q: %v", name, err)
+		}
+		cfg.failureCodes[c] = true
+	}
+
+	if cfg.ConsecutiveFailures == nil && cfg.SuccessRate == nil {
+		cfg.ConsecutiveFailures = &ConsecutiveFailures{}
+	}
+	if cf := cfg.ConsecutiveFailures; cf != nil && cf.Threshold == 0 {
+		cf.Threshold = 5
+	}
+	if sr := cfg.SuccessRate; sr != nil {
+		if sr.StdevFactor == 0 {
+			sr.StdevFactor = 1900
+		}
+		if sr.EnforcementPercentage == 0 {
+			sr.EnforcementPercentage = 100
+		}
+		if sr.MinimumHosts == 0 {
+			sr.MinimumHosts = 5
+		}
+		if sr.RequestVolume == 0 {
+			sr.RequestVolume = 100
+		}
+	}
+
+	if len(cfg.ChildPolicy) == 0 {
+		cfg.ChildPolicy = []map[string]json.RawMessage{{roundrobin.Name: json.RawMessage("{}")}}
+	}
+	for _, policy := range cfg.ChildPolicy {
+		for name, raw := range policy {
+			builder := balancer.Get(name)
+			if builder == nil {
+				continue
+			}
+			cfg.childName = name
+			if parser, ok := builder.(balancer.ConfigParser); ok {
+				childCfg, err := parser.ParseConfig(raw)
+				if err != nil {
+					return fmt.Errorf("outlier: invalid config for child policy %q: %v", name, err)
+				}
+				cfg.childConfig = childCfg
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("outlier: no registered child policy in %v", cfg.ChildPolicy)
+}
+
+// Build 创建包裹子策略的均衡器。子策略的 SubConn 通过 ccWrapper 创建，
+// 子策略生成的 picker 被替换成记录调用结果的 picker。
+func (*outlierBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	b := newBalancer(cc, opts, time.Now)
+	go b.run()
+	return b
+}
+
+// newBalancer 创建均衡器但不启动后台协程，摘除和恢复的时间由 now 决定
+func newBalancer(cc balancer.ClientConn, opts balancer.BuildOptions, now func() time.Time) *outlierBalancer {
+	b := &outlierBalancer{
+		cc:       cc,
+		opts:     opts,
+		now:      now,
+		subConns: make(map[*subConn]bool),
+		kick:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	b.cfg.Store(defaultConfig())
+	return b
+}
+
+func defaultConfig() *LBConfig {
+	cfg := &LBConfig{}
+	_ = cfg.setDefaults()
+	return cfg
+}
+
+// outlierBalancer 的 mu 保证对子策略的调用是串行的；子策略在这些调用中会回调 ccWrapper，
+// 所以 ccWrapper 只使用 scMu 和原子变量，不能获取 mu。
+type outlierBalancer struct {
+	cc   balancer.ClientConn
+	opts balancer.BuildOptions
+	now  func() time.Time
+	cfg  atomic.Pointer[LBConfig]
+
+	mu        sync.Mutex
+	child     balancer.Balancer
+	childName string
+	closed    bool
+
+	scMu     sync.Mutex
+	subConns map[*subConn]bool
+
+	kick chan struct{} // 连续失败达到阈值时通知后台协程立即检查
+	done chan struct{}
+}
+
+func (b *outlierBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	cfg, ok := s.BalancerConfig.(*LBConfig)
+	if !ok {
+		cfg = defaultConfig()
+	}
+	b.cfg.Store(cfg)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.child == nil || b.childName != cfg.childName {
+		if b.child != nil {
+			b.child.Close()
+		}
+		b.child = balancer.Get(cfg.childName).Build(&ccWrapper{ClientConn: b.cc, b: b}, b.opts)
+		b.childName = cfg.childName
+	}
+	return b.child.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState:  s.ResolverState,
+		BalancerConfig: cfg.childConfig,
+	})
+}
+
+func (b *outlierBalancer) ResolverError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.child != nil {
+		b.child.ResolverError(err)
+	}
+}
+
+func (b *outlierBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {
+	logger.Errorf("outlier: UpdateSubConnState(%v, %+v) called unexpectedly", sc, state)
+}
+
+func (b *outlierBalancer) ExitIdle() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ei, ok := b.child.(balancer.ExitIdler); ok {
+		ei.ExitIdle()
+	}
+}
+
+func (b *outlierBalancer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	if b.child != nil {
+		b.child.Close()
+	}
+}
+
+// updateSubConnState 处理 SubConn 的真实状态变化。被摘除期间只记录状态，恢复时再交给子策略。
+func (b *outlierBalancer) updateSubConnState(sc *subConn, state balancer.SubConnState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state.ConnectivityState == connectivity.Shutdown {
+		b.scMu.Lock()
+		delete(b.subConns, sc)
+		b.scMu.Unlock()
+	}
+	sc.latest = state
+	if sc.ejected && state.ConnectivityState != connectivity.Shutdown {
+		return
+	}
+	if sc.listener != nil {
+		sc.listener(state)
+	}
+}
+
+// run 每个统计周期执行一次成功率检查和摘除恢复，收到 kick 时立即检查连续失败
+func (b *outlierBalancer) run() {
+	timer := time.NewTimer(time.Duration(b.cfg.Load().Interval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-b.kick:
+			b.evaluate(false)
+		case <-timer.C:
+			b.evaluate(true)
+			timer.Reset(time.Duration(b.cfg.Load().Interval))
+		}
+	}
+}
+
+// evaluate 检查所有 SubConn。interval 为 true 表示一个统计周期结束：
+// 运行成功率算法、恢复摘除时间已到的 SubConn，并清空本周期的计数。
+func (b *outlierBalancer) evaluate(interval bool) {
+	cfg := b.cfg.Load()
+	now := b.now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.scMu.Lock()
+	scs := make([]*subConn, 0, len(b.subConns))
+	for sc := range b.subConns {
+		scs = append(scs, sc)
+	}
+	b.scMu.Unlock()
+
+	ejected := 0
+	for _, sc := range scs {
+		if sc.ejected {
+			ejected++
+		}
+	}
+	eject := func(sc *subConn, reason string) {
+		// 摘除之后的占比也不能超过 maxEjectionPercent
+		if sc.ejected || uint32((ejected+1)*100) > cfg.MaxEjectionPercent*uint32(len(scs)) {
+			return
+		}
+		ejected++
+		sc.ejected = true
+		sc.ejectedAt = now
+		sc.ejections++
+		logger.Infof("outlier: ejecting %s for %v (%s, ejection #%d)", sc.addr, sc.ejectionTime(cfg), reason, sc.ejections)
+		if sc.listener != nil {
+			sc.listener(balancer.SubConnState{ConnectivityState: connectivity.TransientFailure, ConnectionError: errEjected})
+		}
+	}
+
+	if cf := cfg.ConsecutiveFailures; cf != nil {
+		for _, sc := range scs {
+			if n := sc.consecutive.Load(); n >= int64(cf.Threshold) {
+				sc.consecutive.Store(0)
+				eject(sc, fmt.Sprintf("%d consecutive failures", n))
+			}
+		}
+	}
+	if !interval {
+		return
+	}
+
+	// 本周期的计数，清零后进入下一个周期
+	successes := make(map[*subConn]int64, len(scs))
+	failures := make(map[*subConn]int64, len(scs))
+	for _, sc := range scs {
+		successes[sc] = sc.successes.Swap(0)
+		failures[sc] = sc.failures.Swap(0)
+	}
+
+	if sr := cfg.SuccessRate; sr != nil {
+		var candidates []*subConn
+		rates := make(map[*subConn]float64)
+		var sum float64
+		for _, sc := range scs {
+			total := successes[sc] + failures[sc]
+			if sc.ejected || total < int64(sr.RequestVolume) {
+				continue
+			}
+			candidates = append(candidates, sc)
+			rates[sc] = float64(successes[sc]) / float64(total)
+			sum += rates[sc]
+		}
+		if len(candidates) >= int(sr.MinimumHosts) {
+			mean := sum / float64(len(candidates))
+			var variance float64
+			for _, sc := range candidates {
+				variance += (rates[sc] - mean) * (rates[sc] - mean)
+			}
+			stdev := math.Sqrt(variance / float64(len(candidates)))
+			threshold := mean - stdev*float64(sr.StdevFactor)/1000
+			for _, sc := range candidates {
+				if rates[sc] < threshold && rand.Uint32N(100) < sr.EnforcementPercentage {
+					eject(sc, fmt.Sprintf("success rate %.2f below %.2f", rates[sc], threshold))
+				}
+			}
+		}
+	}
+
+	for _, sc := range scs {
+		switch {
+		case sc.ejected && now.Sub(sc.ejectedAt) >= sc.ejectionTime(cfg):
+			sc.ejected = false
+			sc.consecutive.Store(0)
+			logger.Infof("outlier: unejecting %s", sc.addr)
+			if sc.listener != nil {
+				sc.listener(sc.latest)
+			}
+		case !sc.ejected && sc.ejections > 0:
+			// 一个周期内没有再被摘除，摘除次数逐步衰减，下次摘除的时长随之缩短
+			sc.ejections--
+		}
+	}
+}
+
+// ccWrapper 交给子策略的 ClientConn，拦截 SubConn 的创建和 picker 的更新
+type ccWrapper struct {
+	balancer.ClientConn
+	b *outlierBalancer
+}
+
+func (w *ccWrapper) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	sc := &subConn{listener: opts.StateListener, b: w.b}
+	if len(addrs) > 0 {
+		sc.addr = addrs[0].Addr
+	}
+	opts.StateListener = func(state balancer.SubConnState) {
+		w.b.updateSubConnState(sc, state)
+	}
+	inner, err := w.ClientConn.NewSubConn(addrs, opts)
+	if err != nil {
+		return nil, err
+	}
+	sc.SubConn = inner
+
+	w.b.scMu.Lock()
+	w.b.subConns[sc] = true
+	w.b.scMu.Unlock()
+	return sc, nil
+}
+
+func (w *ccWrapper) RemoveSubConn(sc balancer.SubConn) {
+	sc.Shutdown()
+}
+
+func (w *ccWrapper) UpdateAddresses(sc balancer.SubConn, addrs []resolver.Address) {
+	if s, ok := sc.(*subConn); ok {
+		sc = s.SubConn
+	}
+	w.ClientConn.UpdateAddresses(sc, addrs)
+}
+
+func (w *ccWrapper) UpdateState(s balancer.State) {
+	if s.Picker != nil {
+		s.Picker = &picker{child: s.Picker, b: w.b}
+	}
+	w.ClientConn.UpdateState(s)
+}
+
+// subConn 包裹真实的 SubConn 并记录调用结果。ejected、ejectedAt、ejections、latest
+// 和 listener 只在持有 outlierBalancer.mu 时访问。
+type subConn struct {
+	balancer.SubConn
+	addr string
+	b    *outlierBalancer
+
+	successes   atomic.Int64
+	failures    atomic.Int64
+	consecutive atomic.Int64
+
+	listener  func(balancer.SubConnState)
+	latest    balancer.SubConnState
+	ejected   bool
+	ejectedAt time.Time
+	ejections int
+}
+
+// ejectionTime 本次摘除的时长：baseEjectionTime 按摘除次数指数增长，不超过 maxEjectionTime
+func (sc *subConn) ejectionTime(cfg *LBConfig) time.Duration {
+	d := time.Duration(cfg.BaseEjectionTime)
+	for i := 1; i < sc.ejections && d < time.Duration(cfg.MaxEjectionTime); i++ {
+		d *= 2
+	}
+	return min(d, time.Duration(cfg.MaxEjectionTime))
+}
+
+func (sc *subConn) record(err error, latency time.Duration) {
+	cfg := sc.b.cfg.Load()
+	failed := err != nil && cfg.failureCodes[status.Code(err)]
+	if cfg.LatencyThreshold > 0 && latency > time.Duration(cfg.LatencyThreshold) {
+		failed = true
+	}
+	if !failed {
+		sc.successes.Add(1)
+		sc.consecutive.Store(0)
+		return
+	}
+	sc.failures.Add(1)
+	if cf := cfg.ConsecutiveFailures; cf != nil && sc.consecutive.Add(1) == int64(cf.Threshold) {
+		select {
+		case sc.b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// picker 把子策略选出的 SubConn 换回真实的 SubConn，并在调用结束时记录结果
+type picker struct {
+	child balancer.Picker
+	b     *outlierBalancer
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	res, err := p.child.Pick(info)
+	if err != nil {
+		return res, err
+	}
+	sc, ok := res.SubConn.(*subConn)
+	if !ok {
+		return res, nil
+	}
+	start := time.Now()
+	done := res.Done
+	res.SubConn = sc.SubConn
+	res.Done = func(di balancer.DoneInfo) {
+		sc.record(di.Err, time.Since(start))
+		if done != nil {
+			done(di)
+		}
+	}
+	return res, nil
+}
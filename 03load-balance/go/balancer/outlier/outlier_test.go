@@ -0,0 +1,347 @@
+package outlier
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clin211/grpc/load-balance/balancer/internal/balancertest"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var errUnavailable = status.Error(codes.Unavailable, "unavailable")
+
+// testEnv 不启动后台协程的均衡器，测试通过 evaluate 手动推进统计周期
+type testEnv struct {
+	t     *testing.T
+	b     *outlierBalancer
+	cc    *balancertest.ClientConn
+	clock *fakeClock
+}
+
+func newTestEnv(t *testing.T, config string, addrs ...string) *testEnv {
+	t.Helper()
+	cfg, err := (&outlierBuilder{}).ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("ParseConfig(%s): %v", config, err)
+	}
+	e := &testEnv{t: t, cc: balancertest.NewClientConn(), clock: &fakeClock{now: time.Unix(1700000000, 0)}}
+	e.b = newBalancer(e.cc, balancer.BuildOptions{}, e.clock.Now)
+	t.Cleanup(e.b.Close)
+	if err := e.b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState:  resolver.State{Addresses: balancertest.Addrs(addrs...)},
+		BalancerConfig: cfg,
+	}); err != nil {
+		t.Fatalf("UpdateClientConnState: %v", err)
+	}
+	e.cc.SetAllStates(connectivity.Ready, addrs...)
+	return e
+}
+
+func (e *testEnv) subConn(addr string) *subConn {
+	e.t.Helper()
+	e.b.scMu.Lock()
+	defer e.b.scMu.Unlock()
+	for sc := range e.b.subConns {
+		if sc.addr == addr {
+			return sc
+		}
+	}
+	e.t.Fatalf("no SubConn for %s", addr)
+	return nil
+}
+
+// record 为 addr 记录 successes 次成功和 failures 次失败
+func (e *testEnv) record(addr string, successes, failures int) {
+	sc := e.subConn(addr)
+	for range successes {
+		sc.record(nil, 0)
+	}
+	for range failures {
+		sc.record(errUnavailable, 0)
+	}
+}
+
+// ejected 返回当前被摘除的地址（已排序）
+func (e *testEnv) ejected() []string {
+	e.b.mu.Lock()
+	defer e.b.mu.Unlock()
+	var addrs []string
+	for sc := range e.b.subConns {
+		if sc.ejected {
+			addrs = append(addrs, sc.addr)
+		}
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+func (e *testEnv) ejections(addr string) int {
+	sc := e.subConn(addr)
+	e.b.mu.Lock()
+	defer e.b.mu.Unlock()
+	return sc.ejections
+}
+
+// picked 多次选择，返回被选中过的地址（已排序）
+func (e *testEnv) picked() []string {
+	e.t.Helper()
+	seen := make(map[string]bool)
+	for range 30 {
+		addr, err := balancertest.Pick(e.cc.State().Picker, nil)
+		if err != nil {
+			e.t.Fatalf("Pick: %v", err)
+		}
+		seen[addr] = true
+	}
+	var addrs []string
+	for addr := range seen {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  func(e *testEnv)
+		ejected []string
+	}{
+		{
+			name:    "threshold reached",
+			record:  func(e *testEnv) { e.record("a", 0, 3) },
+			ejected: []string{"a"},
+		},
+		{
+			name:   "below threshold",
+			record: func(e *testEnv) { e.record("a", 0, 2) },
+		},
+		{
+			name: "success resets the streak",
+			record: func(e *testEnv) {
+				e.record("a", 0, 2)
+				e.record("a", 1, 2)
+			},
+		},
+		{
+			name: "codes outside failureCodes are successes",
+			record: func(e *testEnv) {
+				for range 5 {
+					e.subConn("a").record(status.Error(codes.NotFound, "not found"), 0)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, `{"maxEjectionPercent":100,"consecutiveFailures":{"threshold":3}}`, "a", "b", "c")
+			tt.record(e)
+			e.b.evaluate(false)
+			if got := e.ejected(); !slices.Equal(got, tt.ejected) {
+				t.Fatalf("ejected %v, want %v", got, tt.ejected)
+			}
+		})
+	}
+}
+
+// 被摘除的 SubConn 不再被选中
+func TestEjectedSubConnIsNotPicked(t *testing.T) {
+	e := newTestEnv(t, `{"maxEjectionPercent":100,"consecutiveFailures":{"threshold":1}}`, "a", "b", "c")
+	e.record("a", 0, 1)
+	e.b.evaluate(false)
+	if got, want := e.picked(), []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("picked %v while a is ejected, want %v", got, want)
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	type result struct{ successes, failures int }
+	healthy := result{successes: 20}
+	spread := map[string]result{"a": healthy, "b": {19, 1}, "c": {18, 2}, "d": healthy, "e": {16, 4}}
+	tests := []struct {
+		name    string
+		config  string
+		results map[string]result
+		ejected []string
+	}{
+		{
+			// 平均成功率 0.9，标准差 0.2，阈值 0.9 - 0.2*1 = 0.7
+			name:    "below mean minus stdev",
+			config:  `{"maxEjectionPercent":100,"successRate":{"stdevFactor":1000,"minimumHosts":3,"requestVolume":10}}`,
+			results: map[string]result{"a": healthy, "b": healthy, "c": healthy, "d": healthy, "e": {10, 10}},
+			ejected: []string{"e"},
+		},
+		{
+			name:    "not enough hosts",
+			config:  `{"maxEjectionPercent":100,"successRate":{"stdevFactor":1000,"minimumHosts":6,"requestVolume":10}}`,
+			results: map[string]result{"a": healthy, "b": healthy, "c": healthy, "d": healthy, "e": {10, 10}},
+		},
+		{
+			// e 的请求量不足，不参与计算
+			name:    "request volume not met",
+			config:  `{"maxEjectionPercent":100,"successRate":{"stdevFactor":1000,"minimumHosts":3,"requestVolume":10}}`,
+			results: map[string]result{"a": healthy, "b": healthy, "c": healthy, "d": healthy, "e": {1, 8}},
+		},
+		{
+			// 成功率 1、0.95、0.9、1、0.8：平均 0.93，标准差约 0.075，阈值约 0.855
+			name:    "spread rates",
+			config:  `{"maxEjectionPercent":100,"successRate":{"stdevFactor":1000,"minimumHosts":3,"requestVolume":10}}`,
+			results: spread,
+			ejected: []string{"e"},
+		},
+		{
+			// 默认因子 1.9 时阈值约 0.79，0.8 不被摘除
+			name:    "within default stdev factor",
+			config:  `{"maxEjectionPercent":100,"successRate":{"minimumHosts":3,"requestVolume":10}}`,
+			results: spread,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, tt.config, "a", "b", "c", "d", "e")
+			for addr, r := range tt.results {
+				e.record(addr, r.successes, r.failures)
+			}
+			// 周期中途只检查连续失败
+			e.b.evaluate(false)
+			if got := e.ejected(); len(got) != 0 {
+				t.Fatalf("ejected %v before the interval ended", got)
+			}
+			e.b.evaluate(true)
+			if got := e.ejected(); !slices.Equal(got, tt.ejected) {
+				t.Fatalf("ejected %v, want %v", got, tt.ejected)
+			}
+		})
+	}
+}
+
+func TestEjectionTimeBackoff(t *testing.T) {
+	cfg := &LBConfig{BaseEjectionTime: Duration(10 * time.Second), MaxEjectionTime: Duration(35 * time.Second)}
+	tests := []struct {
+		ejections int
+		want      time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 35 * time.Second},
+		{4, 35 * time.Second},
+		{100, 35 * time.Second},
+	}
+	for _, tt := range tests {
+		sc := &subConn{ejections: tt.ejections}
+		if got := sc.ejectionTime(cfg); got != tt.want {
+			t.Errorf("ejectionTime after %d ejections = %v, want %v", tt.ejections, got, tt.want)
+		}
+	}
+}
+
+// 摘除时长按次数翻倍，到期后在周期结束时恢复；之后每个没有被摘除的周期摘除次数减一
+func TestEjectionTimeline(t *testing.T) {
+	e := newTestEnv(t, `{"interval":"1s","baseEjectionTime":"10s","maxEjectionTime":"35s","maxEjectionPercent":100,"consecutiveFailures":{"threshold":1}}`, "a", "b")
+	// expectEjected 推进 d 后结束一个周期，检查 a 是否仍被摘除
+	expectEjected := func(d time.Duration, want bool) {
+		t.Helper()
+		e.clock.Advance(d)
+		e.b.evaluate(true)
+		if got := len(e.ejected()) == 1; got != want {
+			t.Fatalf("ejected = %v, want %v", got, want)
+		}
+	}
+	eject := func(wantEjections int) {
+		t.Helper()
+		e.record("a", 0, 1)
+		e.b.evaluate(false)
+		if got := e.ejections("a"); got != wantEjections {
+			t.Fatalf("ejections = %d, want %d", got, wantEjections)
+		}
+	}
+
+	eject(1)
+	expectEjected(9*time.Second, true)
+	expectEjected(time.Second, false)
+	if got, want := e.picked(), []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("picked %v after uneject, want %v", got, want)
+	}
+
+	eject(2)
+	expectEjected(19*time.Second, true)
+	expectEjected(time.Second, false)
+
+	eject(3)
+	expectEjected(34*time.Second, true)
+	expectEjected(time.Second, false)
+
+	// 恢复之后的周期里摘除次数逐步衰减
+	for want := 2; want >= 0; want-- {
+		expectEjected(time.Second, false)
+		if got := e.ejections("a"); got != want {
+			t.Fatalf("ejections after decay = %d, want %d", got, want)
+		}
+	}
+	expectEjected(time.Second, false)
+	if got := e.ejections("a"); got != 0 {
+		t.Fatalf("ejections went below zero: %d", got)
+	}
+
+	// 衰减到 0 后再次摘除，时长回到 baseEjectionTime
+	eject(1)
+	expectEjected(10*time.Second, false)
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		percent int
+		want    int
+	}{
+		{percent: 10, want: 0}, // 摘除一个就是 20%，超过上限
+		{percent: 20, want: 1},
+		{percent: 50, want: 2},
+		{percent: 100, want: 5},
+	}
+	for _, tt := range tests {
+		config := fmt.Sprintf(`{"maxEjectionPercent":%d,"consecutiveFailures":{"threshold":1}}`, tt.percent)
+		e := newTestEnv(t, config, "a", "b", "c", "d", "e")
+		for _, addr := range []string{"a", "b", "c", "d", "e"} {
+			e.record(addr, 0, 1)
+		}
+		e.b.evaluate(false)
+		if got := len(e.ejected()); got != tt.want {
+			t.Errorf("maxEjectionPercent %d: %d of 5 ejected, want %d", tt.percent, got, tt.want)
+		}
+		// 后续周期里其它实例继续失败也不会突破上限
+		for range 3 {
+			for _, addr := range []string{"a", "b", "c", "d", "e"} {
+				e.record(addr, 0, 1)
+			}
+			e.b.evaluate(false)
+			if got := len(e.ejected()); got*100 > tt.percent*5 {
+				t.Fatalf("maxEjectionPercent %d: %d of 5 ejected", tt.percent, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package p2c 实现 power of two choices 负载均衡策略：
+// 每次随机选出两个 READY 的 SubConn，把请求发给正在处理的请求（in-flight）更少的那个。
+//
+// in-flight 计数在 Pick 时加一，在 PickResult.Done 回调（RPC 结束）时减一，
+// 因此处理慢的后端会积压更多请求，从而自动分到更少的新请求。通过服务配置启用：
+//
+//	{"loadBalancingConfig": [{"p2c":{}}]}
+package p2c
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/grpclog"
+)
+
+// Name 负载均衡策略名称
+const Name = "p2c"
+
+var logger = grpclog.Component("p2c")
+
+func init() {
+	balancer.Register(&p2cBuilder{})
+}
+
+type p2cBuilder struct{}
+
+func (*p2cBuilder) Name() string {
+	return Name
+}
+
+// Build 复用 base 均衡器管理 SubConn。每个均衡器实例有自己的 picker 构建器，
+// in-flight 计数保存在构建器中，picker 重建时不会丢失。
+func (*p2cBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &p2cPickerBuilder{inflight: make(map[balancer.SubConn]*atomic.Int64)}
+	return base.NewBalancerBuilder(Name, pb, base.Config{HealthCheck: true}).Build(cc, opts)
+}
+
+type p2cPickerBuilder struct {
+	mu       sync.Mutex
+	inflight map[balancer.SubConn]*atomic.Int64
+}
+
+func (pb *p2cPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	// 保留仍然 READY 的 SubConn 的计数，以及还有 RPC 在进行中的计数：
+	// SubConn 短暂离开 READY 再恢复时继续使用原来的计数，不会因为计数归零而集中分到一批新请求。
+	// 进行中的 RPC 持有计数器的指针，Done 时仍然能正确减一。
+	inflight := make(map[balancer.SubConn]*atomic.Int64, len(info.ReadySCs))
+	for sc, n := range pb.inflight {
+		if n.Load() > 0 {
+			inflight[sc] = n
+		}
+	}
+	p := &p2cPicker{subConns: make([]*loadedSubConn, 0, len(info.ReadySCs))}
+	for sc := range info.ReadySCs {
+		n, ok := inflight[sc]
+		if !ok {
+			n = new(atomic.Int64)
+		}
+		inflight[sc] = n
+		p.subConns = append(p.subConns, &loadedSubConn{sc: sc, inflight: n})
+	}
+	pb.inflight = inflight
+	logger.Infof("p2cPicker: built with %d ready SubConns", len(p.subConns))
+	return p
+}
+
+type loadedSubConn struct {
+	sc       balancer.SubConn
+	inflight *atomic.Int64
+}
+
+type p2cPicker struct {
+	subConns []*loadedSubConn
+}
+
+func (p *p2cPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	chosen := p.subConns[0]
+	if n := len(p.subConns); n > 1 {
+		// 选出两个不同的下标
+		i := rand.IntN(n)
+		j := rand.IntN(n - 1)
+		if j >= i {
+			j++
+		}
+		a, b := p.subConns[i], p.subConns[j]
+		chosen = a
+		if b.inflight.Load() < a.inflight.Load() {
+			chosen = b
+		}
+	}
+
+	chosen.inflight.Add(1)
+	return balancer.PickResult{
+		SubConn: chosen.sc,
+		Done: func(balancer.DoneInfo) {
+			chosen.inflight.Add(-1)
+		},
+	}, nil
+}
@@ -0,0 +1,221 @@
+package p2c
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clin211/grpc/load-balance/balancer/internal/balancertest"
+	lb "github.com/clin211/grpc/load-balance/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+func buildPicker(pb *p2cPickerBuilder, scs ...*balancertest.SubConn) balancer.Picker {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for _, sc := range scs {
+		info.ReadySCs[sc] = base.SubConnInfo{Address: resolver.Address{Addr: sc.Addr}}
+	}
+	return pb.Build(info)
+}
+
+func newPickerBuilder() *p2cPickerBuilder {
+	return &p2cPickerBuilder{inflight: make(map[balancer.SubConn]*atomic.Int64)}
+}
+
+// 两个 SubConn 时每次都比较这两个，新请求总是发给 in-flight 更少的那个
+func TestPickerPrefersLessLoaded(t *testing.T) {
+	a, b := balancertest.NewSubConn("a"), balancertest.NewSubConn("b")
+	p := buildPicker(newPickerBuilder(), a, b)
+	pick := func() balancer.PickResult {
+		t.Helper()
+		res, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("Pick: %v", err)
+		}
+		return res
+	}
+
+	dones := make(map[balancer.SubConn][]func(balancer.DoneInfo))
+	for range 10 {
+		res := pick()
+		dones[res.SubConn] = append(dones[res.SubConn], res.Done)
+	}
+	if len(dones[a]) != 5 || len(dones[b]) != 5 {
+		t.Fatalf("10 outstanding picks split %d/%d, want 5/5", len(dones[a]), len(dones[b]))
+	}
+
+	// a 上的 3 个请求结束后，接下来的 3 个请求都发给 a
+	for _, done := range dones[a][:3] {
+		done(balancer.DoneInfo{})
+	}
+	for i := range 3 {
+		if res := pick(); res.SubConn != a {
+			t.Fatalf("pick %d went to %v, want the less loaded a", i, res.SubConn)
+		}
+	}
+}
+
+// SubConn 短暂离开 READY 时保留仍在进行中的计数，恢复后不会把它当成空闲节点
+func TestPickerKeepsInflightAcrossReconnect(t *testing.T) {
+	pb := newPickerBuilder()
+	a, b := balancertest.NewSubConn("a"), balancertest.NewSubConn("b")
+	p := buildPicker(pb, a)
+	for range 3 {
+		p.Pick(balancer.PickInfo{Ctx: context.Background()}) // 不调用 Done，保持进行中
+	}
+
+	buildPicker(pb, b) // a 离开 READY
+	p = buildPicker(pb, a, b)
+	for i := range 3 {
+		res, _ := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if res.SubConn != b {
+			t.Fatalf("pick %d went to %v with 3 RPCs still in flight on a", i, res.SubConn)
+		}
+	}
+}
+
+// BenchmarkSlowBackend 对比 round_robin 和 p2c 在某个后端变慢时的表现：
+// 进程内启动三个后端，第一个每次请求额外等待 slowDelay，以 benchConcurrency 的并发压测，
+// 报告延迟的 p50、p99 以及慢节点分到的请求占比。
+//
+//	go test -run '^$' -bench SlowBackend ./balancer/p2c
+func BenchmarkSlowBackend(b *testing.B) {
+	addrs := startBackends(b)
+	for _, policy := range []string{"round_robin", Name} {
+		b.Run(policy, func(b *testing.B) {
+			c := dial(b, policy, addrs)
+			latencies, perAddr := runLoad(b, c)
+			b.ReportMetric(float64(percentile(latencies, 0.5))/float64(time.Millisecond), "p50-ms")
+			b.ReportMetric(float64(percentile(latencies, 0.99))/float64(time.Millisecond), "p99-ms")
+			b.ReportMetric(100*float64(perAddr[addrs[0]])/float64(len(latencies)), "slow-%")
+		})
+	}
+}
+
+const (
+	fastDelay        = 2 * time.Millisecond
+	slowDelay        = 50 * time.Millisecond
+	benchConcurrency = 32
+)
+
+type helloServer struct {
+	lb.UnimplementedHelloServiceServer
+	addr  string
+	delay time.Duration
+}
+
+func (s *helloServer) SayHello(ctx context.Context, req *lb.HelloRequest) (*lb.HelloResponse, error) {
+	time.Sleep(s.delay)
+	return &lb.HelloResponse{Message: s.addr}, nil
+}
+
+// startBackends 启动三个后端，第一个是慢节点
+func startBackends(b *testing.B) []string {
+	b.Helper()
+	var addrs []string
+	for i := range 3 {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			b.Fatalf("listen: %v", err)
+		}
+		delay := fastDelay
+		if i == 0 {
+			delay = slowDelay
+		}
+		s := grpc.NewServer()
+		lb.RegisterHelloServiceServer(s, &helloServer{addr: lis.Addr().String(), delay: delay})
+		go s.Serve(lis)
+		b.Cleanup(s.Stop)
+		addrs = append(addrs, lis.Addr().String())
+	}
+	return addrs
+}
+
+// dial 使用 policy 连接 addrs，并在所有后端都处理过请求后返回，避免计时开始时只有部分 SubConn 就绪
+func dial(b *testing.B, policy string, addrs []string) lb.HelloServiceClient {
+	b.Helper()
+	r := manual.NewBuilderWithScheme("bench")
+	var state resolver.State
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r.InitialState(state)
+	conn, err := grpc.NewClient(r.Scheme()+":///hello",
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q:{}}]}`, policy)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		b.Fatalf("NewClient: %v", err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	c := lb.NewHelloServiceClient(conn)
+
+	// 串行预热时所有后端的 in-flight 都为 0，p2c 退化为均匀随机，每个后端都会被选中
+	seen := make(map[string]bool)
+	deadline := time.Now().Add(10 * time.Second)
+	for len(seen) < len(addrs) {
+		if time.Now().After(deadline) {
+			b.Fatalf("only %d of %d backends became ready", len(seen), len(addrs))
+		}
+		resp, err := c.SayHello(context.Background(), &lb.HelloRequest{Name: "warmup"}, grpc.WaitForReady(true))
+		if err != nil {
+			b.Fatalf("warmup: %v", err)
+		}
+		seen[resp.GetMessage()] = true
+	}
+	return c
+}
+
+// runLoad 以 benchConcurrency 的并发发出 b.N 个请求，返回排好序的延迟和各后端分到的请求数
+func runLoad(b *testing.B, c lb.HelloServiceClient) ([]time.Duration, map[string]int) {
+	var (
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, b.N)
+		perAddr   = make(map[string]int)
+		wg        sync.WaitGroup
+	)
+	jobs := make(chan struct{})
+	b.ResetTimer()
+	for range benchConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				begin := time.Now()
+				resp, err := c.SayHello(context.Background(), &lb.HelloRequest{Name: "bench"})
+				if err != nil {
+					b.Errorf("SayHello: %v", err)
+					continue
+				}
+				d := time.Since(begin)
+				mu.Lock()
+				latencies = append(latencies, d)
+				perAddr[resp.GetMessage()]++
+				mu.Unlock()
+			}
+		}()
+	}
+	for range b.N {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	b.StopTimer()
+	slices.Sort(latencies)
+	return latencies, perAddr
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	return latencies[int(float64(len(latencies)-1)*p)]
+}
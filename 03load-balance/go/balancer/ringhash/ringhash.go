@@ -0,0 +1,306 @@
+// Package ringhash 实现基于一致性哈希环的负载均衡策略，用于会话粘滞：
+// 按请求元数据中某个 key（例如 x-user-id、x-session-id）的值计算哈希，同一个值总是落到同一个后端。
+//
+// 每个后端在环上放置若干虚拟节点，后端加入或离开时只有相邻区间的 key 会被重新映射。
+// 哈希 key 和虚拟节点数通过负载均衡配置指定：
+//
+//	{"loadBalancingConfig": [{"consistent_hash":{"hashKey":"x-user-id","virtualNodes":160}}]}
+//
+// 请求中没有该元数据时随机选择一个 READY 的后端。
+package ringhash
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// Name 负载均衡策略名称
+const Name = "consistent_hash"
+
+const (
+	defaultHashKey      = "x-user-id"
+	defaultVirtualNodes = 160
+)
+
+var logger = grpclog.Component("ringhash")
+
+func init() {
+	balancer.Register(&ringHashBuilder{})
+}
+
+// LBConfig 负载均衡配置
+type LBConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	HashKey      string `json:"hashKey,omitempty"`      // 用于计算哈希的元数据 key，默认 x-user-id
+	VirtualNodes int    `json:"virtualNodes,omitempty"` // 每个后端的虚拟节点数，默认 160
+}
+
+type ringHashBuilder struct{}
+
+func (*ringHashBuilder) Name() string {
+	return Name
+}
+
+// ParseConfig 解析服务配置中的负载均衡配置
+func (*ringHashBuilder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &LBConfig{}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("ringhash: unable to unmarshal LBConfig: %v", err)
+	}
+	if cfg.HashKey == "" {
+		cfg.HashKey = defaultHashKey
+	}
+	cfg.HashKey = strings.ToLower(cfg.HashKey)
+	if cfg.VirtualNodes < 0 {
+		return nil, fmt.Errorf("ringhash: virtualNodes must not be negative, got %d", cfg.VirtualNodes)
+	}
+	if cfg.VirtualNodes == 0 {
+		cfg.VirtualNodes = defaultVirtualNodes
+	}
+	return cfg, nil
+}
+
+// Build 创建一致性哈希均衡器。哈希环由所有后端构成，只在地址列表或配置变化时重建；
+// SubConn 的状态变化只重新生成 picker，非 READY 的后端留在环上，选择时跳过。
+// 后端短暂断开（例如经过 CONNECTING）时只有落在它上面的 key 临时顺延到环上的下一个后端，
+// 恢复 READY 后回到原来的后端，其它 key 不受影响。
+func (*ringHashBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	b := &ringHashBalancer{
+		cc:       cc,
+		cfg:      &LBConfig{HashKey: defaultHashKey, VirtualNodes: defaultVirtualNodes},
+		subConns: make(map[string]*ringSubConn),
+		state:    connectivity.Connecting,
+	}
+	b.picker = base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	return b
+}
+
+// ringHashBalancer 的方法和 SubConn 的状态回调由 gRPC 串行调用，不需要加锁；
+// picker 只读取生成时的快照。
+type ringHashBalancer struct {
+	cc          balancer.ClientConn
+	cfg         *LBConfig
+	subConns    map[string]*ringSubConn // addr -> SubConn
+	ring        []ringEntry
+	csEvltr     balancer.ConnectivityStateEvaluator
+	state       connectivity.State
+	picker      balancer.Picker
+	resolverErr error
+	connErr     error
+}
+
+type ringSubConn struct {
+	sc    balancer.SubConn
+	addr  string
+	state connectivity.State
+}
+
+func (b *ringHashBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	rebuild := false
+	if cfg, ok := s.BalancerConfig.(*LBConfig); ok && *cfg != *b.cfg {
+		b.cfg = cfg
+		rebuild = true
+	}
+	b.resolverErr = nil
+
+	addrs := make(map[string]bool, len(s.ResolverState.Addresses))
+	for _, addr := range s.ResolverState.Addresses {
+		if addrs[addr.Addr] {
+			continue
+		}
+		addrs[addr.Addr] = true
+		if _, ok := b.subConns[addr.Addr]; ok {
+			continue
+		}
+		rsc := &ringSubConn{addr: addr.Addr, state: connectivity.Idle}
+		sc, err := b.cc.NewSubConn([]resolver.Address{addr}, balancer.NewSubConnOptions{
+			HealthCheckEnabled: true,
+			StateListener:      func(state balancer.SubConnState) { b.updateSubConnState(rsc, state) },
+		})
+		if err != nil {
+			logger.Warningf("ringhash: failed to create SubConn for %s: %v", addr.Addr, err)
+			continue
+		}
+		rsc.sc = sc
+		b.subConns[addr.Addr] = rsc
+		b.csEvltr.RecordTransition(connectivity.Shutdown, connectivity.Idle)
+		sc.Connect()
+		rebuild = true
+	}
+	for addr, rsc := range b.subConns {
+		if addrs[addr] {
+			continue
+		}
+		// 被移除的 SubConn 之后的状态回调会被忽略，这里直接记为 SHUTDOWN
+		rsc.sc.Shutdown()
+		delete(b.subConns, addr)
+		b.state = b.csEvltr.RecordTransition(rsc.state, connectivity.Shutdown)
+		rebuild = true
+	}
+
+	if len(s.ResolverState.Addresses) == 0 {
+		b.ResolverError(errors.New("produced zero addresses"))
+		return balancer.ErrBadResolverState
+	}
+	if rebuild {
+		b.buildRing()
+	}
+	b.regeneratePicker()
+	return nil
+}
+
+func (b *ringHashBalancer) ResolverError(err error) {
+	b.resolverErr = err
+	if len(b.subConns) == 0 {
+		b.state = connectivity.TransientFailure
+	}
+	if b.state != connectivity.TransientFailure {
+		return
+	}
+	b.regeneratePicker()
+}
+
+func (b *ringHashBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {
+	logger.Errorf("ringhash: UpdateSubConnState(%v, %+v) called unexpectedly", sc, state)
+}
+
+func (b *ringHashBalancer) updateSubConnState(rsc *ringSubConn, state balancer.SubConnState) {
+	if b.subConns[rsc.addr] != rsc {
+		return
+	}
+	s, old := state.ConnectivityState, rsc.state
+	// 与 base 均衡器一致：进入 TRANSIENT_FAILURE 后忽略 IDLE、CONNECTING，避免整体状态一直是 CONNECTING
+	if old == connectivity.TransientFailure && (s == connectivity.Connecting || s == connectivity.Idle) {
+		if s == connectivity.Idle {
+			rsc.sc.Connect()
+		}
+		return
+	}
+	rsc.state = s
+	switch s {
+	case connectivity.Idle:
+		rsc.sc.Connect()
+	case connectivity.TransientFailure:
+		b.connErr = state.ConnectionError
+	}
+	b.state = b.csEvltr.RecordTransition(old, s)
+	if (s == connectivity.Ready) != (old == connectivity.Ready) || b.state == connectivity.TransientFailure {
+		b.regeneratePicker()
+		return
+	}
+	b.cc.UpdateState(balancer.State{ConnectivityState: b.state, Picker: b.picker})
+}
+
+func (b *ringHashBalancer) ExitIdle() {}
+
+func (b *ringHashBalancer) Close() {}
+
+// buildRing 为每个后端放置 VirtualNodes 个虚拟节点
+func (b *ringHashBalancer) buildRing() {
+	ring := make([]ringEntry, 0, len(b.subConns)*b.cfg.VirtualNodes)
+	for _, rsc := range b.subConns {
+		// 虚拟节点的位置只与地址有关，后端增减不会影响其它后端在环上的位置
+		for i := 0; i < b.cfg.VirtualNodes; i++ {
+			ring = append(ring, ringEntry{hash: hashString(rsc.addr + "#" + strconv.Itoa(i)), sc: rsc})
+		}
+	}
+	slices.SortFunc(ring, func(a, b ringEntry) int { return cmp.Compare(a.hash, b.hash) })
+	b.ring = ring
+	logger.Infof("ringhash: built ring with %d entries for %d SubConns, hash key %q", len(ring), len(b.subConns), b.cfg.HashKey)
+}
+
+// regeneratePicker 使用当前的哈希环和 READY 的 SubConn 生成 picker 并更新状态
+func (b *ringHashBalancer) regeneratePicker() {
+	var ready []*ringSubConn
+	for _, rsc := range b.subConns {
+		if rsc.state == connectivity.Ready {
+			ready = append(ready, rsc)
+		}
+	}
+	switch {
+	case b.state == connectivity.TransientFailure:
+		b.picker = base.NewErrPicker(b.mergeErrors())
+	case len(ready) == 0:
+		b.picker = base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	default:
+		p := &ringPicker{hashKey: b.cfg.HashKey, ring: b.ring, ready: make(map[*ringSubConn]bool, len(ready)), subConns: ready}
+		for _, rsc := range ready {
+			p.ready[rsc] = true
+		}
+		b.picker = p
+	}
+	b.cc.UpdateState(balancer.State{ConnectivityState: b.state, Picker: b.picker})
+}
+
+func (b *ringHashBalancer) mergeErrors() error {
+	switch {
+	case b.connErr == nil:
+		return fmt.Errorf("last resolver error: %v", b.resolverErr)
+	case b.resolverErr == nil:
+		return fmt.Errorf("last connection error: %v", b.connErr)
+	default:
+		return fmt.Errorf("last connection error: %v; last resolver error: %v", b.connErr, b.resolverErr)
+	}
+}
+
+type ringEntry struct {
+	hash uint64
+	sc   *ringSubConn
+}
+
+// ringPicker 共享均衡器的哈希环，ready 为生成时 READY 的 SubConn
+type ringPicker struct {
+	hashKey  string
+	ring     []ringEntry
+	ready    map[*ringSubConn]bool
+	subConns []*ringSubConn
+}
+
+func (p *ringPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	md, _ := metadata.FromOutgoingContext(info.Ctx)
+	values := md.Get(p.hashKey)
+	if len(values) == 0 || values[0] == "" {
+		return balancer.PickResult{SubConn: p.subConns[rand.IntN(len(p.subConns))].sc}, nil
+	}
+
+	// 顺时针找到第一个不小于该哈希值的虚拟节点，超过末尾时回到环的起点；
+	// 跳过不是 READY 的后端，至少有一个 READY 的后端，所以一定能找到
+	h := hashString(values[0])
+	i, _ := slices.BinarySearchFunc(p.ring, h, func(e ringEntry, h uint64) int { return cmp.Compare(e.hash, h) })
+	for n := range len(p.ring) {
+		if e := p.ring[(i+n)%len(p.ring)]; p.ready[e.sc] {
+			return balancer.PickResult{SubConn: e.sc.sc}, nil
+		}
+	}
+	return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+}
+
+// hashString 使用 FNV-1a 计算 64 位哈希，再经过 murmur3 的 fmix64 打散。
+// 虚拟节点的 key 只有末尾几个字符不同，FNV 的高位分布不够均匀，打散后各后端分到的区间更平均。
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
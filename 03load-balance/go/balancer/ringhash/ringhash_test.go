@@ -0,0 +1,167 @@
+package ringhash
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/clin211/grpc/load-balance/balancer/internal/balancertest"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+)
+
+const numKeys = 1000
+
+// newBalancer 构建均衡器，update 用给定的地址更新解析结果，新地址的 SubConn 随即变为 READY
+func newBalancer(t *testing.T) (*balancertest.ClientConn, func(addrs ...string)) {
+	t.Helper()
+	cc := balancertest.NewClientConn()
+	b := balancer.Get(Name).Build(cc, balancer.BuildOptions{})
+	t.Cleanup(b.Close)
+	cfg, err := (&ringHashBuilder{}).ParseConfig([]byte(`{"hashKey":"X-User-Id"}`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	update := func(addrs ...string) {
+		t.Helper()
+		err := b.UpdateClientConnState(balancer.ClientConnState{
+			ResolverState:  resolver.State{Addresses: balancertest.Addrs(addrs...)},
+			BalancerConfig: cfg,
+		})
+		if err != nil {
+			t.Fatalf("UpdateClientConnState: %v", err)
+		}
+		for _, addr := range addrs {
+			if sc := cc.SubConn(addr); !sc.IsShutdown() {
+				sc.SetState(connectivity.Ready)
+			}
+		}
+	}
+	return cc, update
+}
+
+// route 返回 numKeys 个 key 各自被选中的后端
+func route(t *testing.T, cc *balancertest.ClientConn) map[string]string {
+	t.Helper()
+	p := cc.State().Picker
+	routes := make(map[string]string, numKeys)
+	for i := range numKeys {
+		key := fmt.Sprintf("user-%d", i)
+		addr, err := balancertest.Pick(p, metadata.Pairs("x-user-id", key))
+		if err != nil {
+			t.Fatalf("Pick(%s): %v", key, err)
+		}
+		routes[key] = addr
+	}
+	return routes
+}
+
+func TestStickyRouting(t *testing.T) {
+	cc, update := newBalancer(t)
+	update("a", "b", "c")
+
+	first := route(t, cc)
+	counts := make(map[string]int)
+	for _, addr := range first {
+		counts[addr]++
+	}
+	// 虚拟节点使各后端分到的 key 大致均匀
+	for _, addr := range []string{"a", "b", "c"} {
+		if counts[addr] < numKeys/6 {
+			t.Errorf("backend %s got %d of %d keys", addr, counts[addr], numKeys)
+		}
+	}
+
+	// 重新解析出相同的地址不改变路由
+	update("c", "b", "a")
+	for key, addr := range route(t, cc) {
+		if first[key] != addr {
+			t.Fatalf("key %s moved from %s to %s after an identical update", key, first[key], addr)
+		}
+	}
+}
+
+// 后端经过 CONNECTING 时只有它上面的 key 临时转移，恢复 READY 后全部回到原处；哈希环不重建
+func TestFlappingBackendKeepsRing(t *testing.T) {
+	cc, update := newBalancer(t)
+	update("a", "b", "c")
+	before := route(t, cc)
+	ring := cc.State().Picker.(*ringPicker).ring
+
+	cc.SubConn("b").SetState(connectivity.Connecting)
+	p, ok := cc.State().Picker.(*ringPicker)
+	if !ok {
+		t.Fatalf("picker while b is CONNECTING = %T", cc.State().Picker)
+	}
+	if &p.ring[0] != &ring[0] || len(p.ring) != len(ring) {
+		t.Fatal("ring rebuilt on a SubConn state change")
+	}
+	for key, addr := range route(t, cc) {
+		switch {
+		case addr == "b":
+			t.Fatalf("key %s routed to CONNECTING backend b", key)
+		case before[key] != "b" && addr != before[key]:
+			t.Fatalf("key %s moved from %s to %s while only b was down", key, before[key], addr)
+		}
+	}
+
+	cc.SubConn("b").SetState(connectivity.Ready)
+	for key, addr := range route(t, cc) {
+		if addr != before[key] {
+			t.Fatalf("key %s on %s after b recovered, want %s", key, addr, before[key])
+		}
+	}
+}
+
+// 增加后端时只有转移到新后端的 key 改变；移除后端时只有原来在它上面的 key 改变
+func TestMinimalRemapping(t *testing.T) {
+	cc, update := newBalancer(t)
+	update("a", "b", "c", "d")
+	before := route(t, cc)
+
+	update("a", "b", "c", "d", "e")
+	added := route(t, cc)
+	moved := 0
+	for key, addr := range added {
+		if addr == before[key] {
+			continue
+		}
+		if addr != "e" {
+			t.Fatalf("key %s moved from %s to %s, not to the new backend", key, before[key], addr)
+		}
+		moved++
+	}
+	// 理想情况下 1/5 的 key 转移到新后端
+	if moved < numKeys/10 || moved > numKeys*2/5 {
+		t.Fatalf("%d of %d keys moved to the new backend", moved, numKeys)
+	}
+
+	update("a", "b", "d", "e")
+	if !cc.SubConn("c").IsShutdown() {
+		t.Fatal("removed backend c not shut down")
+	}
+	for key, addr := range route(t, cc) {
+		if added[key] != "c" && addr != added[key] {
+			t.Fatalf("key %s moved from %s to %s when only c was removed", key, added[key], addr)
+		}
+	}
+}
+
+// 没有哈希 key 时只在 READY 的后端中随机选择；没有 READY 的后端时返回 ErrNoSubConnAvailable
+func TestPickWithoutKeyAndNoReady(t *testing.T) {
+	cc, update := newBalancer(t)
+	update("a", "b")
+	cc.SubConn("a").SetState(connectivity.Connecting)
+	for range 50 {
+		if addr, err := balancertest.Pick(cc.State().Picker, nil); err != nil || addr != "b" {
+			t.Fatalf("Pick without key = %q, %v, want b", addr, err)
+		}
+	}
+
+	cc.SubConn("b").SetState(connectivity.Connecting)
+	if _, err := balancertest.Pick(cc.State().Picker, metadata.Pairs("x-user-id", "user-1")); !errors.Is(err, balancer.ErrNoSubConnAvailable) {
+		t.Fatalf("Pick with no READY backend: err = %v, want ErrNoSubConnAvailable", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Package wrr 实现平滑加权轮询（smooth weighted round-robin）负载均衡策略。
+//
+// 权重由解析器通过 SetWeight 写入地址的 BalancerAttributes，没有写入时使用注册中心
+// 实例信息（registry.Endpoint）中的权重，都未设置时按 1 处理。
+// 通过服务配置启用：
+//
+//	{"loadBalancingConfig": [{"smooth_weighted_round_robin":{}}]}
+package wrr
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/resolver"
+)
+
+// Name 负载均衡策略名称
+const Name = "smooth_weighted_round_robin"
+
+var logger = grpclog.Component("wrr")
+
+func init() {
+	balancer.Register(&wrrBuilder{})
+}
+
+type weightKey struct{}
+
+// SetWeight 设置地址的权重。权重放在 BalancerAttributes 中，权重变化不会导致 SubConn 重建。
+func SetWeight(addr resolver.Address, weight uint32) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(weightKey{}, weight)
+	return addr
+}
+
+// GetWeight 返回地址的权重。优先使用 SetWeight 设置的值，
+// 其次是基于注册中心的解析器写入的 registry.Endpoint，未设置或不大于 0 时返回 1。
+func GetWeight(addr resolver.Address) uint32 {
+	w, ok := addr.BalancerAttributes.Value(weightKey{}).(uint32)
+	if !ok {
+		if ep, ok := registry.EndpointFromAddress(addr); ok && ep.Weight > 0 {
+			w = uint32(ep.Weight)
+		}
+	}
+	if w == 0 {
+		return 1
+	}
+	return w
+}
+
+type wrrBuilder struct{}
+
+func (*wrrBuilder) Name() string {
+	return Name
+}
+
+// Build 复用 base 均衡器管理 SubConn，只替换 picker 的构建逻辑。
+// base 均衡器以首次出现的地址作为 SubConn 的 key，之后 BalancerAttributes 的变化不会反映到
+// PickerBuildInfo 中，所以每次解析结果更新时单独记录最新的权重。
+func (*wrrBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &wrrPickerBuilder{}
+	return &wrrBalancer{
+		Balancer: base.NewBalancerBuilder(Name, pb, base.Config{HealthCheck: true}).Build(cc, opts),
+		pb:       pb,
+	}
+}
+
+type wrrBalancer struct {
+	balancer.Balancer
+	pb *wrrPickerBuilder
+}
+
+// UpdateClientConnState 记录最新权重后交给 base 均衡器，base 随后会重新生成 picker
+func (b *wrrBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	weights := make(map[string]uint32, len(s.ResolverState.Addresses))
+	for _, addr := range s.ResolverState.Addresses {
+		weights[addr.Addr] = GetWeight(addr)
+	}
+	b.pb.setWeights(weights)
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+type wrrPickerBuilder struct {
+	mu      sync.Mutex
+	weights map[string]uint32 // addr -> 权重
+}
+
+func (pb *wrrPickerBuilder) setWeights(weights map[string]uint32) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.weights = weights
+}
+
+func (pb *wrrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	p := &wrrPicker{items: make([]*weightedSubConn, 0, len(info.ReadySCs))}
+	for sc, sci := range info.ReadySCs {
+		w, ok := pb.weights[sci.Address.Addr]
+		if !ok {
+			w = GetWeight(sci.Address)
+		}
+		p.items = append(p.items, &weightedSubConn{sc: sc, addr: sci.Address.Addr, weight: int64(w)})
+		p.total += int64(w)
+	}
+	// 按地址排序，保证相同权重下的选择顺序稳定
+	slices.SortFunc(p.items, func(a, b *weightedSubConn) int { return strings.Compare(a.addr, b.addr) })
+	logger.Infof("wrrPicker: built with %v", p.items)
+	return p
+}
+
+type weightedSubConn struct {
+	sc      balancer.SubConn
+	addr    string
+	weight  int64
+	current int64
+}
+
+func (w *weightedSubConn) String() string {
+	return w.addr
+}
+
+// wrrPicker 平滑加权轮询：每次选择时所有节点的 current 加上各自的权重，
+// 选出 current 最大的节点并减去总权重。权重为 5、1、1 时的选择序列为 a a b a c a a，
+// 高权重节点的请求被均匀地打散，而不是连续地落在同一个节点上。
+type wrrPicker struct {
+	mu    sync.Mutex
+	items []*weightedSubConn
+	total int64
+}
+
+func (p *wrrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *weightedSubConn
+	for _, item := range p.items {
+		item.current += item.weight
+		if best == nil || item.current > best.current {
+			best = item
+		}
+	}
+	best.current -= p.total
+	return balancer.PickResult{SubConn: best.sc}, nil
+}
@@ -0,0 +1,118 @@
+package wrr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clin211/grpc/02etcd/registry"
+	"github.com/clin211/grpc/load-balance/balancer/internal/balancertest"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+// picks 连续选择 n 次，返回以空格分隔的地址序列
+func picks(t *testing.T, p balancer.Picker, n int) string {
+	t.Helper()
+	seq := make([]string, 0, n)
+	for range n {
+		addr, err := balancertest.Pick(p, nil)
+		if err != nil {
+			t.Fatalf("Pick: %v", err)
+		}
+		seq = append(seq, addr)
+	}
+	return strings.Join(seq, " ")
+}
+
+// buildPicker 用 addrs 作为 READY 的 SubConn 构建 picker，不经过均衡器记录的权重
+func buildPicker(addrs ...resolver.Address) balancer.Picker {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for _, addr := range addrs {
+		info.ReadySCs[balancertest.NewSubConn(addr.Addr)] = base.SubConnInfo{Address: addr}
+	}
+	return (&wrrPickerBuilder{}).Build(info)
+}
+
+func TestPickerSmoothSequence(t *testing.T) {
+	p := buildPicker(
+		SetWeight(resolver.Address{Addr: "a"}, 5),
+		SetWeight(resolver.Address{Addr: "b"}, 1),
+		SetWeight(resolver.Address{Addr: "c"}, 1),
+	)
+	// 每 7 次选择为一轮，每轮的序列相同
+	for round := range 3 {
+		if got, want := picks(t, p, 7), "a a b a c a a"; got != want {
+			t.Fatalf("round %d: picks = %q, want %q", round, got, want)
+		}
+	}
+}
+
+func TestGetWeight(t *testing.T) {
+	tests := []struct {
+		name string
+		addr resolver.Address
+		want uint32
+	}{
+		{"missing", resolver.Address{Addr: "a"}, 1},
+		{"zero", SetWeight(resolver.Address{Addr: "a"}, 0), 1},
+		{"set", SetWeight(resolver.Address{Addr: "a"}, 7), 7},
+		{"registry", registry.Endpoint{Addr: "a", Weight: 3}.Address(), 3},
+		{"registry zero", registry.Endpoint{Addr: "a"}.Address(), 1},
+		{"set overrides registry", SetWeight(registry.Endpoint{Addr: "a", Weight: 3}.Address(), 2), 2},
+	}
+	for _, tt := range tests {
+		if got := GetWeight(tt.addr); got != tt.want {
+			t.Errorf("%s: GetWeight = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 权重为 0 或没有设置的地址按 1 参与轮询
+func TestPickerDefaultsWeightToOne(t *testing.T) {
+	p := buildPicker(
+		resolver.Address{Addr: "a"},
+		SetWeight(resolver.Address{Addr: "b"}, 0),
+		SetWeight(resolver.Address{Addr: "c"}, 2),
+	)
+	if got, want := picks(t, p, 8), "c a b c c a b c"; got != want {
+		t.Fatalf("picks = %q, want %q", got, want)
+	}
+}
+
+// 地址不变、只有权重变化时，新的 picker 使用最新的权重
+func TestBalancerFollowsWeightUpdates(t *testing.T) {
+	cc := balancertest.NewClientConn()
+	b := balancer.Get(Name).Build(cc, balancer.BuildOptions{})
+	defer b.Close()
+
+	update := func(wa, wb uint32) {
+		t.Helper()
+		err := b.UpdateClientConnState(balancer.ClientConnState{ResolverState: resolver.State{Addresses: []resolver.Address{
+			SetWeight(resolver.Address{Addr: "a"}, wa),
+			SetWeight(resolver.Address{Addr: "b"}, wb),
+		}}})
+		if err != nil {
+			t.Fatalf("UpdateClientConnState: %v", err)
+		}
+	}
+
+	update(1, 1)
+	cc.SetAllStates(connectivity.Ready, "a", "b")
+	if got, want := picks(t, cc.State().Picker, 4), "a b a b"; got != want {
+		t.Fatalf("weights 1/1: picks = %q, want %q", got, want)
+	}
+
+	update(3, 1)
+	if got, want := picks(t, cc.State().Picker, 8), "a a b a a a b a"; got != want {
+		t.Fatalf("weights 3/1: picks = %q, want %q", got, want)
+	}
+
+	// 重新连接后重建的 picker 仍然使用最新的权重，而不是 SubConn 创建时的地址属性
+	cc.SubConn("b").SetState(connectivity.Idle)
+	cc.SubConn("b").SetState(connectivity.Ready)
+	if got, want := picks(t, cc.State().Picker, 4), "a a b a"; got != want {
+		t.Fatalf("after reconnect: picks = %q, want %q", got, want)
+	}
+}
@@ -4,12 +4,19 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // 注册客户端健康检查
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/resolver"
 
+	"github.com/clin211/grpc/load-balance/balancer/locality"
+	"github.com/clin211/grpc/load-balance/balancer/outlier"
+	"github.com/clin211/grpc/load-balance/balancer/ringhash"
+	"github.com/clin211/grpc/load-balance/balancer/wrr"
 	lb "github.com/clin211/grpc/load-balance/rpc"
+	"github.com/clin211/grpc/mtls"
 )
 
 const (
@@ -19,9 +26,27 @@ const (
 
 var addrs = []string{"localhost:50051", "localhost:50052", "localhost:50053"}
 
+// weights 每个地址的权重，用于加权轮询
+var weights = map[string]uint32{"localhost:50051": 5, "localhost:50052": 3, "localhost:50053": 2}
+
+// zones 每个地址所在的可用区，用于按可用区优先的负载均衡
+var zones = map[string]string{"localhost:50051": "zone-a", "localhost:50052": "zone-a", "localhost:50053": "zone-b"}
+
+// roundRobinServiceConfig 轮询加客户端健康检查，NOT_SERVING 的节点不参与轮询。
+// 订阅的是 HelloService 的健康状态，与服务端 -flip 切换的服务名一致
+var roundRobinServiceConfig = fmt.Sprintf(`{"loadBalancingConfig": [{"round_robin":{}}], "healthCheckConfig": {"serviceName": %q}}`,
+	lb.HelloService_ServiceDesc.ServiceName)
+
 func main() {
 	address := exampleScheme + ":///" + exampleServiceName
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	creds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
+	conn, err := grpc.NewClient(address, creds)
 
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
@@ -33,8 +58,8 @@ func main() {
 
 	lbConn, err := grpc.NewClient(
 		address,
-		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin":{}}]}`),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(roundRobinServiceConfig),
+		creds,
 	)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
@@ -43,6 +68,87 @@ func main() {
 
 	fmt.Println("用负载均衡：")
 	rpcHandler(lbConn)
+
+	wrrConn, err := grpc.NewClient(
+		address,
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{}}]}`, wrr.Name)),
+		creds,
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer wrrConn.Close()
+
+	fmt.Println("用加权轮询负载均衡：")
+	rpcHandler(wrrConn)
+
+	hashConn, err := grpc.NewClient(
+		address,
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{"hashKey":"x-user-id"}}]}`, ringhash.Name)),
+		creds,
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer hashConn.Close()
+	// 哈希环只包含 READY 的节点，先等所有节点连接就绪，避免启动阶段的 key 映射到其它节点
+	hashConn.Connect()
+	time.Sleep(time.Second)
+
+	fmt.Println("用一致性哈希负载均衡（同一个 x-user-id 总是落到同一个节点）：")
+	for _, userID := range []string{"user_1", "user_2", "user_3"} {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", userID)
+		c := lb.NewHelloServiceClient(hashConn)
+		for i := 0; i < 3; i++ {
+			resp, err := c.SayHello(ctx, &lb.HelloRequest{Name: userID})
+			if err != nil {
+				log.Printf("could not greet: %s", err)
+				continue
+			}
+			fmt.Printf("resp : %v\n", resp.Message)
+		}
+	}
+
+	zoneConn, err := grpc.NewClient(
+		address,
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{"localZone":"zone-a","minHealthyRatio":0.5}}]}`, locality.Name)),
+		creds,
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer zoneConn.Close()
+	zoneConn.Connect()
+	time.Sleep(time.Second)
+
+	// zone-a 的节点可用数不低于一半时只访问 zone-a，停掉 zone-a 的节点后会溢出到 zone-b
+	fmt.Println("用可用区优先负载均衡（本可用区 zone-a）：")
+	rpcHandler(zoneConn)
+
+	odConn, err := grpc.NewClient(
+		address,
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{
+			"interval":"1s","baseEjectionTime":"5s","maxEjectionPercent":50,
+			"consecutiveFailures":{"threshold":3},
+			"childPolicy":[{"round_robin":{}}]}}]}`, outlier.Name)),
+		creds,
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer odConn.Close()
+
+	// 用 -fail :50052 启动服务端后，该节点连续失败 3 次会被摘除，之后的请求只发往其它节点
+	fmt.Println("用异常实例摘除负载均衡（round_robin 作为子策略）：")
+	c := lb.NewHelloServiceClient(odConn)
+	for i := 0; i < 20; i++ {
+		resp, err := c.SayHello(context.TODO(), &lb.HelloRequest{Name: "clina"})
+		if err != nil {
+			log.Printf("could not greet: %s", err)
+			continue
+		}
+		fmt.Printf("resp : %v\n", resp.Message)
+	}
 }
 
 func rpcHandler(conn *grpc.ClientConn) {
@@ -50,7 +156,8 @@ func rpcHandler(conn *grpc.ClientConn) {
 	for i := 0; i < 10; i++ {
 		resp, err := c.SayHello(context.TODO(), &lb.HelloRequest{Name: "clina"})
 		if err != nil {
-			log.Fatalf("could not greet: %s", err)
+			log.Printf("could not greet: %s", err)
+			continue
 		}
 
 		fmt.Printf("resp : %v", resp.Message)
@@ -85,7 +192,7 @@ func (r *exampleResolver) start() {
 	addrStrs := r.addrsStore[r.target.Endpoint()]
 	addrs := make([]resolver.Address, len(addrStrs))
 	for i, s := range addrStrs {
-		addrs[i] = resolver.Address{Addr: s}
+		addrs[i] = locality.SetZone(wrr.SetWeight(resolver.Address{Addr: s}, weights[s]), zones[s])
 	}
 	r.cc.UpdateState(resolver.State{Addresses: addrs})
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	lb "github.com/clin211/grpc/load-balance/rpc"
+)
+
+const testTimeout = 10 * time.Second
+
+// 服务端的 flipHealth 切换的是 HelloService 的健康状态
+var flipService = lb.HelloService_ServiceDesc.ServiceName
+
+// echoServer 在响应中返回自己的地址，用来统计请求落在哪个后端
+type echoServer struct {
+	lb.UnimplementedHelloServiceServer
+	addr string
+}
+
+func (s *echoServer) SayHello(ctx context.Context, req *lb.HelloRequest) (*lb.HelloResponse, error) {
+	return &lb.HelloResponse{Message: s.addr}, nil
+}
+
+// startBackends 在随机端口上启动 n 个后端，健康状态与服务端一样初始为 SERVING。
+// 这里使用 grpc 自带的健康检查服务，它与 04health 的实现在协议上一致。
+func startBackends(t *testing.T, n int) ([]string, []*health.Server) {
+	t.Helper()
+	var addrs []string
+	var hss []*health.Server
+	for range n {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		addr := lis.Addr().String()
+		s := grpc.NewServer()
+		lb.RegisterHelloServiceServer(s, &echoServer{addr: addr})
+		hs := health.NewServer()
+		healthpb.RegisterHealthServer(s, hs)
+		hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		hs.SetServingStatus(flipService, healthpb.HealthCheckResponse_SERVING)
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+		addrs = append(addrs, addr)
+		hss = append(hss, hs)
+	}
+	return addrs, hss
+}
+
+// dial 使用 main 中 lbConn 的服务配置，通过 manual 解析器连接 addrs
+func dial(t *testing.T, addrs []string) lb.HelloServiceClient {
+	t.Helper()
+	r := manual.NewBuilderWithScheme("test")
+	var state resolver.State
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r.InitialState(state)
+
+	conn, err := grpc.NewClient(r.Scheme()+":///"+exampleServiceName,
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(roundRobinServiceConfig),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return lb.NewHelloServiceClient(conn)
+}
+
+// hits 发出 n 个请求，按后端地址计数
+func hits(t *testing.T, c lb.HelloServiceClient, n int) map[string]int {
+	t.Helper()
+	got := make(map[string]int)
+	for range n {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		resp, err := c.SayHello(ctx, &lb.HelloRequest{Name: "test"}, grpc.WaitForReady(true))
+		cancel()
+		if err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+		got[resp.GetMessage()]++
+	}
+	return got
+}
+
+// waitFor 反复发出一轮请求，直到这一轮的分布满足 cond
+func waitFor(t *testing.T, c lb.HelloServiceClient, what string, cond func(map[string]int) bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		got := hits(t, c, 30)
+		if cond(got) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, last distribution %v", what, got)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestRoundRobinFollowsFlippedHealth(t *testing.T) {
+	addrs, hss := startBackends(t, 3)
+	c := dial(t, addrs)
+	all := func(got map[string]int) bool { return len(got) == len(addrs) }
+	waitFor(t, c, "all backends to receive traffic", all)
+
+	flipped := addrs[1]
+	hss[1].SetServingStatus(flipService, healthpb.HealthCheckResponse_NOT_SERVING)
+	waitFor(t, c, flipped+" to leave the rotation", func(got map[string]int) bool { return got[flipped] == 0 })
+	if got := hits(t, c, 60); got[flipped] != 0 || len(got) != 2 {
+		t.Fatalf("with %s NOT_SERVING: distribution %v, want only the other two backends", flipped, got)
+	}
+
+	hss[1].SetServingStatus(flipService, healthpb.HealthCheckResponse_SERVING)
+	waitFor(t, c, flipped+" to rejoin the rotation", all)
+}
+
+// 只有 HelloService 的状态决定节点是否参与轮询，整体状态（空服务名）不影响
+func TestRoundRobinIgnoresOverallHealth(t *testing.T) {
+	addrs, hss := startBackends(t, 2)
+	c := dial(t, addrs)
+	all := func(got map[string]int) bool { return len(got) == len(addrs) }
+	waitFor(t, c, "all backends to receive traffic", all)
+
+	hss[0].SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	time.Sleep(200 * time.Millisecond)
+	if got := hits(t, c, 30); !all(got) {
+		t.Fatalf("overall NOT_SERVING changed the distribution: %v", got)
+	}
+}
@@ -3,13 +3,33 @@ module github.com/clin211/grpc/load-balance
 go 1.23.4
 
 require (
+	github.com/clin211/grpc/02etcd v0.0.0-00010101000000-000000000000
+	github.com/clin211/grpc/health v0.0.0-00010101000000-000000000000
+	github.com/clin211/grpc/mtls v0.0.0-00010101000000-000000000000
 	google.golang.org/grpc v1.69.2
 	google.golang.org/protobuf v1.36.1
 )
 
 require (
+	github.com/coreos/go-semver v0.3.0 // indirect
+	github.com/coreos/go-systemd/v22 v22.3.2 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/golang/protobuf v1.5.4 // indirect
+	go.etcd.io/etcd/api/v3 v3.5.17 // indirect
+	go.etcd.io/etcd/client/pkg/v3 v3.5.17 // indirect
+	go.etcd.io/etcd/client/v3 v3.5.17 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.6.0 // indirect
+	go.uber.org/zap v1.17.0 // indirect
 	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20241015192408-796eee8c2d53 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
 )
+
+replace github.com/clin211/grpc/health => ../../04health/go
+
+replace github.com/clin211/grpc/02etcd => ../../02etcd/go
+
+replace github.com/clin211/grpc/mtls => ../../mtls
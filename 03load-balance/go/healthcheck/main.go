@@ -0,0 +1,97 @@
+// healthcheck 演示客户端健康检查与负载均衡的配合。
+//
+// 服务配置中的 healthCheckConfig 让每个 SubConn 订阅后端的 grpc.health.v1.Health/Watch，
+// 后端变为 NOT_SERVING 时从轮询中移除，恢复 SERVING 后重新加入。服务端使用 04health 的实现，
+// 客户端使用 grpc 自带的健康检查，两者的协议相同。
+//
+// 注意：grpc/health 与 04health/rpc 注册了相同的 protobuf 类型，不能链接到同一个程序中，
+// 所以客户端不引用 04health。先启动服务端，让 :50052 每 5 秒切换一次健康状态：
+//
+//	go run ./server -flip :50052
+//	go run ./healthcheck -duration 20s
+//
+// 每秒输出一次各后端分到的请求数，:50052 不健康期间不会收到请求。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/health" // 注册客户端健康检查
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	lb "github.com/clin211/grpc/load-balance/rpc"
+	"github.com/clin211/grpc/mtls"
+)
+
+var (
+	duration = flag.Duration("duration", 20*time.Second, "how long to send requests")
+	policy   = flag.String("policy", "round_robin", "load balancing policy")
+)
+
+var addrs = []string{"localhost:50051", "localhost:50052", "localhost:50053"}
+
+func main() {
+	flag.Parse()
+
+	r := manual.NewBuilderWithScheme("healthcheck")
+	state := resolver.State{}
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r.InitialState(state)
+
+	serviceConfig := fmt.Sprintf(`{
+		"loadBalancingConfig": [{"%s":{}}],
+		"healthCheckConfig": {"serviceName": "%s"}
+	}`, *policy, lb.HelloService_ServiceDesc.ServiceName)
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	creds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
+	conn, err := grpc.NewClient(
+		r.Scheme()+":///hello",
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		creds,
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := lb.NewHelloServiceClient(conn)
+
+	deadline := time.Now().Add(*duration)
+	for time.Now().Before(deadline) {
+		counts := make(map[string]int)
+		second := time.Now().Add(time.Second)
+		for time.Now().Before(second) {
+			resp, err := c.SayHello(context.Background(), &lb.HelloRequest{Name: "health"}, grpc.WaitForReady(true))
+			if err != nil {
+				log.Printf("could not greet: %s", err)
+				continue
+			}
+			counts[resp.GetMessage()]++
+			time.Sleep(10 * time.Millisecond)
+		}
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		fmt.Printf("%s ", time.Now().Format("15:04:05"))
+		for _, k := range keys {
+			fmt.Printf(" [%s: %d]", k, counts[k])
+		}
+		fmt.Println()
+	}
+}
@@ -2,54 +2,110 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net"
-	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
 	lb "github.com/clin211/grpc/load-balance/rpc"
+	"github.com/clin211/grpc/mtls"
 )
 
 var (
 	addrs = []string{":50051", ":50052", ":50053"}
+
+	// failAddr 该地址上的服务对所有请求返回 UNAVAILABLE，用于演示异常实例摘除，例如 -fail :50052
+	failAddr = flag.String("fail", "", "listener that fails every call")
+
+	// flipAddr 该地址上的健康状态每隔 flipInterval 在 SERVING 和 NOT_SERVING 之间切换，
+	// 用于演示客户端健康检查把不健康的节点移出轮询，例如 -flip :50052
+	flipAddr     = flag.String("flip", "", "listener whose health status is toggled periodically")
+	flipInterval = flag.Duration("flip-interval", 5*time.Second, "interval between health status toggles")
 )
 
 type HelloServer struct {
 	lb.UnimplementedHelloServiceServer
 	addr string
+	fail bool
 }
 
-func (s *HelloServer) SyaHello(ctx context.Context, req *lb.HelloRequest) (*lb.HelloResponse, error) {
+func (s *HelloServer) SayHello(ctx context.Context, req *lb.HelloRequest) (*lb.HelloResponse, error) {
+	if s.fail {
+		return nil, status.Errorf(codes.Unavailable, "%s is failing", s.addr)
+	}
 	message := fmt.Sprintf("Hello %s , form %s", req.GetName(), s.addr)
 	return &lb.HelloResponse{Message: message}, nil
 }
 
-func startServer(addr string) {
+// startServer 在后台启动一个监听地址上的服务，返回 gRPC 服务器和它的健康检查服务。
+// tlsCtx 结束后不再重新加载证书。
+func startServer(tlsCtx context.Context, addr string) (*grpc.Server, *health.Server) {
 	listen, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
-	lb.RegisterHelloServiceServer(s, &HelloServer{addr: addr})
-	log.Printf("server listening at %v", addr)
-	if err := s.Serve(listen); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
+	s := grpc.NewServer(creds)
+	lb.RegisterHelloServiceServer(s, &HelloServer{addr: addr, fail: addr == *failAddr})
+
+	// 每个监听地址都有自己的健康检查服务，客户端通过 healthCheckConfig 订阅它的状态
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus(lb.HelloService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	if addr == *flipAddr {
+		go flipHealth(addr, hs)
+	}
+
+	go func() {
+		log.Printf("server listening at %v", addr)
+		if err := s.Serve(listen); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+	return s, hs
+}
+
+func flipHealth(addr string, hs *health.Server) {
+	serving := true
+	for range time.Tick(*flipInterval) {
+		serving = !serving
+		st := healthpb.HealthCheckResponse_NOT_SERVING
+		if serving {
+			st = healthpb.HealthCheckResponse_SERVING
+		}
+		log.Printf("%s health status -> %v", addr, st)
+		hs.SetServingStatus(lb.HelloService_ServiceDesc.ServiceName, st)
 	}
 }
 
 func main() {
-	var wg sync.WaitGroup
+	flag.Parse()
 
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	cfg := lifecycle.Config{
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	}
 	for _, addr := range addrs {
-		wg.Add(1)
-		go func(addr string) {
-			defer wg.Done()
-			startServer(addr)
-		}(addr)
+		s, hs := startServer(tlsCtx, addr)
+		cfg.Servers = append(cfg.Servers, s)
+		cfg.Health = append(cfg.Health, hs)
 	}
 
-	wg.Wait()
+	// 收到退出信号时三个服务同时置为 NOT_SERVING，客户端健康检查把它们移出轮询后再优雅退出
+	lifecycle.New(cfg).Wait()
 }
@@ -1,5 +1,59 @@
 package main
 
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/mtls"
+	"google.golang.org/grpc"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:50051", "the address to connect to")
+	service = flag.String("service", "", "the service to check, empty for the whole server")
+	watch   = flag.Bool("watch", true, "keep watching the serving status after the check")
+)
+
 func main() {
+	flag.Parse()
+
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	creds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
+	conn, err := grpc.NewClient(*addr, creds)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	c := health.NewClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	st, err := c.Check(ctx, *service)
+	cancel()
+	if err != nil {
+		log.Printf("check %q: %v", *service, err)
+	} else {
+		log.Printf("check %q: %v", *service, st)
+	}
+	if !*watch {
+		return
+	}
 
+	// Watch 在服务端重启后会自动重连，Ctrl-C 退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for st := range c.Watch(ctx, *service) {
+		log.Printf("watch %q: %v", *service, st)
+	}
 }
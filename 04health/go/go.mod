@@ -3,6 +3,7 @@ module github.com/clin211/grpc/health
 go 1.23.4
 
 require (
+	github.com/clin211/grpc/mtls v0.0.0-00010101000000-000000000000
 	google.golang.org/grpc v1.69.2
 	google.golang.org/protobuf v1.36.1
 )
@@ -13,3 +14,5 @@ require (
 	golang.org/x/text v0.19.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
 )
+
+replace github.com/clin211/grpc/mtls => ../../mtls
@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"log"
+	"time"
+
+	pb "github.com/clin211/grpc/health/rpc"
+	"google.golang.org/grpc"
+)
+
+const (
+	minWatchBackoff = time.Second
+	maxWatchBackoff = 30 * time.Second
+)
+
+// Client 对 grpc.health.v1.Health 服务发起健康检查
+type Client struct {
+	hc pb.HealthClient
+}
+
+// NewClient 创建通过 cc 发送健康检查的客户端
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{hc: pb.NewHealthClient(cc)}
+}
+
+// Check 返回服务的当前状态，服务端不认识该服务时返回 NotFound 错误
+func (c *Client) Check(ctx context.Context, service string) (pb.HealthCheckResponse_ServingStatus, error) {
+	resp, err := c.hc.Check(ctx, &pb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return pb.HealthCheckResponse_UNKNOWN, err
+	}
+	return resp.GetStatus(), nil
+}
+
+// Watch 持续接收服务的状态，只发送变化，ctx 结束时关闭返回的通道。
+//
+// 流中断时先发送 UNKNOWN，再按指数退避重新打开流，服务端恢复后调用方会看到状态回到 SERVING。
+// 流上每收到一条消息，退避时间就重置一次。
+func (c *Client) Watch(ctx context.Context, service string) <-chan pb.HealthCheckResponse_ServingStatus {
+	ch := make(chan pb.HealthCheckResponse_ServingStatus, 1)
+	go func() {
+		defer close(ch)
+
+		last := pb.HealthCheckResponse_ServingStatus(-1)
+		send := func(st pb.HealthCheckResponse_ServingStatus) bool {
+			if st == last {
+				return true
+			}
+			select {
+			case ch <- st:
+				last = st
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		backoff := minWatchBackoff
+		for {
+			received, err := c.watchOnce(ctx, service, send)
+			if ctx.Err() != nil {
+				return
+			}
+			if received {
+				backoff = minWatchBackoff
+			}
+			log.Printf("health: watch %q ended: %v, retrying in %v", service, err, backoff)
+			if !send(pb.HealthCheckResponse_UNKNOWN) {
+				return
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, maxWatchBackoff)
+		}
+	}()
+	return ch
+}
+
+// watchOnce 打开一次 Watch 流并转发收到的每个状态，直到流出错。
+// 返回这次是否收到过消息。
+func (c *Client) watchOnce(ctx context.Context, service string, send func(pb.HealthCheckResponse_ServingStatus) bool) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// WaitForReady 避免在连接重建期间立即失败
+	stream, err := c.hc.Watch(ctx, &pb.HealthCheckRequest{Service: service}, grpc.WaitForReady(true))
+	if err != nil {
+		return false, err
+	}
+	received := false
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		if !send(resp.GetStatus()) {
+			return received, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	pb "github.com/clin211/grpc/health/rpc"
+)
+
+// HTTPResponse HTTP 接口返回的 JSON
+type HTTPResponse struct {
+	Status   string                   `json:"status"`
+	Services map[string]ServiceDetail `json:"services,omitempty"`
+}
+
+// ServiceDetail 一个服务的状态及其检查，空服务名 "" 表示整个服务器的健康状态
+type ServiceDetail struct {
+	Status string        `json:"status"`
+	Checks []CheckDetail `json:"checks,omitempty"`
+}
+
+// CheckDetail CheckResult 的 JSON 形式
+type CheckDetail struct {
+	Name                 string     `json:"name"`
+	Healthy              bool       `json:"healthy"`
+	LastError            string     `json:"lastError,omitempty"`
+	LastChecked          *time.Time `json:"lastChecked,omitempty"`
+	LastSuccess          *time.Time `json:"lastSuccess,omitempty"`
+	Latency              string     `json:"latency,omitempty"`
+	ConsecutiveFailures  int        `json:"consecutiveFailures"`
+	ConsecutiveSuccesses int        `json:"consecutiveSuccesses"`
+}
+
+// NewHTTPHandler 返回把 hs 暴露给 HTTP 运维工具的 http.Handler：
+//
+//   - /livez 只要进程还能处理请求就返回 200；
+//   - /readyz 整体状态（""）为 SERVING 时返回 200，否则返回 503；
+//   - /healthz 所有服务都是 SERVING 时返回 200，否则返回 503。
+//     ?service=name 只返回该服务的状态，服务不存在时返回 404。
+//
+// /readyz 和 /healthz 返回每个服务的状态，p 不为 nil 时还返回每个检查的详情。
+// gRPC 的 Check 和 Watch 不受影响。
+func NewHTTPHandler(hs *Server, p *Prober) http.Handler {
+	h := &httpHandler{hs: hs, p: p}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", h.livez)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.HandleFunc("/healthz", h.healthz)
+	return mux
+}
+
+type httpHandler struct {
+	hs *Server
+	p  *Prober
+}
+
+func (h *httpHandler) livez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HTTPResponse{Status: "ok"})
+}
+
+func (h *httpHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, "", true)
+}
+
+func (h *httpHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	service, filtered := r.URL.Query()["service"]
+	if !filtered {
+		h.serve(w, "", false)
+		return
+	}
+	h.serve(w, service[0], true)
+}
+
+// serve 在 only 为 true 时只返回 service 的状态，否则返回所有服务的状态；
+// 返回的服务都是 SERVING 时才返回 200
+func (h *httpHandler) serve(w http.ResponseWriter, service string, only bool) {
+	statuses := h.hs.Statuses()
+	var results map[string][]CheckResult
+	if h.p != nil {
+		results = h.p.Results()
+	}
+
+	resp := HTTPResponse{Services: make(map[string]ServiceDetail)}
+	code := http.StatusOK
+	for name, st := range statuses {
+		if only && name != service {
+			continue
+		}
+		resp.Services[name] = ServiceDetail{Status: st.String(), Checks: checkDetails(results[name])}
+		if st != pb.HealthCheckResponse_SERVING {
+			code = http.StatusServiceUnavailable
+		}
+	}
+	if len(resp.Services) == 0 {
+		code = http.StatusNotFound
+		resp.Status = pb.HealthCheckResponse_SERVICE_UNKNOWN.String()
+	} else if code == http.StatusOK {
+		resp.Status = pb.HealthCheckResponse_SERVING.String()
+	} else {
+		resp.Status = pb.HealthCheckResponse_NOT_SERVING.String()
+	}
+	writeJSON(w, code, resp)
+}
+
+func checkDetails(results []CheckResult) []CheckDetail {
+	details := make([]CheckDetail, 0, len(results))
+	for _, r := range results {
+		d := CheckDetail{
+			Name:                 r.Name,
+			Healthy:              r.Healthy,
+			ConsecutiveFailures:  r.ConsecutiveFailures,
+			ConsecutiveSuccesses: r.ConsecutiveSuccesses,
+		}
+		if r.LastError != nil {
+			d.LastError = r.LastError.Error()
+		}
+		if !r.LastChecked.IsZero() {
+			d.LastChecked = &r.LastChecked
+			d.Latency = r.Latency.String()
+		}
+		if !r.LastSuccess.IsZero() {
+			d.LastSuccess = &r.LastSuccess
+		}
+		details = append(details, d)
+	}
+	return details
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,246 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "github.com/clin211/grpc/health/rpc"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultProbeInterval    = 10 * time.Second
+	defaultProbeTimeout     = time.Second
+	defaultFailureThreshold = 3
+	defaultSuccessThreshold = 1
+)
+
+// CheckFunc 探测一个依赖，依赖健康时返回 nil，ctx 带有本次探测的超时时间
+type CheckFunc func(ctx context.Context) error
+
+// Check 为某个服务周期性执行的探测
+type Check struct {
+	Name             string        // 在日志和探测结果中标识该检查
+	Func             CheckFunc     // 探测函数
+	Interval         time.Duration // 两次探测的间隔，默认 10s
+	Timeout          time.Duration // 单次探测的超时时间，默认 1s
+	FailureThreshold int           // 健康的检查连续失败多少次后变为失败，默认 3
+	SuccessThreshold int           // 失败的检查连续成功多少次后恢复健康，默认 1
+}
+
+// CheckResult 某个检查当前状态的快照
+type CheckResult struct {
+	Name                 string
+	Healthy              bool
+	LastError            error
+	LastChecked          time.Time
+	LastSuccess          time.Time
+	Latency              time.Duration // 最近一次探测的耗时
+	ConsecutiveFailures  int
+	ConsecutiveSuccesses int
+}
+
+// Prober 在后台执行检查，并据此设置所属服务的状态：服务的所有检查都健康时为 SERVING，否则为 NOT_SERVING。
+// 检查只有在连续 FailureThreshold 次失败或 SuccessThreshold 次成功后才切换健康状态，
+// 单次探测变慢或失败不会让服务状态来回抖动。
+type Prober struct {
+	hs *Server
+
+	mu       sync.Mutex
+	services map[string][]*checkState
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+type checkState struct {
+	Check
+	service string
+	result  CheckResult
+}
+
+// NewProber 创建向 hs 报告状态的 Prober，调用 Start 之前不会执行检查
+func NewProber(hs *Server) *Prober {
+	return &Prober{
+		hs:       hs,
+		services: make(map[string][]*checkState),
+	}
+}
+
+// Register 为服务添加检查，检查通过之前服务为 NOT_SERVING。Start 之后注册的检查立即开始执行。
+func (p *Prober) Register(service string, checks ...Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range checks {
+		if c.Interval <= 0 {
+			c.Interval = defaultProbeInterval
+		}
+		if c.Timeout <= 0 {
+			c.Timeout = defaultProbeTimeout
+		}
+		if c.FailureThreshold <= 0 {
+			c.FailureThreshold = defaultFailureThreshold
+		}
+		if c.SuccessThreshold <= 0 {
+			c.SuccessThreshold = defaultSuccessThreshold
+		}
+		cs := &checkState{Check: c, service: service, result: CheckResult{Name: c.Name}}
+		p.services[service] = append(p.services[service], cs)
+		if p.ctx != nil {
+			p.startLocked(cs)
+		}
+	}
+	p.hs.SetServingStatus(service, p.statusLocked(service))
+}
+
+// Start 开始执行所有已注册的检查，直到调用 Stop
+func (p *Prober) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx != nil {
+		return
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for _, checks := range p.services {
+		for _, cs := range checks {
+			p.startLocked(cs)
+		}
+	}
+}
+
+// Stop 停止所有检查并等待正在进行的探测返回，服务状态保持不变
+func (p *Prober) Stop() {
+	p.mu.Lock()
+	if p.ctx == nil {
+		p.mu.Unlock()
+		return
+	}
+	p.cancel()
+	p.ctx = nil
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// Results 按服务返回所有检查的快照
+func (p *Prober) Results() map[string][]CheckResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results := make(map[string][]CheckResult, len(p.services))
+	for service, checks := range p.services {
+		for _, cs := range checks {
+			results[service] = append(results[service], cs.result)
+		}
+	}
+	return results
+}
+
+func (p *Prober) startLocked(cs *checkState) {
+	ctx := p.ctx
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(cs.Interval)
+		defer ticker.Stop()
+		for {
+			p.probe(ctx, cs)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (p *Prober) probe(ctx context.Context, cs *checkState) {
+	pctx, cancel := context.WithTimeout(ctx, cs.Timeout)
+	start := time.Now()
+	err := cs.Func(pctx)
+	latency := time.Since(start)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := &cs.result
+	r.LastError = err
+	r.LastChecked = start
+	r.Latency = latency
+	if err == nil {
+		r.LastSuccess = start
+		r.ConsecutiveSuccesses++
+		r.ConsecutiveFailures = 0
+	} else {
+		r.ConsecutiveFailures++
+		r.ConsecutiveSuccesses = 0
+	}
+
+	switch {
+	case !r.Healthy && r.ConsecutiveSuccesses >= cs.SuccessThreshold:
+		r.Healthy = true
+		log.Printf("health: check %s/%s is healthy after %d successes", cs.service, cs.Name, r.ConsecutiveSuccesses)
+	case r.Healthy && r.ConsecutiveFailures >= cs.FailureThreshold:
+		r.Healthy = false
+		log.Printf("health: check %s/%s is failing after %d failures: %v", cs.service, cs.Name, r.ConsecutiveFailures, err)
+	default:
+		return
+	}
+	p.hs.SetServingStatus(cs.service, p.statusLocked(cs.service))
+}
+
+func (p *Prober) statusLocked(service string) pb.HealthCheckResponse_ServingStatus {
+	for _, cs := range p.services[service] {
+		if !cs.result.Healthy {
+			return pb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return pb.HealthCheckResponse_SERVING
+}
+
+// Pinger *sql.DB 和大多数数据库客户端都实现了该接口
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingCheck 返回 ping 数据库的检查
+func PingCheck(db Pinger) CheckFunc {
+	return db.PingContext
+}
+
+// GRPCCheck 返回通过标准健康检查协议探测 cc 上 service 的检查，状态不是 SERVING 时失败
+func GRPCCheck(cc grpc.ClientConnInterface, service string) CheckFunc {
+	c := NewClient(cc)
+	return func(ctx context.Context) error {
+		st, err := c.Check(ctx, service)
+		if err != nil {
+			return err
+		}
+		if st != pb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("downstream %q is %v", service, st)
+		}
+		return nil
+	}
+}
+
+// errDiskUnsupported 在无法查询剩余磁盘空间的平台上由 DiskSpaceCheck 返回
+var errDiskUnsupported = errors.New("health: disk space check is not supported on this platform")
+
+// DiskSpaceCheck 返回检查磁盘空间的检查，path 所在文件系统的可用空间少于 minFree 字节时失败
+func DiskSpaceCheck(path string, minFree uint64) CheckFunc {
+	return func(context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("only %d bytes free on %s, want at least %d", free, path, minFree)
+		}
+		return nil
+	}
+}
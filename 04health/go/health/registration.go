@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"log"
+	"time"
+
+	pb "github.com/clin211/grpc/health/rpc"
+)
+
+const (
+	registrationTimeout  = 5 * time.Second
+	minRegistrationRetry = time.Second
+	maxRegistrationRetry = 30 * time.Second
+)
+
+// Registration 服务发现系统中的一条记录，例如 etcd 中的一个 key。
+// Deregister 可以删除记录，也可以把它标记为排空中，两种方式都应让客户端不再发送新的请求。
+type Registration interface {
+	Register(ctx context.Context) error
+	Deregister(ctx context.Context) error
+}
+
+// SyncRegistration 让 reg 跟随 hs 上 service 的状态，直到 ctx 结束：
+// 状态为 SERVING 时注册，否则注销，服务发现因此只返回健康的实例。
+// 调用失败时按指数退避重试，直到成功或状态再次变化。
+//
+// SyncRegistration 会阻塞。ctx 结束时不再改动 reg，关闭时调用方应当显式注销。
+func SyncRegistration(ctx context.Context, hs *Server, service string, reg Registration) {
+	updates, cancel := hs.Subscribe(service)
+	defer cancel()
+
+	var (
+		serving bool
+		first   = true
+		retry   <-chan time.Time
+		backoff = minRegistrationRetry
+	)
+	for {
+		select {
+		case st := <-updates:
+			// 状态没有变化时无需处理，等待中的重试仍然有效
+			if !first && (st == pb.HealthCheckResponse_SERVING) == serving {
+				continue
+			}
+			first = false
+			serving = st == pb.HealthCheckResponse_SERVING
+			backoff = minRegistrationRetry
+		case <-retry:
+		case <-ctx.Done():
+			return
+		}
+		retry = nil
+
+		cctx, ccancel := context.WithTimeout(ctx, registrationTimeout)
+		var err error
+		if serving {
+			err = reg.Register(cctx)
+		} else {
+			err = reg.Deregister(cctx)
+		}
+		ccancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("health: sync registration of %q (serving=%v) failed: %v, retrying in %v", service, serving, err, backoff)
+			retry = time.After(backoff)
+			backoff = min(backoff*2, maxRegistrationRetry)
+			continue
+		}
+		log.Printf("health: %q serving=%v, registration synced", service, serving)
+	}
+}
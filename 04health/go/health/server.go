@@ -0,0 +1,178 @@
+// Package health 实现 grpc.health.v1.Health 健康检查服务及其客户端。
+// Server 记录每个服务的状态并把变化推送给 Watch 的调用方；
+// Client 可以对任何实现了标准健康检查协议的服务端调用 Check 和 Watch。
+package health
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	pb "github.com/clin211/grpc/health/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server 实现 pb.HealthServer，空服务名 "" 表示整个服务器的健康状态
+type Server struct {
+	pb.UnimplementedHealthServer
+	mu        sync.RWMutex
+	shutdown  bool
+	statusMap map[string]pb.HealthCheckResponse_ServingStatus
+	// updates 以 Watch 的流为 key，进程内的订阅者以其通道为 key
+	updates map[string]map[any]chan pb.HealthCheckResponse_ServingStatus
+}
+
+// NewServer 创建健康检查服务，整体状态初始为 NOT_SERVING
+func NewServer() *Server {
+	return &Server{
+		statusMap: map[string]pb.HealthCheckResponse_ServingStatus{
+			"": pb.HealthCheckResponse_NOT_SERVING,
+		},
+		updates: make(map[string]map[any]chan pb.HealthCheckResponse_ServingStatus),
+	}
+}
+
+// Check 返回服务的当前状态，未知的服务返回 NotFound
+func (s *Server) Check(ctx context.Context, in *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if servingStatus, ok := s.statusMap[in.Service]; ok {
+		return &pb.HealthCheckResponse{
+			Status: servingStatus,
+		}, nil
+	}
+	return nil, status.Error(codes.NotFound, "service not found")
+}
+
+// Watch 先发送服务的当前状态，之后每次变化时再发送，直到调用方取消
+func (s *Server) Watch(in *pb.HealthCheckRequest, stream pb.Health_WatchServer) error {
+	service := in.Service
+
+	update := make(chan pb.HealthCheckResponse_ServingStatus, 1)
+
+	s.mu.Lock()
+
+	if servingStatus, ok := s.statusMap[service]; ok {
+		update <- servingStatus
+	} else {
+		update <- pb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+
+	if _, ok := s.updates[service]; !ok {
+		s.updates[service] = make(map[any]chan pb.HealthCheckResponse_ServingStatus)
+	}
+
+	s.updates[service][stream] = update
+	defer func() {
+		s.mu.Lock()
+		delete(s.updates[service], stream)
+		s.mu.Unlock()
+	}()
+	s.mu.Unlock()
+
+	var lastSentStatus pb.HealthCheckResponse_ServingStatus = -1
+	for {
+		select {
+		case servingStatus := <-update:
+			if lastSentStatus == servingStatus {
+				continue
+			}
+
+			lastSentStatus = servingStatus
+			err := stream.Send(&pb.HealthCheckResponse{
+				Status: servingStatus,
+			})
+			if err != nil {
+				return status.Error(codes.Canceled, "Stream has ended")
+			}
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "Stream has ended")
+		}
+	}
+}
+
+// Subscribe 相当于进程内的 Watch：返回的通道先收到服务的当前状态，之后收到每次变化。
+// 订阅者来不及读取的状态会被更新的状态替换。调用 cancel 取消订阅，通道不会被关闭。
+func (s *Server) Subscribe(service string) (updates <-chan pb.HealthCheckResponse_ServingStatus, cancel func()) {
+	update := make(chan pb.HealthCheckResponse_ServingStatus, 1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if servingStatus, ok := s.statusMap[service]; ok {
+		update <- servingStatus
+	} else {
+		update <- pb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	if _, ok := s.updates[service]; !ok {
+		s.updates[service] = make(map[any]chan pb.HealthCheckResponse_ServingStatus)
+	}
+	s.updates[service][update] = update
+
+	return update, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.updates[service], update)
+	}
+}
+
+// Statuses 返回所有服务状态的快照
+func (s *Server) Statuses() map[string]pb.HealthCheckResponse_ServingStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make(map[string]pb.HealthCheckResponse_ServingStatus, len(s.statusMap))
+	for service, servingStatus := range s.statusMap {
+		statuses[service] = servingStatus
+	}
+	return statuses
+}
+
+// SetServingStatus is called when need to reset the serving status of a service
+// or insert a new service entry into the statusMap.
+func (s *Server) SetServingStatus(service string, servingStatus pb.HealthCheckResponse_ServingStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		log.Printf("health: status changing for %s to %v is ignored because health service is shutdown", service, servingStatus)
+		return
+	}
+
+	s.setServingStatusLocked(service, servingStatus)
+}
+
+func (s *Server) setServingStatusLocked(service string, servingStatus pb.HealthCheckResponse_ServingStatus) {
+	s.statusMap[service] = servingStatus
+	for _, update := range s.updates[service] {
+		// Clears previous updates, that are not sent to the client, from the channel.
+		// This can happen if the client is not reading and the server gets flow control limited.
+		select {
+		case <-update:
+		default:
+		}
+		// Puts the most recent update to the channel.
+		update <- servingStatus
+	}
+}
+
+// Shutdown sets all serving status to NOT_SERVING, and configures the server to
+// ignore all future status changes.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown = true
+	for service := range s.statusMap {
+		s.setServingStatusLocked(service, pb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// Resume sets all serving status to SERVING, and configures the server to
+// accept all future status changes.
+func (s *Server) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown = false
+	for service := range s.statusMap {
+		s.setServingStatusLocked(service, pb.HealthCheckResponse_SERVING)
+	}
+}
@@ -0,0 +1,167 @@
+// Package lifecycle 各示例服务端共用的关闭流程。
+//
+// 收到 SIGINT、SIGTERM 或调用 Shutdown 时，Lifecycle 依次：
+//
+//  1. 关闭 Draining 通道，长连接的流据此发送最后的通知并返回；
+//  2. 把所有健康检查服务置为 NOT_SERVING，做健康检查的客户端不再选择本实例；
+//  3. 从服务发现中注销；
+//  4. 等待 DrainPeriod，让客户端和解析器感知到变化；
+//  5. 对每个 gRPC 服务器调用 GracefulStop，超过 GracePeriod 后调用 Stop；
+//     同时以相同的期限执行 OnStop，例如 HTTP 服务器的 Shutdown。
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/clin211/grpc/health/health"
+	"google.golang.org/grpc"
+)
+
+const (
+	DefaultDrainPeriod = 3 * time.Second
+	DefaultGracePeriod = 10 * time.Second
+)
+
+// Config Lifecycle 的配置
+type Config struct {
+	// Servers 在最后一步停止
+	Servers []*grpc.Server
+	// Health 最先被置为 NOT_SERVING
+	Health []*health.Server
+	// Deregister 从服务发现中注销本实例，可以为空
+	Deregister func(ctx context.Context) error
+	// OnStop 在最后一步与 gRPC 服务器的停止同时执行，用于排空期间仍需响应的服务，
+	// 例如 http.Server.Shutdown。ctx 在 GracePeriod 后到期。
+	OnStop []func(ctx context.Context) error
+	// DrainPeriod 注销后等待多久再停止服务器，默认 DefaultDrainPeriod，为负数时不等待
+	DrainPeriod time.Duration
+	// GracePeriod GracefulStop 的最长时间，超过后由 Stop 取消进行中的调用，默认 DefaultGracePeriod
+	GracePeriod time.Duration
+	// Signals 触发关闭的信号，默认 SIGINT 和 SIGTERM
+	Signals []os.Signal
+}
+
+// Lifecycle 负责一个进程的关闭流程
+type Lifecycle struct {
+	cfg Config
+
+	once     sync.Once
+	draining chan struct{}
+	done     chan struct{}
+	stop     func() // 停止接收信号
+}
+
+// New 创建 Lifecycle，收到 cfg.Signals 中的任一信号时开始关闭流程
+func New(cfg Config) *Lifecycle {
+	if cfg.DrainPeriod == 0 {
+		cfg.DrainPeriod = DefaultDrainPeriod
+	}
+	if cfg.GracePeriod <= 0 {
+		cfg.GracePeriod = DefaultGracePeriod
+	}
+	if len(cfg.Signals) == 0 {
+		cfg.Signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+
+	l := &Lifecycle{
+		cfg:      cfg,
+		draining: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, cfg.Signals...)
+	l.stop = func() { signal.Stop(ch) }
+	go func() {
+		select {
+		case sig := <-ch:
+			log.Printf("lifecycle: received %v, shutting down", sig)
+			l.Shutdown()
+		case <-l.draining:
+		}
+	}()
+	return l
+}
+
+// Draining 返回关闭开始时被关闭的通道。
+// 长连接的流应当监听它，发送最后一条消息后返回，GracefulStop 就不必等待这些流。
+func (l *Lifecycle) Draining() <-chan struct{} {
+	return l.draining
+}
+
+// Done 返回关闭流程结束时被关闭的通道
+func (l *Lifecycle) Done() <-chan struct{} {
+	return l.done
+}
+
+// Wait 阻塞到关闭流程结束。在 main 的最后调用，避免进程在调用排空前退出。
+func (l *Lifecycle) Wait() {
+	<-l.done
+}
+
+// Shutdown 执行一次关闭流程并阻塞到结束，并发和之后的调用等待第一次调用完成
+func (l *Lifecycle) Shutdown() {
+	l.once.Do(l.shutdown)
+	<-l.done
+}
+
+func (l *Lifecycle) shutdown() {
+	defer close(l.done)
+	l.stop()
+	close(l.draining)
+
+	for _, hs := range l.cfg.Health {
+		hs.Shutdown()
+	}
+
+	if l.cfg.Deregister != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), l.cfg.GracePeriod)
+		if err := l.cfg.Deregister(ctx); err != nil {
+			log.Printf("lifecycle: deregister: %v", err)
+		}
+		cancel()
+	}
+
+	if l.cfg.DrainPeriod > 0 {
+		log.Printf("lifecycle: draining for %v", l.cfg.DrainPeriod)
+		time.Sleep(l.cfg.DrainPeriod)
+	}
+
+	var wg sync.WaitGroup
+	stopCtx, cancel := context.WithTimeout(context.Background(), l.cfg.GracePeriod)
+	defer cancel()
+	for _, stop := range l.cfg.OnStop {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stop(stopCtx); err != nil {
+				log.Printf("lifecycle: stop: %v", err)
+			}
+		}()
+	}
+	for _, s := range l.cfg.Servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				s.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(l.cfg.GracePeriod):
+				log.Printf("lifecycle: graceful stop timed out after %v, forcing stop", l.cfg.GracePeriod)
+				s.Stop()
+				<-stopped
+			}
+		}()
+	}
+	wg.Wait()
+	log.Printf("lifecycle: shutdown complete")
+}
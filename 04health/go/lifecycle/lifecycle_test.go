@@ -0,0 +1,227 @@
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clin211/grpc/health/health"
+	pb "github.com/clin211/grpc/health/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testServer 在 bufconn 上运行的 gRPC 服务器，注册了健康检查服务
+type testServer struct {
+	srv  *grpc.Server
+	hs   *health.Server
+	conn *grpc.ClientConn
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	ts := &testServer{
+		srv: grpc.NewServer(),
+		hs:  health.NewServer(),
+	}
+	ts.hs.SetServingStatus("", pb.HealthCheckResponse_SERVING)
+	pb.RegisterHealthServer(ts.srv, ts.hs)
+	go ts.srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		ts.srv.Stop()
+	})
+	ts.conn = conn
+	return ts
+}
+
+// watch 打开一个 Watch 流，返回收到的状态和流结束时的错误
+func (ts *testServer) watch(t *testing.T, ctx context.Context) (<-chan pb.HealthCheckResponse_ServingStatus, <-chan error) {
+	t.Helper()
+	stream, err := pb.NewHealthClient(ts.conn).Watch(ctx, &pb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	statuses := make(chan pb.HealthCheckResponse_ServingStatus, 10)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			statuses <- resp.Status
+		}
+	}()
+	if got := <-statuses; got != pb.HealthCheckResponse_SERVING {
+		t.Fatalf("first Watch status = %v, want SERVING", got)
+	}
+	return statuses, errc
+}
+
+// waitStopped 轮询 Check 直到失败：GracefulStop 关闭监听并发送 GOAWAY 后新的 RPC 无法建立
+func (ts *testServer) waitStopped(t *testing.T) time.Time {
+	t.Helper()
+	client := pb.NewHealthClient(ts.conn)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := client.Check(context.Background(), &pb.HealthCheckRequest{}); err != nil {
+			return time.Now()
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("server still accepting RPCs")
+	return time.Time{}
+}
+
+// 关闭顺序：NOT_SERVING → 注销 → 等待 DrainPeriod → GracefulStop，进行中的流在 GracefulStop 后仍能正常结束
+func TestShutdownOrder(t *testing.T) {
+	const drain = 200 * time.Millisecond
+	ts := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statuses, errc := ts.watch(t, ctx)
+
+	var (
+		mu           sync.Mutex
+		deregistered time.Time
+		l            *Lifecycle
+	)
+	l = New(Config{
+		Servers: []*grpc.Server{ts.srv},
+		Health:  []*health.Server{ts.hs},
+		Deregister: func(context.Context) error {
+			if got := ts.hs.Statuses()[""]; got != pb.HealthCheckResponse_NOT_SERVING {
+				t.Errorf("status at deregister = %v, want NOT_SERVING", got)
+			}
+			select {
+			case <-l.Draining():
+			default:
+				t.Error("Draining not closed at deregister")
+			}
+			if _, err := pb.NewHealthClient(ts.conn).Check(context.Background(), &pb.HealthCheckRequest{}); err != nil {
+				t.Errorf("server stopped before deregister: %v", err)
+			}
+			mu.Lock()
+			deregistered = time.Now()
+			mu.Unlock()
+			return nil
+		},
+		DrainPeriod: drain,
+		GracePeriod: 5 * time.Second,
+	})
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		l.Shutdown()
+		close(shutdownDone)
+	}()
+
+	select {
+	case got := <-statuses:
+		if got != pb.HealthCheckResponse_NOT_SERVING {
+			t.Fatalf("Watch status after Shutdown = %v, want NOT_SERVING", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watcher did not see NOT_SERVING")
+	}
+
+	stopped := ts.waitStopped(t)
+	mu.Lock()
+	deregisteredAt := deregistered
+	mu.Unlock()
+	if deregisteredAt.IsZero() {
+		t.Fatal("server stopped without deregistering")
+	}
+	if d := stopped.Sub(deregisteredAt); d < drain {
+		t.Errorf("server stopped %v after deregister, want at least the drain period %v", d, drain)
+	}
+
+	// GracefulStop 等待进行中的流：流仍然存活，由客户端自己结束
+	select {
+	case err := <-errc:
+		t.Fatalf("stream ended by the server during GracefulStop: %v", err)
+	case <-shutdownDone:
+		t.Fatal("Shutdown returned while a stream was still open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	if err := <-errc; status.Code(err) != codes.Canceled {
+		t.Fatalf("stream error = %v, want Canceled", err)
+	}
+	select {
+	case <-shutdownDone:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the last stream ended")
+	}
+}
+
+// 超过 GracePeriod 仍有流没有结束时调用 Stop 强制关闭
+func TestShutdownForcesStopAfterGracePeriod(t *testing.T) {
+	const grace = 200 * time.Millisecond
+	ts := newTestServer(t)
+	_, errc := ts.watch(t, context.Background())
+
+	var onStopErr error
+	l := New(Config{
+		Servers:     []*grpc.Server{ts.srv},
+		Health:      []*health.Server{ts.hs},
+		DrainPeriod: -1,
+		GracePeriod: grace,
+		OnStop: []func(ctx context.Context) error{
+			func(ctx context.Context) error {
+				<-ctx.Done()
+				onStopErr = ctx.Err()
+				return nil
+			},
+		},
+	})
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		l.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not force Stop after the grace period")
+	}
+	if d := time.Since(start); d < grace {
+		t.Fatalf("Shutdown returned after %v, before the grace period %v", d, grace)
+	}
+	if onStopErr != context.DeadlineExceeded {
+		t.Errorf("OnStop ctx error = %v, want DeadlineExceeded", onStopErr)
+	}
+	select {
+	case err := <-errc:
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("stream error after Stop = %v, want Unavailable", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream still open after Stop")
+	}
+	select {
+	case <-l.Done():
+	default:
+		t.Fatal("Done not closed after Shutdown")
+	}
+}
@@ -2,138 +2,127 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"sync"
-
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
 	pb "github.com/clin211/grpc/health/rpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"github.com/clin211/grpc/mtls"
+	"google.golang.org/grpc"
 )
 
-type Server struct {
-	pb.UnimplementedHealthServer
-	mu        sync.RWMutex
-	shutdown  bool
-	statusMap map[string]pb.HealthCheckResponse_ServingStatus
-	updates   map[string]map[pb.Health_WatchServer]chan pb.HealthCheckResponse_ServingStatus
-}
-
-func NewServer() *Server {
-	return &Server{
-		statusMap: map[string]pb.HealthCheckResponse_ServingStatus{
-			"": pb.HealthCheckResponse_NOT_SERVING,
-		},
-		updates: make(map[string]map[pb.Health_WatchServer]chan pb.HealthCheckResponse_ServingStatus),
-	}
-}
-
-func (s *Server) Check(ctx context.Context, in *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	if servingStatus, ok := s.statusMap[in.Service]; ok {
-		return &pb.HealthCheckResponse{
-			Status: servingStatus,
-		}, nil
-	}
-	return nil, status.Error(codes.NotFound, "service not found")
-}
-
-func (s *Server) Watch(in *pb.HealthCheckRequest, stream pb.Health_WatchServer) error {
-	service := in.Service
-
-	update := make(chan pb.HealthCheckResponse_ServingStatus, 1)
+var (
+	port = flag.Int("port", 50051, "The server port")
+	// downstream 不为空时探测该地址上的健康检查服务，下游不可用时本服务也变为 NOT_SERVING
+	downstream = flag.String("downstream", "", "address of a downstream health service to probe")
+	// flip 不为 0 时按该间隔切换一个自定义检查的结果，便于观察连续失败阈值和 Watch 的效果
+	flip = flag.Duration("flip", 0, "toggle a custom check at this interval")
+	// httpAddr 不为空时在该地址上提供 /healthz、/readyz、/livez，供只支持 HTTP 的运维工具使用
+	httpAddr = flag.String("http", ":8081", "address of the HTTP health endpoints, empty to disable")
+)
 
-	s.mu.Lock()
+func main() {
+	flag.Parse()
 
-	if servingStatus, ok := s.statusMap[service]; ok {
-		update <- servingStatus
-	} else {
-		update <- pb.HealthCheckResponse_SERVICE_UNKNOWN
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
 	}
 
-	if _, ok := s.updates[service]; !ok {
-		s.updates[service] = make(map[pb.Health_WatchServer]chan pb.HealthCheckResponse_ServingStatus)
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
 	}
-
-	s.updates[service][stream] = update
-	defer func() {
-		s.mu.Lock()
-		delete(s.updates[service], stream)
-		s.mu.Unlock()
-	}()
-	s.mu.Unlock()
-
-	var lastSentStatus pb.HealthCheckResponse_ServingStatus = -1
-	for {
-		select {
-		case servingStatus := <-update:
-			if lastSentStatus == servingStatus {
-				continue
-			}
-
-			lastSentStatus = servingStatus
-			err := stream.Send(&pb.HealthCheckResponse{
-				Status: servingStatus,
-			})
-			if err != nil {
-				return status.Error(codes.Canceled, "Stream has ended")
-			}
-		case <-stream.Context().Done():
-			return status.Error(codes.Canceled, "Stream has ended")
+	s := grpc.NewServer(creds)
+	hs := health.NewServer()
+	pb.RegisterHealthServer(s, hs)
+
+	// 服务状态由探测结果决定，所有检查都通过时才是 SERVING
+	prober := health.NewProber(hs)
+	prober.Register("", health.Check{
+		Name:     "disk",
+		Func:     health.DiskSpaceCheck(os.TempDir(), 64<<20),
+		Interval: 5 * time.Second,
+	})
+	if *downstream != "" {
+		// 探测下游时使用与本服务相同的证书
+		dialCreds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+		if err != nil {
+			log.Fatalf("failed to load TLS credentials: %v", err)
 		}
-	}
-}
-
-// SetServingStatus is called when need to reset the serving status of a service
-// or insert a new service entry into the statusMap.
-func (s *Server) SetServingStatus(service string, servingStatus pb.HealthCheckResponse_ServingStatus) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.shutdown {
-		log.Printf("health: status changing for %s to %v is ignored because health service is shutdown", service, servingStatus)
-		return
-	}
-
-	s.setServingStatusLocked(service, servingStatus)
-}
-
-func (s *Server) setServingStatusLocked(service string, servingStatus pb.HealthCheckResponse_ServingStatus) {
-	s.statusMap[service] = servingStatus
-	for _, update := range s.updates[service] {
-		// Clears previous updates, that are not sent to the client, from the channel.
-		// This can happen if the client is not reading and the server gets flow control limited.
-		select {
-		case <-update:
-		default:
+		conn, err := grpc.NewClient(*downstream, dialCreds)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
 		}
-		// Puts the most recent update to the channel.
-		update <- servingStatus
+		defer conn.Close()
+		prober.Register("", health.Check{
+			Name:     "downstream",
+			Func:     health.GRPCCheck(conn, ""),
+			Interval: 2 * time.Second,
+		})
 	}
-}
-
-// Shutdown sets all serving status to NOT_SERVING, and configures the server to
-// ignore all future status changes.
-func (s *Server) Shutdown() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.shutdown = true
-	for service := range s.statusMap {
-		s.setServingStatusLocked(service, pb.HealthCheckResponse_NOT_SERVING)
+	if *flip > 0 {
+		var failing atomic.Bool
+		go func() {
+			for range time.Tick(*flip) {
+				failing.Store(!failing.Load())
+				log.Printf("flip check failing -> %v", failing.Load())
+			}
+		}()
+		prober.Register("", health.Check{
+			Name: "flip",
+			Func: func(context.Context) error {
+				if failing.Load() {
+					return errors.New("flipped")
+				}
+				return nil
+			},
+			Interval:         time.Second,
+			FailureThreshold: 3,
+			SuccessThreshold: 2,
+		})
 	}
-}
-
-// Resume sets all serving status to SERVING, and configures the server to
-// accept all future status changes.
-func (s *Server) Resume() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.shutdown = false
-	for service := range s.statusMap {
-		s.setServingStatusLocked(service, pb.HealthCheckResponse_SERVING)
+	prober.Start()
+
+	// 收到退出信号时先把状态置为 NOT_SERVING，让正在 Watch 的客户端感知到，再优雅退出。
+	// Watch 是不会主动结束的流，GracefulStop 会一直等待，所以超时后强制关闭。
+	cfg := lifecycle.Config{
+		Servers: []*grpc.Server{s},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop:      []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+		DrainPeriod: time.Second,
+		GracePeriod: 3 * time.Second,
 	}
-}
-
-func main() {
+	if *httpAddr != "" {
+		httpServer := &http.Server{Addr: *httpAddr, Handler: health.NewHTTPHandler(hs, prober)}
+		// 排空期间 /readyz 返回 503，和 gRPC 服务一起关闭
+		cfg.OnStop = append(cfg.OnStop, httpServer.Shutdown)
+		go func() {
+			log.Printf("http health endpoints listening at %v", *httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("failed to serve http: %v", err)
+			}
+		}()
+	}
+	lc := lifecycle.New(cfg)
 
+	go func() {
+		log.Printf("server listening at %v", lis.Addr())
+		if err := s.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+	lc.Wait()
+	prober.Stop()
 }
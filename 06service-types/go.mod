@@ -3,6 +3,8 @@ module github.com/clin211/grpc/service-types
 go 1.24.2
 
 require (
+	github.com/clin211/grpc/health v0.0.0-00010101000000-000000000000
+	github.com/clin211/grpc/mtls v0.0.0-00010101000000-000000000000
 	github.com/google/uuid v1.6.0
 	google.golang.org/grpc v1.73.0
 	google.golang.org/protobuf v1.36.6
@@ -14,3 +16,7 @@ require (
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
 )
+
+replace github.com/clin211/grpc/health => ../04health/go
+
+replace github.com/clin211/grpc/mtls => ../mtls
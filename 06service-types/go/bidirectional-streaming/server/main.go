@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -8,6 +9,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
+	"github.com/clin211/grpc/mtls"
 	pb "github.com/clin211/grpc/service-types/go/rpc"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
@@ -24,6 +29,9 @@ type chatService struct {
 
 	// 消息广播通道
 	broadcast chan *pb.ChatMessage
+
+	// 服务器开始关闭时关闭，用于通知所有连接
+	draining <-chan struct{}
 }
 
 // clientConnection 表示一个客户端连接
@@ -32,13 +40,16 @@ type clientConnection struct {
 	username string
 	stream   pb.ChatService_ChatServer
 	send     chan *pb.ChatMessage
+	// 发送协程退出时关闭
+	sendDone chan struct{}
 }
 
-// newChatService 创建聊天服务实例
-func newChatService() *chatService {
+// newChatService 创建聊天服务实例，draining 关闭时向所有用户发送关闭通知并结束连接
+func newChatService(draining <-chan struct{}) *chatService {
 	service := &chatService{
 		clients:   make(map[string]*clientConnection),
 		broadcast: make(chan *pb.ChatMessage, 100),
+		draining:  draining,
 	}
 
 	// 启动消息广播处理器
@@ -70,17 +81,39 @@ func (s *chatService) Chat(stream pb.ChatService_ChatServer) error {
 		}
 	}()
 
+	// 在单独的协程中接收客户端消息，主循环同时等待服务器关闭
+	msgs := make(chan *pb.ChatMessage)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
 	// 处理客户端消息
 	for {
-		// 接收客户端发送的消息
-		msg, err := stream.Recv()
-		if err == io.EOF {
-			log.Printf("Client %s disconnected", getClientID(client))
-			break
-		}
-		if err != nil {
-			log.Printf("Error receiving message: %v", err)
-			break
+		var msg *pb.ChatMessage
+		select {
+		case msg = <-msgs:
+		case err := <-recvErr:
+			if err == io.EOF {
+				log.Printf("Client %s disconnected", getClientID(client))
+			} else {
+				log.Printf("Error receiving message: %v", err)
+			}
+			return nil
+		case <-s.draining:
+			s.notifyShutdown(client)
+			return nil
 		}
 
 		// 处理第一条消息（用户加入）
@@ -90,6 +123,7 @@ func (s *chatService) Chat(stream pb.ChatService_ChatServer) error {
 				username: msg.Username,
 				stream:   stream,
 				send:     make(chan *pb.ChatMessage, 10),
+				sendDone: make(chan struct{}),
 			}
 
 			// 添加客户端到连接池
@@ -121,8 +155,29 @@ func (s *chatService) Chat(stream pb.ChatService_ChatServer) error {
 			s.handleMessage(msg, client)
 		}
 	}
+}
 
-	return nil
+// notifyShutdown 服务器关闭前向客户端发送最后一条系统消息。
+// 先停止发送协程，保证流上只有当前协程在发送。
+func (s *chatService) notifyShutdown(client *clientConnection) {
+	if client == nil {
+		return
+	}
+	s.removeClient(client)
+	<-client.sendDone
+
+	msg := &pb.ChatMessage{
+		MessageId: uuid.New().String(),
+		UserId:    "system",
+		Username:  "系统",
+		Content:   "服务器即将关闭，聊天室已结束，请稍后重新连接",
+		Timestamp: time.Now().Unix(),
+		Type:      pb.MessageType_SYSTEM,
+		RoomId:    "general",
+	}
+	if err := client.stream.Send(msg); err != nil {
+		log.Printf("Error sending shutdown notice to client %s: %v", client.username, err)
+	}
 }
 
 // handleMessage 处理接收到的消息
@@ -190,6 +245,7 @@ func (s *chatService) handleBroadcast() {
 
 // handleClientSend 处理单个客户端的消息发送
 func (s *chatService) handleClientSend(client *clientConnection) {
+	defer close(client.sendDone)
 	for msg := range client.send {
 		if err := client.stream.Send(msg); err != nil {
 			log.Printf("Error sending message to client %s: %v", client.username, err)
@@ -207,11 +263,31 @@ func getClientID(client *clientConnection) string {
 }
 
 func main() {
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
 	// 创建 gRPC 服务器
-	server := grpc.NewServer()
+	server := grpc.NewServer(creds)
+
+	// 健康检查服务，客户端可以在加入聊天前确认服务可用
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// 收到 SIGINT/SIGTERM 时先关闭 Draining，聊天服务向在线用户发送关闭通知并结束各自的聊天流；
+	// 随后置为 NOT_SERVING、等待排空、GracefulStop，超时后 Stop
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{server},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	})
 
 	// 注册聊天服务
-	chatSvc := newChatService()
+	chatSvc := newChatService(lc.Draining())
 	pb.RegisterChatServiceServer(server, chatSvc)
 
 	// 监听端口
@@ -224,7 +300,12 @@ func main() {
 	log.Println("Waiting for users to join the chat room...")
 
 	// 启动服务
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
-	}
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+	}()
+
+	// 等待关闭流程结束
+	lc.Wait()
 }
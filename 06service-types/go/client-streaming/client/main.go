@@ -11,10 +11,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/clin211/grpc/mtls"
 	pb "github.com/clin211/grpc/service-types/go/rpc"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 const (
@@ -22,9 +22,16 @@ const (
 )
 
 func main() {
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	creds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
 	// 建立连接
 	conn, err := grpc.NewClient("localhost:6003",
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+		creds)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"io"
@@ -10,6 +11,10 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
+	"github.com/clin211/grpc/mtls"
 	pb "github.com/clin211/grpc/service-types/go/rpc"
 	"google.golang.org/grpc"
 )
@@ -139,8 +144,28 @@ func (s *fileService) UploadFile(stream pb.FileService_UploadFileServer) error {
 }
 
 func main() {
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
 	// 创建 gRPC 服务器
-	server := grpc.NewServer()
+	server := grpc.NewServer(creds)
+
+	// 健康检查服务，客户端可以在开始上传前确认服务可用
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// 收到 SIGINT/SIGTERM 时置为 NOT_SERVING，客户端不再向本实例发起新的上传；
+	// 等待排空后 GracefulStop 等进行中的上传完成，超过 GracePeriod 后 Stop 中断未完成的上传
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{server},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	})
 
 	// 注册文件服务
 	fileSvc := newFileService()
@@ -156,7 +181,12 @@ func main() {
 	log.Printf("Upload directory: %s", fileSvc.uploadDir)
 
 	// 启动服务
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
-	}
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+	}()
+
+	// 等待关闭流程结束
+	lc.Wait()
 }
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
+	"github.com/clin211/grpc/mtls"
 	pb "github.com/clin211/grpc/service-types/go/rpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // StockService 实现
@@ -17,11 +25,14 @@ type stockService struct {
 	// 存储股票的基础价格，用于模拟价格变化
 	stockPrices map[string]float64
 	mutex       sync.RWMutex
+	// 服务器开始关闭时关闭，用于结束所有订阅
+	draining <-chan struct{}
 }
 
-// 初始化股票基础价格
-func newStockService() *stockService {
+// 初始化股票基础价格，draining 关闭时通知所有订阅者服务器即将关闭
+func newStockService(draining <-chan struct{}) *stockService {
 	return &stockService{
+		draining: draining,
 		stockPrices: map[string]float64{
 			"AAPL":  150.00,  // 苹果
 			"GOOGL": 2800.00, // 谷歌
@@ -96,6 +107,12 @@ func (s *stockService) SubscribeStockPrice(req *pb.StockSubscribeRequest, stream
 			// 客户端断开连接
 			log.Printf("Client %s disconnected", req.ClientId)
 			return nil
+
+		case <-s.draining:
+			// 服务器即将关闭：通过 trailer 和 UNAVAILABLE 状态通知客户端重新订阅
+			log.Printf("Server shutting down, ending subscription of client %s", req.ClientId)
+			stream.SetTrailer(metadata.Pairs("x-server-shutdown", "true"))
+			return status.Error(codes.Unavailable, "server is shutting down, please resubscribe")
 		}
 	}
 }
@@ -126,11 +143,31 @@ func (s *stockService) generatePriceUpdate(symbol string) *pb.StockPriceUpdate {
 }
 
 func main() {
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
 	// 创建 gRPC 服务器
-	server := grpc.NewServer()
+	server := grpc.NewServer(creds)
+
+	// 健康检查服务，客户端可以在订阅前确认服务可用
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// 收到 SIGINT/SIGTERM 时先关闭 Draining，进行中的价格订阅带上 x-server-shutdown trailer 以 UNAVAILABLE 结束，
+	// 客户端据此重新订阅到其它实例；随后置为 NOT_SERVING、等待排空、GracefulStop，超时后 Stop
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{server},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	})
 
 	// 注册股票服务
-	stockSvc := newStockService()
+	stockSvc := newStockService(lc.Draining())
 	pb.RegisterStockServiceServer(server, stockSvc)
 
 	// 监听端口
@@ -143,7 +180,12 @@ func main() {
 	log.Println("Available stocks: AAPL, GOOGL, TSLA, MSFT, AMZN, META, NVDA")
 
 	// 启动服务
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
-	}
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+	}()
+
+	// 等待关闭流程结束
+	lc.Wait()
 }
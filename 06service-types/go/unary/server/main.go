@@ -5,6 +5,10 @@ import (
 	"log"
 	"net"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
+	"github.com/clin211/grpc/mtls"
 	pb "github.com/clin211/grpc/service-types/go/rpc"
 	"google.golang.org/grpc"
 )
@@ -30,8 +34,28 @@ func (s *userService) GetUserInfo(ctx context.Context, req *pb.UserRequest) (*pb
 }
 
 func main() {
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to load TLS credentials: %v", err)
+	}
 	// 创建 gRPC 服务器
-	server := grpc.NewServer()
+	server := grpc.NewServer(creds)
+
+	// 健康检查服务，整体状态（空服务名）表示用户服务是否可用
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// 收到 SIGINT/SIGTERM 时置为 NOT_SERVING，等待客户端摘除本实例后 GracefulStop，
+	// 进行中的一元调用处理完即退出，超过 GracePeriod 后 Stop
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{server},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	})
 
 	// 注册服务
 	pb.RegisterUserServiceServer(server, &userService{})
@@ -45,7 +69,12 @@ func main() {
 	log.Println("Server started on :6001")
 
 	// 启动服务
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+
+	// 等待关闭流程结束
+	lc.Wait()
 }
@@ -0,0 +1,89 @@
+// Package auth 提供基于元数据的认证拦截器：
+// 从请求元数据中读取凭证，交给可替换的 Authenticator 校验，
+// 再把校验得到的 Principal 放入 context，供业务方法读取。
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// 认证相关的元数据键
+const (
+	HeaderAuthorization = "authorization"
+	bearerPrefix        = "Bearer "
+)
+
+var (
+	// ErrMissingCredentials 请求中没有携带凭证
+	ErrMissingCredentials = errors.New("缺少认证信息")
+	// ErrInvalidFormat 凭证格式不正确
+	ErrInvalidFormat = errors.New("无效的认证格式")
+	// ErrInvalidToken 凭证无效或已过期
+	ErrInvalidToken = errors.New("无效的认证令牌")
+)
+
+// Principal 认证通过后的调用方身份
+type Principal struct {
+	UserID      string   // 用户ID
+	Username    string   // 用户名
+	Roles       []string // 角色
+	Permissions []string // 权限
+}
+
+// HasPermission 判断调用方是否拥有 perms 中的任意一个权限
+func (p *Principal) HasPermission(perms ...string) bool {
+	for _, perm := range perms {
+		if slices.Contains(p.Permissions, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator 校验凭证并返回对应的调用方身份。
+// 凭证无效时应返回错误，拦截器会把它转换为 codes.Unauthenticated。
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// AuthenticatorFunc 让普通函数实现 Authenticator
+type AuthenticatorFunc func(ctx context.Context, token string) (*Principal, error)
+
+// Authenticate 实现 Authenticator
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+type principalKey struct{}
+
+// NewContext 返回携带 p 的新 context
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext 取出拦截器放入的调用方身份，公开方法中不存在
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// BearerToken 从元数据的 authorization 中取出 Bearer 令牌
+func BearerToken(md metadata.MD) (string, error) {
+	values := md.Get(HeaderAuthorization)
+	if len(values) == 0 || values[0] == "" {
+		return "", ErrMissingCredentials
+	}
+	if !strings.HasPrefix(values[0], bearerPrefix) {
+		return "", ErrInvalidFormat
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(values[0], bearerPrefix))
+	if token == "" {
+		return "", ErrInvalidFormat
+	}
+	return token, nil
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultRefreshLeeway 访问令牌在过期前多久刷新
+const DefaultRefreshLeeway = 30 * time.Second
+
+// Token 客户端持有的令牌
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time // 访问令牌的过期时间，零值表示未知
+}
+
+// valid 判断访问令牌在 now 之后 leeway 时是否仍然有效
+func (t *Token) valid(now time.Time, leeway time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || now.Add(leeway).Before(t.Expiry)
+}
+
+// LoginFunc 通过用户名密码等方式登录，获取新令牌
+type LoginFunc func(ctx context.Context) (*Token, error)
+
+// RefreshFunc 使用刷新令牌换取新令牌
+type RefreshFunc func(ctx context.Context, refreshToken string) (*Token, error)
+
+// TokenSource 缓存访问令牌，在过期前自动刷新。
+// 刷新失败（如会话已被吊销）时退回到重新登录。
+type TokenSource struct {
+	login   LoginFunc
+	refresh RefreshFunc
+	leeway  time.Duration
+	now     func() time.Time
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewTokenSource 创建令牌源，refresh 为空时令牌过期后直接重新登录
+func NewTokenSource(login LoginFunc, refresh RefreshFunc) *TokenSource {
+	return &TokenSource{
+		login:   login,
+		refresh: refresh,
+		leeway:  DefaultRefreshLeeway,
+		now:     time.Now,
+	}
+}
+
+// Token 返回一个有效的令牌，必要时刷新或重新登录。
+// 并发调用会等待同一次刷新，不会重复登录。
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token.valid(s.now(), s.leeway) {
+		return s.token, nil
+	}
+
+	// login 和 refresh 本身不需要携带令牌
+	ctx = WithoutCredentials(ctx)
+	if s.token != nil && s.token.RefreshToken != "" && s.refresh != nil {
+		token, err := s.refresh(ctx, s.token.RefreshToken)
+		if err == nil {
+			s.token = token
+			return token, nil
+		}
+		log.Printf("刷新令牌失败，重新登录: %v", err)
+	}
+
+	token, err := s.login(ctx)
+	if err != nil {
+		s.token = nil
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// Invalidate 丢弃缓存的访问令牌，下次使用时刷新。刷新令牌会保留
+func (s *TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil {
+		s.token = &Token{RefreshToken: s.token.RefreshToken}
+	}
+}
+
+type withoutCredentialsKey struct{}
+
+// WithoutCredentials 返回的 context 发起的调用不携带令牌，
+// 用于 Login 等公开方法，以及故意发送未认证请求的场景
+func WithoutCredentials(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutCredentialsKey{}, true)
+}
+
+func withoutCredentials(ctx context.Context) bool {
+	skip, _ := ctx.Value(withoutCredentialsKey{}).(bool)
+	return skip
+}
+
+// perRPCCredentials 从 TokenSource 取令牌写入 authorization 元数据
+type perRPCCredentials struct {
+	src        *TokenSource
+	requireTLS bool
+}
+
+// NewPerRPCCredentials 返回基于 src 的 credentials.PerRPCCredentials。
+// requireTLS 为 true 时只在 TLS 连接上发送令牌。
+func NewPerRPCCredentials(src *TokenSource, requireTLS bool) credentials.PerRPCCredentials {
+	return &perRPCCredentials{src: src, requireTLS: requireTLS}
+}
+
+// GetRequestMetadata 实现 credentials.PerRPCCredentials
+func (c *perRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if withoutCredentials(ctx) {
+		return nil, nil
+	}
+	token, err := c.src.Token(ctx)
+	if err != nil {
+		// 以 Unauthenticated 结束本次调用，而不是被当作连接错误
+		return nil, status.Errorf(codes.Unauthenticated, "获取令牌失败: %v", err)
+	}
+	return map[string]string{HeaderAuthorization: bearerPrefix + token.AccessToken}, nil
+}
+
+// RequireTransportSecurity 实现 credentials.PerRPCCredentials
+func (c *perRPCCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// UnaryClientInterceptor 返回一元调用的客户端拦截器：
+// 调用返回 Unauthenticated 时（如令牌已被吊销）丢弃缓存的令牌并重试一次。
+// 流式调用的认证错误要到接收消息时才能得知，无法透明重试，因此不提供流式版本。
+func UnaryClientInterceptor(src *TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated || withoutCredentials(ctx) {
+			return err
+		}
+		log.Printf("调用 %s 未通过认证，更新令牌后重试: %v", method, err)
+		src.Invalidate()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// DialOptions 返回让连接上的所有调用自动携带令牌的选项
+func DialOptions(src *TokenSource, requireTLS bool) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithPerRPCCredentials(NewPerRPCCredentials(src, requireTLS)),
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(src)),
+	}
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+const testTokenTTL = 10 * time.Minute
+
+// fakeIssuer 记录登录和刷新次数，签发的令牌在 testTokenTTL 后过期
+type fakeIssuer struct {
+	clock      *fakeClock
+	logins     atomic.Int32
+	refreshes  atomic.Int32
+	refreshErr error
+}
+
+func (f *fakeIssuer) token(kind string, n int32) *Token {
+	return &Token{
+		AccessToken:  fmt.Sprintf("%s-access-%d", kind, n),
+		RefreshToken: fmt.Sprintf("%s-refresh-%d", kind, n),
+		Expiry:       f.clock.Now().Add(testTokenTTL),
+	}
+}
+
+func (f *fakeIssuer) login(ctx context.Context) (*Token, error) {
+	if !withoutCredentials(ctx) {
+		return nil, errors.New("login called with credentials")
+	}
+	return f.token("login", f.logins.Add(1)), nil
+}
+
+func (f *fakeIssuer) refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	if !withoutCredentials(ctx) {
+		return nil, errors.New("refresh called with credentials")
+	}
+	n := f.refreshes.Add(1)
+	// 让并发的调用都在等待这次刷新
+	time.Sleep(20 * time.Millisecond)
+	if f.refreshErr != nil {
+		return nil, f.refreshErr
+	}
+	return f.token("refresh", n), nil
+}
+
+func newTestTokenSource() (*TokenSource, *fakeIssuer) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	f := &fakeIssuer{clock: clock}
+	src := NewTokenSource(f.login, f.refresh)
+	src.now = clock.Now
+	return src, f
+}
+
+// authorization 通过 PerRPCCredentials 取出本次调用携带的令牌
+func authorization(t *testing.T, src *TokenSource) string {
+	t.Helper()
+	md, err := NewPerRPCCredentials(src, false).GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Errorf("GetRequestMetadata: %v", err)
+		return ""
+	}
+	return md[HeaderAuthorization]
+}
+
+func TestTokenSourceRefreshesBeforeExpiry(t *testing.T) {
+	src, f := newTestTokenSource()
+	if got, want := authorization(t, src), "Bearer login-access-1"; got != want {
+		t.Fatalf("authorization = %q, want %q", got, want)
+	}
+
+	// 离过期还有超过 leeway 的时间，继续使用缓存的令牌
+	f.clock.Advance(testTokenTTL - DefaultRefreshLeeway - time.Second)
+	if got, want := authorization(t, src), "Bearer login-access-1"; got != want {
+		t.Fatalf("authorization before leeway = %q, want %q", got, want)
+	}
+
+	f.clock.Advance(2 * time.Second)
+	if got, want := authorization(t, src), "Bearer refresh-access-1"; got != want {
+		t.Fatalf("authorization within leeway = %q, want %q", got, want)
+	}
+	if logins, refreshes := f.logins.Load(), f.refreshes.Load(); logins != 1 || refreshes != 1 {
+		t.Fatalf("logins = %d, refreshes = %d, want 1 and 1", logins, refreshes)
+	}
+}
+
+// 令牌过期后并发的调用只触发一次刷新，全部使用刷新得到的令牌
+func TestTokenSourceSingleRefreshUnderConcurrency(t *testing.T) {
+	src, f := newTestTokenSource()
+	authorization(t, src)
+	f.clock.Advance(testTokenTTL)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	got := make([]string, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = authorization(t, src)
+		}()
+	}
+	wg.Wait()
+
+	if refreshes := f.refreshes.Load(); refreshes != 1 {
+		t.Fatalf("%d refreshes for %d concurrent calls, want 1", refreshes, callers)
+	}
+	if logins := f.logins.Load(); logins != 1 {
+		t.Fatalf("logins = %d, want 1", logins)
+	}
+	for i, auth := range got {
+		if auth != "Bearer refresh-access-1" {
+			t.Fatalf("caller %d sent %q, want the refreshed token", i, auth)
+		}
+	}
+}
+
+// 刷新失败（例如会话已被吊销）时重新登录
+func TestTokenSourceFallsBackToLogin(t *testing.T) {
+	src, f := newTestTokenSource()
+	f.refreshErr = ErrRevokedToken
+	authorization(t, src)
+	f.clock.Advance(testTokenTTL)
+
+	if got, want := authorization(t, src), "Bearer login-access-2"; got != want {
+		t.Fatalf("authorization = %q, want %q", got, want)
+	}
+	if logins, refreshes := f.logins.Load(), f.refreshes.Load(); logins != 2 || refreshes != 1 {
+		t.Fatalf("logins = %d, refreshes = %d, want 2 and 1", logins, refreshes)
+	}
+}
+
+// Invalidate 之后即使令牌没有过期也会刷新，并保留刷新令牌
+func TestTokenSourceInvalidate(t *testing.T) {
+	src, f := newTestTokenSource()
+	authorization(t, src)
+	src.Invalidate()
+	if got, want := authorization(t, src), "Bearer refresh-access-1"; got != want {
+		t.Fatalf("authorization after Invalidate = %q, want %q", got, want)
+	}
+	if logins := f.logins.Load(); logins != 1 {
+		t.Fatalf("logins = %d, want 1", logins)
+	}
+}
+
+func TestPerRPCCredentialsWithoutCredentials(t *testing.T) {
+	src, f := newTestTokenSource()
+	md, err := NewPerRPCCredentials(src, false).GetRequestMetadata(WithoutCredentials(context.Background()))
+	if err != nil || md != nil {
+		t.Fatalf("GetRequestMetadata = %v, %v, want no metadata", md, err)
+	}
+	if logins := f.logins.Load(); logins != 0 {
+		t.Fatalf("logins = %d, want 0", logins)
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Denylist 内存中的吊销列表，记录被吊销的令牌ID或会话ID。
+// 每条记录只需要保留到对应令牌过期，之后令牌本身就会校验失败。
+type Denylist struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// NewDenylist 创建吊销列表
+func NewDenylist() *Denylist {
+	return &Denylist{entries: make(map[string]time.Time)}
+}
+
+// Add 吊销 id 直到 until，同时清理已过期的记录
+func (d *Denylist) Add(id string, until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.add(id, until)
+}
+
+// AddIfAbsent 在 id 尚未被吊销时吊销它并返回 true；已被吊销时返回 false。
+// 检查和吊销在同一把锁内完成，并发调用中只有一个会返回 true。
+func (d *Denylist) AddIfAbsent(id string, until time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if exp, ok := d.entries[id]; ok && time.Now().Before(exp) {
+		return false
+	}
+	d.add(id, until)
+	return true
+}
+
+// add 在持有锁时调用
+func (d *Denylist) add(id string, until time.Time) {
+	now := time.Now()
+	for k, exp := range d.entries {
+		if now.After(exp) {
+			delete(d.entries, k)
+		}
+	}
+	if exp, ok := d.entries[id]; !ok || until.After(exp) {
+		d.entries[id] = until
+	}
+}
+
+// Contains 判断 id 是否已被吊销
+func (d *Denylist) Contains(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	exp, ok := d.entries[id]
+	return ok && time.Now().Before(exp)
+}
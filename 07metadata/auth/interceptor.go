@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Rule 单个方法的访问规则。零值表示只要求通过认证。
+type Rule struct {
+	Public      bool     // 公开方法，不做认证
+	Permissions []string // 需要拥有其中任意一个权限，为空表示不检查权限
+}
+
+// Rules 方法访问规则表。
+// 键为完整方法名（如 "/user.UserService/Login"），
+// 或 "/user.UserService/*" 表示该服务下的所有方法。
+// 未出现在表中的方法默认需要认证。
+type Rules map[string]Rule
+
+// lookup 按完整方法名、服务通配符的顺序查找规则
+func (r Rules) lookup(fullMethod string) Rule {
+	if rule, ok := r[fullMethod]; ok {
+		return rule
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		if rule, ok := r[fullMethod[:i]+"/*"]; ok {
+			return rule
+		}
+	}
+	return Rule{}
+}
+
+// authorize 按规则对一次调用进行认证和鉴权，返回携带调用方身份的 context
+func authorize(ctx context.Context, a Authenticator, rules Rules, fullMethod string) (context.Context, error) {
+	rule := rules.lookup(fullMethod)
+	if rule.Public {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, err := BearerToken(md)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	p, err := a.Authenticate(ctx, token)
+	if err != nil {
+		log.Printf("认证失败 - Method: %s, Error: %v", fullMethod, err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if len(rule.Permissions) > 0 && !p.HasPermission(rule.Permissions...) {
+		log.Printf("权限不足 - Method: %s, UserID: %s, 需要: %v", fullMethod, p.UserID, rule.Permissions)
+		return nil, status.Error(codes.PermissionDenied, "权限不足")
+	}
+	return NewContext(ctx, p), nil
+}
+
+// UnaryServerInterceptor 返回一元调用的认证拦截器
+func UnaryServerInterceptor(a Authenticator, rules Rules) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, a, rules, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 返回流式调用的认证拦截器
+func StreamServerInterceptor(a Authenticator, rules Rules) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), a, rules, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream 替换 ServerStream 的 context，使处理函数能取到调用方身份
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 令牌类型，写在 typ 声明中，防止刷新令牌被当作访问令牌使用
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+// ErrRevokedToken 令牌已被吊销
+var ErrRevokedToken = errors.New("令牌已被吊销")
+
+// Key 带 ID 的签名密钥，ID 会写入 JWT 头部的 kid，验签时据此选择密钥。
+// 轮换密钥时，旧密钥可以只保留 Verify 用于校验已签发的令牌。
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	Sign   any // 签名密钥：HS256 为 []byte，RS256 为 *rsa.PrivateKey，EdDSA 为 ed25519.PrivateKey
+	Verify any // 验签密钥：HS256 为 []byte，RS256 为 *rsa.PublicKey，EdDSA 为 ed25519.PublicKey
+}
+
+// NewHMACKey 创建 HS256 密钥
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, Sign: secret, Verify: secret}
+}
+
+// NewRSAKey 创建 RS256 密钥
+func NewRSAKey(id string, priv *rsa.PrivateKey) Key {
+	return Key{ID: id, Method: jwt.SigningMethodRS256, Sign: priv, Verify: &priv.PublicKey}
+}
+
+// NewEd25519Key 创建 EdDSA 密钥
+func NewEd25519Key(id string, priv ed25519.PrivateKey) Key {
+	return Key{ID: id, Method: jwt.SigningMethodEdDSA, Sign: priv, Verify: priv.Public()}
+}
+
+// Claims 令牌中携带的声明
+type Claims struct {
+	jwt.RegisteredClaims
+	Username    string   `json:"name,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+	TokenType   string   `json:"typ"`
+	SessionID   string   `json:"sid"` // 同一次登录及其后续刷新得到的令牌共享会话ID
+}
+
+// TokenPair 一次登录或刷新签发的令牌
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // 访问令牌的过期时间
+}
+
+// JWTConfig JWTManager 的配置
+type JWTConfig struct {
+	// Issuer 写入 iss 并在验签时校验
+	Issuer string
+	// Keys 所有可用于验签的密钥
+	Keys []Key
+	// SigningKeyID 签发时使用的密钥ID，默认为 Keys 中的第一个
+	SigningKeyID string
+	// AccessTTL 访问令牌有效期，默认 DefaultAccessTTL
+	AccessTTL time.Duration
+	// RefreshTTL 刷新令牌有效期，默认 DefaultRefreshTTL
+	RefreshTTL time.Duration
+	// Denylist 吊销列表，默认使用新的内存吊销列表
+	Denylist *Denylist
+}
+
+// JWTManager 签发、校验、刷新和吊销 JWT，实现 Authenticator
+type JWTManager struct {
+	cfg     JWTConfig
+	signing Key
+	keys    map[string]Key
+	parser  *jwt.Parser
+}
+
+// NewJWTManager 创建 JWTManager
+func NewJWTManager(cfg JWTConfig) (*JWTManager, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("至少需要一个密钥")
+	}
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = DefaultAccessTTL
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = DefaultRefreshTTL
+	}
+	if cfg.Denylist == nil {
+		cfg.Denylist = NewDenylist()
+	}
+	if cfg.SigningKeyID == "" {
+		cfg.SigningKeyID = cfg.Keys[0].ID
+	}
+
+	m := &JWTManager{cfg: cfg, keys: make(map[string]Key)}
+	var methods []string
+	for _, k := range cfg.Keys {
+		if _, ok := m.keys[k.ID]; ok {
+			return nil, fmt.Errorf("密钥ID重复: %s", k.ID)
+		}
+		m.keys[k.ID] = k
+		methods = append(methods, k.Method.Alg())
+	}
+	signing, ok := m.keys[cfg.SigningKeyID]
+	if !ok || signing.Sign == nil {
+		return nil, fmt.Errorf("签名密钥不存在: %s", cfg.SigningKeyID)
+	}
+	m.signing = signing
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	m.parser = jwt.NewParser(opts...)
+	return m, nil
+}
+
+// Issue 为 p 签发一对新的访问令牌和刷新令牌，开始一个新会话
+func (m *JWTManager) Issue(p *Principal) (*TokenPair, error) {
+	return m.issue(p, newID())
+}
+
+func (m *JWTManager) issue(p *Principal, sessionID string) (*TokenPair, error) {
+	now := time.Now()
+	access, err := m.sign(p, sessionID, TokenTypeAccess, now, m.cfg.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := m.sign(p, sessionID, TokenTypeRefresh, now, m.cfg.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresAt: now.Add(m.cfg.AccessTTL)}, nil
+}
+
+func (m *JWTManager) sign(p *Principal, sessionID, typ string, now time.Time, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newID(),
+			Issuer:    m.cfg.Issuer,
+			Subject:   p.UserID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Username:    p.Username,
+		Roles:       p.Roles,
+		Permissions: p.Permissions,
+		TokenType:   typ,
+		SessionID:   sessionID,
+	}
+	token := jwt.NewWithClaims(m.signing.Method, claims)
+	token.Header["kid"] = m.signing.ID
+	return token.SignedString(m.signing.Sign)
+}
+
+// Authenticate 校验访问令牌，实现 Authenticator
+func (m *JWTManager) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	claims, err := m.verify(token, TokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+	return claims.principal(), nil
+}
+
+// Refresh 用刷新令牌换取一对新令牌，同时返回令牌对应的调用方身份。
+// 旧的刷新令牌随即被吊销（轮换）；已轮换的刷新令牌再次出现说明可能被盗用，
+// 此时整个会话都会被吊销，攻击者和合法用户都需要重新登录。
+func (m *JWTManager) Refresh(ctx context.Context, refreshToken string) (*TokenPair, *Principal, error) {
+	claims, err := m.parse(refreshToken, TokenTypeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.cfg.Denylist.Contains(claims.SessionID) {
+		return nil, nil, ErrRevokedToken
+	}
+	// 检查并吊销旧的刷新令牌必须是一步操作，否则两个并发的刷新请求都能换到新令牌
+	if !m.cfg.Denylist.AddIfAbsent(claims.ID, claims.ExpiresAt.Time) {
+		m.cfg.Denylist.Add(claims.SessionID, time.Now().Add(m.cfg.RefreshTTL))
+		return nil, nil, fmt.Errorf("%w: 刷新令牌被重复使用，会话已吊销", ErrRevokedToken)
+	}
+
+	p := claims.principal()
+	pair, err := m.issue(p, claims.SessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, p, nil
+}
+
+// Revoke 吊销令牌所属的整个会话，用于退出登录。访问令牌和刷新令牌都可以
+func (m *JWTManager) Revoke(ctx context.Context, token string) error {
+	claims, err := m.parse(token, "")
+	if err != nil {
+		return err
+	}
+	// 会话中最晚过期的是刷新令牌，吊销记录保留到那时即可
+	m.cfg.Denylist.Add(claims.SessionID, claims.IssuedAt.Add(m.cfg.RefreshTTL))
+	return nil
+}
+
+// verify 校验签名、过期时间、类型和吊销列表
+func (m *JWTManager) verify(token, typ string) (*Claims, error) {
+	claims, err := m.parse(token, typ)
+	if err != nil {
+		return nil, err
+	}
+	if m.cfg.Denylist.Contains(claims.ID) || m.cfg.Denylist.Contains(claims.SessionID) {
+		return nil, ErrRevokedToken
+	}
+	return claims, nil
+}
+
+// parse 校验签名、过期时间和类型，typ 为空时不检查类型
+func (m *JWTManager) parse(token, typ string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := m.parser.ParseWithClaims(token, claims, m.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if typ != "" && claims.TokenType != typ {
+		return nil, fmt.Errorf("%w: 令牌类型应为 %s", ErrInvalidToken, typ)
+	}
+	return claims, nil
+}
+
+// keyFunc 按 kid 选择验签密钥，并确认算法与密钥一致
+func (m *JWTManager) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("未知的密钥ID: %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("密钥 %s 不能用于算法 %s", kid, token.Method.Alg())
+	}
+	return key.Verify, nil
+}
+
+func (c *Claims) principal() *Principal {
+	return &Principal{
+		UserID:      c.Subject,
+		Username:    c.Username,
+		Roles:       c.Roles,
+		Permissions: c.Permissions,
+	}
+}
+
+// newID 生成令牌ID和会话ID
+func newID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testPrincipal = &Principal{UserID: "u1", Username: "alice", Roles: []string{"admin"}, Permissions: []string{"user:read"}}
+
+// testKeys 返回 HS256、RS256、EdDSA 三种密钥，ID 分别为 hs、rs、ed
+func testKeys(t *testing.T) []Key {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成 RSA 密钥失败: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("生成 Ed25519 密钥失败: %v", err)
+	}
+	return []Key{
+		NewHMACKey("hs", []byte("0123456789abcdef0123456789abcdef")),
+		NewRSAKey("rs", rsaKey),
+		NewEd25519Key("ed", edKey),
+	}
+}
+
+func newTestManager(t *testing.T, keys []Key, signingKeyID string) *JWTManager {
+	t.Helper()
+	m, err := NewJWTManager(JWTConfig{Issuer: "test", Keys: keys, SigningKeyID: signingKeyID})
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	return m
+}
+
+// forge 用任意算法、kid 和签名密钥签发一个声明有效的访问令牌
+func forge(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	now := time.Now()
+	token := jwt.NewWithClaims(method, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newID(),
+			Issuer:    "test",
+			Subject:   "u1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		TokenType: TokenTypeAccess,
+		SessionID: newID(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("签发令牌失败: %v", err)
+	}
+	return signed
+}
+
+// 每种密钥签发的令牌都按 kid 找到对应密钥验签，签发密钥不同也不影响
+func TestKeySelectionByKid(t *testing.T) {
+	keys := testKeys(t)
+	verifier := newTestManager(t, keys, "hs")
+	for _, k := range keys {
+		t.Run(k.ID, func(t *testing.T) {
+			pair, err := newTestManager(t, keys, k.ID).Issue(testPrincipal)
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			token, _, err := jwt.NewParser().ParseUnverified(pair.AccessToken, &Claims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if kid := token.Header["kid"]; kid != k.ID {
+				t.Fatalf("kid = %v, want %s", kid, k.ID)
+			}
+			p, err := verifier.Authenticate(context.Background(), pair.AccessToken)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if p.UserID != testPrincipal.UserID || p.Username != testPrincipal.Username {
+				t.Fatalf("Authenticate = %+v, want %+v", p, testPrincipal)
+			}
+		})
+	}
+}
+
+func TestRejectsUnknownOrWrongKey(t *testing.T) {
+	keys := testKeys(t)
+	m := newTestManager(t, keys, "hs")
+	otherSecret := []byte("fedcba9876543210fedcba9876543210")
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown kid", forge(t, jwt.SigningMethodHS256, "retired", keys[0].Sign)},
+		{"missing kid", forge(t, jwt.SigningMethodHS256, "", keys[0].Sign)},
+		{"kid of another secret", forge(t, jwt.SigningMethodHS256, "hs", otherSecret)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Authenticate(context.Background(), tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Authenticate: err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+// 算法固定在密钥上：头部 alg 与 kid 对应密钥的类型不一致的令牌一律拒绝
+func TestAlgorithmPinning(t *testing.T) {
+	keys := testKeys(t)
+	hs, rs, ed := keys[0], keys[1], keys[2]
+	m := newTestManager(t, keys, "rs")
+
+	// 经典的算法混淆攻击：把公开的 RSA 公钥当作 HMAC 密钥签名，kid 指向 RSA 密钥
+	der, err := x509.MarshalPKIXPublicKey(rs.Verify)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"HS256 signed with the RSA public key", forge(t, jwt.SigningMethodHS256, "rs", pubPEM)},
+		{"HS256 signed with the RSA public key DER", forge(t, jwt.SigningMethodHS256, "rs", der)},
+		{"RS256 token with the HMAC kid", forge(t, jwt.SigningMethodRS256, "hs", rs.Sign)},
+		{"EdDSA token with the RSA kid", forge(t, jwt.SigningMethodEdDSA, "rs", ed.Sign)},
+		{"HS256 token with the EdDSA kid", forge(t, jwt.SigningMethodHS256, "ed", hs.Sign)},
+		{"alg none", forge(t, jwt.SigningMethodNone, "rs", jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Authenticate(context.Background(), tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Authenticate: err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+
+	// 只配置了 RS256 密钥时，HS256 的令牌连 kid 都不会查找
+	rsOnly := newTestManager(t, []Key{rs}, "")
+	if _, err := rsOnly.Authenticate(context.Background(), forge(t, jwt.SigningMethodHS256, "rs", pubPEM)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("RS256-only manager accepted an HS256 token: %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	m := newTestManager(t, testKeys(t)[:1], "")
+	sessionID := newID()
+	expired, err := m.sign(testPrincipal, sessionID, TokenTypeAccess, time.Now().Add(-time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := m.Authenticate(context.Background(), expired); !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("Authenticate expired token: err = %v, want an expired ErrInvalidToken", err)
+	}
+
+	expiredRefresh, err := m.sign(testPrincipal, sessionID, TokenTypeRefresh, time.Now().Add(-8*24*time.Hour), DefaultRefreshTTL)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, _, err := m.Refresh(context.Background(), expiredRefresh); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Refresh with expired token: err = %v, want ErrInvalidToken", err)
+	}
+
+	// 没有 exp 的令牌同样拒绝
+	noExp := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{TokenType: TokenTypeAccess})
+	noExp.Header["kid"] = "hs"
+	signed, err := noExp.SignedString(m.signing.Sign)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if _, err := m.Authenticate(context.Background(), signed); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Authenticate token without exp: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+// 刷新令牌与访问令牌不能互相替代
+func TestTokenType(t *testing.T) {
+	m := newTestManager(t, testKeys(t)[:1], "")
+	pair, err := m.Issue(testPrincipal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := m.Authenticate(context.Background(), pair.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Authenticate with refresh token: err = %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := m.Refresh(context.Background(), pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Refresh with access token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+// 刷新后旧刷新令牌失效；旧刷新令牌被重复使用时整个会话被吊销
+func TestRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, testKeys(t)[:1], "")
+	first, err := m.Issue(testPrincipal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	second, p, err := m.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if p.UserID != testPrincipal.UserID {
+		t.Fatalf("Refresh principal = %+v, want %+v", p, testPrincipal)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("Refresh returned the old tokens")
+	}
+	// 轮换只吊销旧的刷新令牌，旧访问令牌在过期前仍然有效
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		if _, err := m.Authenticate(ctx, token); err != nil {
+			t.Fatalf("Authenticate after rotation: %v", err)
+		}
+	}
+
+	// 重放已轮换的刷新令牌：会话中的所有令牌都被吊销
+	if _, _, err := m.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRevokedToken) {
+		t.Fatalf("Refresh with rotated token: err = %v, want ErrRevokedToken", err)
+	}
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		if _, err := m.Authenticate(ctx, token); !errors.Is(err, ErrRevokedToken) {
+			t.Fatalf("Authenticate after reuse: err = %v, want ErrRevokedToken", err)
+		}
+	}
+	if _, _, err := m.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrRevokedToken) {
+		t.Fatalf("Refresh in revoked session: err = %v, want ErrRevokedToken", err)
+	}
+
+	// 其它会话不受影响
+	other, err := m.Issue(testPrincipal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := m.Authenticate(ctx, other.AccessToken); err != nil {
+		t.Fatalf("Authenticate in another session: %v", err)
+	}
+}
+
+// 同一个刷新令牌并发刷新，只有一个请求成功
+func TestConcurrentRefresh(t *testing.T) {
+	m := newTestManager(t, testKeys(t)[:1], "")
+	pair, err := m.Issue(testPrincipal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := m.Refresh(context.Background(), pair.RefreshToken); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent refreshes succeeded, want 1", succeeded)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, testKeys(t)[:1], "")
+	pair, err := m.Issue(testPrincipal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if err := m.Revoke(ctx, pair.AccessToken); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := m.Authenticate(ctx, pair.AccessToken); !errors.Is(err, ErrRevokedToken) {
+		t.Fatalf("Authenticate after Revoke: err = %v, want ErrRevokedToken", err)
+	}
+	if _, _, err := m.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrRevokedToken) {
+		t.Fatalf("Refresh after Revoke: err = %v, want ErrRevokedToken", err)
+	}
+}
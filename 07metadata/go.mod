@@ -3,7 +3,10 @@ module github.com/clin211/grpc/metadata
 go 1.24.2
 
 require (
+	github.com/clin211/grpc/health v0.0.0-00010101000000-000000000000
+	github.com/clin211/grpc/mtls v0.0.0-00010101000000-000000000000
 	github.com/golang-jwt/jwt/v5 v5.2.2
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463
 	google.golang.org/grpc v1.73.0
 	google.golang.org/protobuf v1.36.6
 )
@@ -12,5 +15,8 @@ require (
 	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
 )
+
+replace github.com/clin211/grpc/health => ../04health/go
+
+replace github.com/clin211/grpc/mtls => ../mtls
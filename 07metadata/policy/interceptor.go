@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/clin211/grpc/metadata/auth"
+)
+
+// errorDomain ErrorInfo 中的错误域
+const errorDomain = "policy.metadata.clin211.github.com"
+
+// authorize 评估调用方能否执行 fullMethod。
+// context 中没有调用方身份说明该方法是公开的，直接放行；
+// 因此必须把认证拦截器放在本拦截器之前。
+func (e *Engine) authorize(ctx context.Context, fullMethod string) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	d := e.Evaluate(p, fullMethod)
+	if d.Allowed {
+		return nil
+	}
+
+	log.Printf("授权拒绝 - Method: %s, UserID: %s, Reason: %s, %s", fullMethod, p.UserID, d.Reason, d.Message)
+	st := status.New(codes.PermissionDenied, d.Message)
+	info := &errdetails.ErrorInfo{
+		Reason: d.Reason,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"method":  fullMethod,
+			"user_id": p.UserID,
+		},
+	}
+	if d.Role != "" {
+		info.Metadata["role"] = d.Role
+	}
+	if detailed, err := st.WithDetails(info); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// UnaryServerInterceptor 返回一元调用的授权拦截器
+func UnaryServerInterceptor(e *Engine) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := e.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 返回流式调用的授权拦截器
+func StreamServerInterceptor(e *Engine) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := e.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/clin211/grpc/metadata/auth"
+	rpc "github.com/clin211/grpc/metadata/proto"
+)
+
+const (
+	methodGet    = "/user.UserService/GetUser"
+	methodCreate = "/user.UserService/CreateUser"
+	methodOther  = "/other.OtherService/Do"
+)
+
+var now = time.Unix(1700000000, 0)
+
+func newTestEngine() *Engine {
+	e := NewEngine()
+	e.now = func() time.Time { return now }
+	e.SetUserPermissions(&rpc.UserPermissions{
+		UserId: "admin",
+		RolePermissions: map[string]*rpc.RolePermission{
+			"admin": {AllowedActions: []string{"/user.UserService/*"}},
+		},
+	})
+	e.SetUserPermissions(&rpc.UserPermissions{
+		UserId: "viewer",
+		RolePermissions: map[string]*rpc.RolePermission{
+			"viewer": {AllowedActions: []string{methodGet}},
+			"editor": {AllowedActions: []string{methodCreate}, ExpiresAt: now.Unix()},
+		},
+	})
+	e.SetUserPermissions(&rpc.UserPermissions{
+		UserId: "ops",
+		RolePermissions: map[string]*rpc.RolePermission{
+			"admin":   {AllowedActions: []string{"*"}},
+			"auditor": {DeniedActions: []string{methodCreate}},
+		},
+	})
+	return e
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal // 为空表示公开方法，context 中没有调用方身份
+		method    string
+		reason    string // 为空表示放行
+		role      string
+	}{
+		{name: "allowed by wildcard", principal: &auth.Principal{UserID: "admin", Roles: []string{"admin"}}, method: methodCreate},
+		{name: "allowed by full method", principal: &auth.Principal{UserID: "viewer", Roles: []string{"viewer"}}, method: methodGet},
+		{name: "public method", method: methodCreate},
+		{name: "deny wins over allow", principal: &auth.Principal{UserID: "ops", Roles: []string{"admin", "auditor"}}, method: methodCreate, reason: ReasonDenied, role: "auditor"},
+		{name: "expired role", principal: &auth.Principal{UserID: "viewer", Roles: []string{"viewer", "editor"}}, method: methodCreate, reason: ReasonRoleExpired, role: "editor"},
+		{name: "missing roles claim", principal: &auth.Principal{UserID: "admin"}, method: methodGet, reason: ReasonNoPermissions},
+		{name: "role not configured for user", principal: &auth.Principal{UserID: "viewer", Roles: []string{"admin"}}, method: methodGet, reason: ReasonNoPermissions},
+		{name: "unknown user", principal: &auth.Principal{UserID: "nobody", Roles: []string{"admin"}}, method: methodGet, reason: ReasonNoPermissions},
+		// 没有任何规则提到的方法按默认拒绝处理
+		{name: "unknown method falls back to deny", principal: &auth.Principal{UserID: "admin", Roles: []string{"admin"}}, method: methodOther, reason: ReasonNotAllowed},
+		{name: "catch-all allows unknown method", principal: &auth.Principal{UserID: "ops", Roles: []string{"admin", "auditor"}}, method: methodOther},
+	}
+	interceptor := UnaryServerInterceptor(newTestEngine())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = auth.NewContext(ctx, tt.principal)
+			}
+			called := false
+			resp, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req any) (any, error) {
+				called = true
+				return "resp", nil
+			})
+
+			if tt.reason == "" {
+				if err != nil || !called || resp != "resp" {
+					t.Fatalf("interceptor = %v, %v (handler called: %v), want the handler's response", resp, err, called)
+				}
+				return
+			}
+			if called {
+				t.Fatal("handler called for a denied request")
+			}
+			st := status.Convert(err)
+			if st.Code() != codes.PermissionDenied {
+				t.Fatalf("code = %v, want PermissionDenied", st.Code())
+			}
+			var info *errdetails.ErrorInfo
+			for _, d := range st.Details() {
+				if ei, ok := d.(*errdetails.ErrorInfo); ok {
+					info = ei
+				}
+			}
+			if info == nil {
+				t.Fatalf("status %v has no ErrorInfo", st)
+			}
+			if info.Reason != tt.reason || info.Domain != errorDomain {
+				t.Fatalf("ErrorInfo reason/domain = %s/%s, want %s/%s", info.Reason, info.Domain, tt.reason, errorDomain)
+			}
+			if info.Metadata["method"] != tt.method || info.Metadata["user_id"] != tt.principal.UserID || info.Metadata["role"] != tt.role {
+				t.Fatalf("ErrorInfo metadata = %v", info.Metadata)
+			}
+		})
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(newTestEngine())
+	ss := &testServerStream{ctx: auth.NewContext(context.Background(), &auth.Principal{UserID: "viewer", Roles: []string{"viewer"}})}
+	handler := func(srv any, stream grpc.ServerStream) error { return nil }
+
+	if err := interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: methodGet}, handler); err != nil {
+		t.Fatalf("allowed stream: %v", err)
+	}
+	if err := interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: methodOther}, handler); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("denied stream: err = %v, want PermissionDenied", err)
+	}
+}
+
+// 修改和删除用户的权限立即生效
+func TestEngineUpdates(t *testing.T) {
+	e := newTestEngine()
+	p := &auth.Principal{UserID: "viewer", Roles: []string{"viewer"}}
+	if d := e.Evaluate(p, methodGet); !d.Allowed {
+		t.Fatalf("Evaluate = %+v, want allowed", d)
+	}
+	e.SetUserPermissions(&rpc.UserPermissions{
+		UserId: "viewer",
+		RolePermissions: map[string]*rpc.RolePermission{
+			"viewer": {AllowedActions: []string{methodGet}, ExpiresAt: now.Add(time.Second).Unix()},
+		},
+	})
+	if d := e.Evaluate(p, methodGet); !d.Allowed {
+		t.Fatalf("Evaluate before expiry = %+v, want allowed", d)
+	}
+	e.RemoveUser("viewer")
+	if d := e.Evaluate(p, methodGet); d.Allowed || d.Reason != ReasonNoPermissions {
+		t.Fatalf("Evaluate after RemoveUser = %+v, want %s", d, ReasonNoPermissions)
+	}
+}
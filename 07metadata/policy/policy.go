@@ -0,0 +1,137 @@
+// Package policy 基于 UserPermissions/RolePermission 的授权策略引擎。
+//
+// 每个调用以完整的 gRPC 方法名作为动作，按调用方拥有的角色逐一评估。
+// 只评估令牌中携带（Principal.Roles）且在引擎中配置了权限的角色，
+// 签发时缩小了角色范围的令牌不会得到用户的全部权限。
+// 任一未过期角色拒绝该动作时直接拒绝（拒绝优先），
+// 否则只要有一个未过期角色允许即放行，其余情况一律拒绝。
+// 目前只评估 role_permissions，resource_permissions 留给具体业务自行解释。
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clin211/grpc/metadata/auth"
+	rpc "github.com/clin211/grpc/metadata/proto"
+)
+
+// 拒绝原因，同时用作 ErrorInfo 的 Reason
+const (
+	ReasonNoPermissions = "NO_PERMISSIONS" // 用户没有任何权限配置
+	ReasonDenied        = "ACTION_DENIED"  // 角色明确拒绝了该动作
+	ReasonRoleExpired   = "ROLE_EXPIRED"   // 允许该动作的角色均已过期
+	ReasonNotAllowed    = "NOT_ALLOWED"    // 没有角色允许该动作
+)
+
+// Decision 一次授权评估的结果
+type Decision struct {
+	Allowed bool
+	Role    string // 做出决定的角色，没有时为空
+	Reason  string // 拒绝原因，允许时为空
+	Message string // 便于阅读的说明
+}
+
+// Engine 授权策略引擎，按用户ID保存 UserPermissions
+type Engine struct {
+	mu    sync.RWMutex
+	users map[string]*rpc.UserPermissions
+	now   func() time.Time
+}
+
+// NewEngine 创建策略引擎
+func NewEngine() *Engine {
+	return &Engine{
+		users: make(map[string]*rpc.UserPermissions),
+		now:   time.Now,
+	}
+}
+
+// SetUserPermissions 设置或替换某个用户的权限
+func (e *Engine) SetUserPermissions(perms *rpc.UserPermissions) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.users[perms.GetUserId()] = perms
+}
+
+// RemoveUser 删除某个用户的权限，之后该用户的所有调用都会被拒绝
+func (e *Engine) RemoveUser(userID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.users, userID)
+}
+
+// Evaluate 评估调用方 p 能否执行 fullMethod
+func (e *Engine) Evaluate(p *auth.Principal, fullMethod string) Decision {
+	e.mu.RLock()
+	perms, ok := e.users[p.UserID]
+	e.mu.RUnlock()
+	if !ok || len(perms.GetRolePermissions()) == 0 {
+		return Decision{Reason: ReasonNoPermissions, Message: fmt.Sprintf("用户 %s 没有任何权限", p.UserID)}
+	}
+
+	// 只取令牌中携带的角色，按角色名排序，保证结果稳定
+	roles := make([]string, 0, len(p.Roles))
+	for _, role := range p.Roles {
+		if _, ok := perms.GetRolePermissions()[role]; ok && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		return Decision{Reason: ReasonNoPermissions, Message: fmt.Sprintf("用户 %s 的令牌没有携带已配置权限的角色", p.UserID)}
+	}
+	sort.Strings(roles)
+
+	now := e.now()
+	var allowedBy, expired string
+	for _, role := range roles {
+		rp := perms.GetRolePermissions()[role]
+		if rp.GetExpiresAt() > 0 && !now.Before(time.Unix(rp.GetExpiresAt(), 0)) {
+			if expired == "" && matchAny(rp.GetAllowedActions(), fullMethod) {
+				expired = role
+			}
+			continue
+		}
+		if matchAny(rp.GetDeniedActions(), fullMethod) {
+			return Decision{Role: role, Reason: ReasonDenied, Message: fmt.Sprintf("角色 %s 拒绝访问 %s", role, fullMethod)}
+		}
+		if allowedBy == "" && matchAny(rp.GetAllowedActions(), fullMethod) {
+			allowedBy = role
+		}
+	}
+
+	switch {
+	case allowedBy != "":
+		return Decision{Allowed: true, Role: allowedBy}
+	case expired != "":
+		exp := time.Unix(perms.GetRolePermissions()[expired].GetExpiresAt(), 0)
+		return Decision{Role: expired, Reason: ReasonRoleExpired, Message: fmt.Sprintf("角色 %s 已于 %s 过期", expired, exp.Format(time.RFC3339))}
+	default:
+		return Decision{Reason: ReasonNotAllowed, Message: fmt.Sprintf("没有角色允许访问 %s", fullMethod)}
+	}
+}
+
+// matchAny 判断 fullMethod 是否匹配 patterns 中的任意一个
+func matchAny(patterns []string, fullMethod string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, fullMethod) {
+			return true
+		}
+	}
+	return false
+}
+
+// match 支持完整方法名、"/包名.服务名/*" 和 "*"
+func match(pattern, fullMethod string) bool {
+	if pattern == "*" || pattern == fullMethod {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(fullMethod, prefix+"/")
+	}
+	return false
+}
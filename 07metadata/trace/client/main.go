@@ -3,59 +3,62 @@ package main
 import (
 	"context"
 	"log"
+	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
 
 	rpc "github.com/clin211/grpc/metadata/trace/proto"
 	"github.com/clin211/grpc/metadata/trace/trace"
+	"github.com/clin211/grpc/mtls"
 )
 
-// TracingClient 支持链路追踪的客户端
-type TracingClient struct {
-	client rpc.ProfileServiceClient
-}
-
-// GetUserWithTracing 带追踪的获取用户信息
-func (tc *TracingClient) GetUserWithTracing(ctx context.Context, userID string, traceInfo *trace.TraceInfo) (*rpc.GetProfileResponse, error) {
-	// 将追踪信息添加到元数据
-	md := metadata.Pairs(
-		trace.HeaderTraceID, traceInfo.TraceID,
-		trace.HeaderSpanID, traceInfo.SpanID,
-	)
-
-	if traceInfo.ParentSpanID != "" {
-		md.Append(trace.HeaderParentSpanID, traceInfo.ParentSpanID)
-	}
-
-	// 创建带追踪信息的context
-	tracingCtx := metadata.NewOutgoingContext(ctx, md)
-
-	log.Printf("[追踪] 发起GetUser调用 - TraceID: %s, SpanID: %s",
-		traceInfo.TraceID, traceInfo.SpanID)
-
-	return tc.client.GetProfile(tracingCtx, &rpc.GetProfileRequest{UserId: userID})
-}
-
 // 实际使用示例
 func main() {
-	// 建立gRPC连接
-	conn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	creds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("加载TLS证书失败: %v", err)
+	}
+	// 按 OTEL_TRACES_EXPORTER 等环境变量导出跨度，退出前导出剩余的跨度
+	tracer, err := trace.NewTracerFromEnv("TracingClient")
+	if err != nil {
+		log.Fatalf("创建Tracer失败: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tracer.Shutdown(ctx); err != nil {
+			log.Printf("导出跨度失败: %v", err)
+		}
+	}()
+
+	// 建立gRPC连接，追踪拦截器为每次调用创建子跨度并写入 traceparent 等头部
+	conn, err := grpc.NewClient("localhost:50051", creds,
+		grpc.WithChainUnaryInterceptor(trace.UnaryClientInterceptor(tracer)),
+		grpc.WithChainStreamInterceptor(trace.StreamClientInterceptor(tracer)),
+	)
 	if err != nil {
 		log.Fatalf("连接失败: %v", err)
 	}
 	defer conn.Close()
 
-	// 创建追踪信息
-	traceInfo := trace.NewTraceInfo()
+	// 创建根跨度，本次请求中的调用都作为它的子跨度
+	ctx, root := tracer.Start(context.Background(), "LoadProfile", trace.SpanKindInternal)
+	defer root.End()
+	traceInfo := root.TraceInfo()
 
-	client := &TracingClient{client: rpc.NewProfileServiceClient(conn)}
+	client := rpc.NewProfileServiceClient(conn)
+
+	log.Printf("[追踪] 发起GetProfile调用 - TraceID: %s, SpanID: %s",
+		traceInfo.TraceID, traceInfo.SpanID)
 
 	// 发起带追踪的调用
-	resp, err := client.GetUserWithTracing(context.Background(), "user123", traceInfo)
+	resp, err := client.GetProfile(ctx, &rpc.GetProfileRequest{UserId: "user123"})
 	if err != nil {
 		log.Printf("[追踪] 调用失败 - TraceID: %s, Error: %v", traceInfo.TraceID, err)
+		root.RecordError(err)
 		return
 	}
 
@@ -0,0 +1,137 @@
+// collector 是一个本地的 OTLP/HTTP 收集器桩，接收 OTLP JSON 编码的跨度，
+// 并按 TraceID 还原调用树输出。启动服务时设置：
+//
+//	OTEL_TRACES_EXPORTER=otlp OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/clin211/grpc/metadata/trace/trace"
+)
+
+var addr = flag.String("addr", ":4318", "address to listen on")
+
+// 以下类型只解码还原调用树需要的字段
+type (
+	exportRequest struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []keyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []span `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	span struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes"`
+		Status            struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"status"`
+	}
+	keyValue struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+)
+
+// collector 按 TraceID 保存收到的跨度
+type collector struct {
+	mu     sync.Mutex
+	traces map[string][]trace.SpanData
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	touched := make(map[string]bool)
+	for _, rs := range req.ResourceSpans {
+		service := attribute(rs.Resource.Attributes, "service.name")
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.traces[s.TraceID] = append(c.traces[s.TraceID], spanData(service, s))
+				touched[s.TraceID] = true
+			}
+		}
+	}
+	// 同一追踪的跨度可能分多批从不同服务到达，每次都输出目前为止的完整调用树
+	for traceID := range touched {
+		log.Printf("收到跨度，当前调用树：")
+		trace.PrintTree(os.Stdout, trace.BuildTree(c.traces[traceID]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+func spanData(service string, s span) trace.SpanData {
+	start, end := unixNano(s.StartTimeUnixNano), unixNano(s.EndTimeUnixNano)
+	return trace.SpanData{
+		TraceInfo: trace.TraceInfo{
+			TraceID:      s.TraceID,
+			SpanID:       s.SpanID,
+			ParentSpanID: s.ParentSpanID,
+		},
+		Service:   service,
+		Name:      s.Name,
+		Kind:      trace.SpanKind(s.Kind),
+		StartTime: start,
+		EndTime:   end,
+		Duration:  end.Sub(start),
+		Status:    trace.Status{Code: trace.StatusCode(s.Status.Code), Message: s.Status.Message},
+	}
+}
+
+func attribute(kvs []keyValue, key string) string {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.Value.StringValue
+		}
+	}
+	return ""
+}
+
+func unixNano(s string) time.Time {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return time.Unix(0, n)
+}
+
+func main() {
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/traces", &collector{traces: make(map[string][]trace.SpanData)})
+
+	log.Printf("OTLP/HTTP 收集器监听 %s", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("收集器启动失败: %v", err)
+	}
+}
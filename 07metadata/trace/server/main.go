@@ -2,35 +2,19 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net"
 	"time"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
 	rpc "github.com/clin211/grpc/metadata/trace/proto"
 	"github.com/clin211/grpc/metadata/trace/trace"
+	"github.com/clin211/grpc/mtls"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
-// extractTraceInfo 从元数据中提取追踪信息
-func extractTraceInfo(md metadata.MD) *trace.TraceInfo {
-	traceID := getFirstValue(md, trace.HeaderTraceID)
-	spanID := getFirstValue(md, trace.HeaderSpanID)
-	parentSpanID := getFirstValue(md, trace.HeaderParentSpanID)
-
-	if traceID == "" {
-		// 如果没有追踪信息，创建新的
-		return trace.NewTraceInfo()
-	}
-
-	return &trace.TraceInfo{
-		TraceID:      traceID,
-		SpanID:       spanID,
-		ParentSpanID: parentSpanID,
-	}
-}
-
 // UserServer 用户服务实现
 type UserServer struct {
 	rpc.UnimplementedProfileServiceServer
@@ -38,16 +22,13 @@ type UserServer struct {
 
 // GetProfile 获取用户资料（支持链路追踪）
 func (s *UserServer) GetProfile(ctx context.Context, req *rpc.GetProfileRequest) (*rpc.GetProfileResponse, error) {
-	// 业务逻辑处理的开始时间
-	startTime := time.Now()
-	// 提取追踪信息
-	md, _ := metadata.FromIncomingContext(ctx)
-	traceInfo := extractTraceInfo(md)
-
-	// 创建追踪日志记录器
-	tracer := trace.NewTraceLogger("UserService")
-	// 记录请求开始
-	tracer.LogRequest(traceInfo, "GetUser", fmt.Sprintf("UserID: %s", req.GetUserId()))
+	// 追踪拦截器已从元数据中提取上游跨度，并以 ProfileService 的名义创建了本次调用的子跨度，
+	// 方法名、状态码和耗时都记录在跨度中
+	traceInfo, _ := trace.FromContext(ctx)
+	if span, ok := trace.SpanFromContext(ctx); ok {
+		span.SetAttribute("user.id", req.GetUserId())
+		defer span.AddEvent("profile.loaded", nil)
+	}
 
 	log.Printf("[追踪] 收到GetProfile请求 - TraceID: %s, SpanID: %s, UserID: %s",
 		traceInfo.TraceID, traceInfo.SpanID, req.GetUserId())
@@ -65,35 +46,63 @@ func (s *UserServer) GetProfile(ctx context.Context, req *rpc.GetProfileRequest)
 		},
 	}
 
-	tracer.LogResponse(traceInfo, "Get Profile", fmt.Sprintf("userInfo: %v", userInfo), time.Since(startTime), nil)
-
 	log.Printf("[追踪] GetProfile处理完成 - TraceID: %s, SpanID: %s",
 		traceInfo.TraceID, traceInfo.SpanID)
 
 	return userInfo, nil
 }
 
-// getFirstValue 获取元数据中的第一个值
-func getFirstValue(md metadata.MD, key string) string {
-	values := md.Get(key)
-	if len(values) > 0 {
-		return values[0]
-	}
-	return ""
-}
-
 func main() {
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("加载TLS证书失败: %v", err)
+	}
+	// 按 OTEL_TRACES_EXPORTER 等环境变量导出跨度
+	tracer, err := trace.NewTracerFromEnv("ProfileService")
+	if err != nil {
+		log.Fatalf("创建Tracer失败: %v", err)
+	}
+	// 追踪拦截器兼容 W3C traceparent 和旧的 x-trace-id 头部
+	grpcServer := grpc.NewServer(creds,
+		grpc.ChainUnaryInterceptor(trace.UnaryServerInterceptor(tracer)),
+		grpc.ChainStreamInterceptor(trace.StreamServerInterceptor(tracer)),
+	)
 	profileService := &UserServer{}
 	rpc.RegisterProfileServiceServer(grpcServer, profileService)
 
-	log.Printf("server listening at %v", lis.Addr())
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	// 健康检查服务，整体状态（空服务名）表示资料服务是否可用
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// 收到 SIGINT/SIGTERM 时置为 NOT_SERVING、等待排空后 GracefulStop，超时后 Stop；
+	// 服务器停止后再导出剩余的跨度，保证最后一批请求的跨度也被导出
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{grpcServer},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	})
+
+	go func() {
+		log.Printf("server listening at %v", lis.Addr())
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+	lc.Wait()
+
+	// 导出剩余的跨度
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		log.Printf("导出跨度失败: %v", err)
 	}
 }
@@ -0,0 +1,109 @@
+package trace
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 导出器相关的环境变量，名称沿用 OpenTelemetry SDK 的约定
+const (
+	EnvTracesExporter     = "OTEL_TRACES_EXPORTER"               // stdout（默认）、otlp 或 none
+	EnvOTLPEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"        // 如 http://localhost:4318，会追加 /v1/traces
+	EnvOTLPTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" // 完整地址，优先于 EnvOTLPEndpoint
+	defaultTracesExporter = "stdout"
+	otlpTracesPath        = "/v1/traces"
+
+	EnvTracesSampler    = "OTEL_TRACES_SAMPLER"     // 见 SamplerFromEnv
+	EnvTracesSamplerArg = "OTEL_TRACES_SAMPLER_ARG" // traceidratio 的比例或 ratelimited 的每秒跨度数
+	defaultSampler      = "parentbased_always_on"
+)
+
+// NewTracerFromEnv 按环境变量选择采样器和导出器并创建 Tracer，跨度经批量处理器导出。
+// 退出前调用 Tracer.Shutdown 导出剩余的跨度。
+func NewTracerFromEnv(service string) (*Tracer, error) {
+	sampler, err := SamplerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(os.Getenv(EnvTracesExporter))
+	if name == "" {
+		name = defaultTracesExporter
+	}
+
+	var exporter Exporter
+	switch name {
+	case "stdout", "console":
+		exporter = NewStdoutExporter(nil)
+	case "otlp":
+		exporter = NewOTLPExporter(OTLPConfig{Endpoint: otlpEndpointFromEnv()})
+	case "none":
+		return NewTracer(service, sampler), nil
+	default:
+		return nil, fmt.Errorf("不支持的导出器 %s=%q", EnvTracesExporter, name)
+	}
+	log.Printf("[%s] 追踪导出器: %s, 采样策略: %s", service, name, sampler.Description())
+	return NewTracer(service, sampler, NewBatchProcessor(exporter, BatchConfig{})), nil
+}
+
+// SamplerFromEnv 按 OTEL_TRACES_SAMPLER 创建采样器，取值为
+// always_on、always_off、traceidratio、ratelimited（每个方法限速）
+// 或加上 parentbased_ 前缀的版本，默认 parentbased_always_on。
+func SamplerFromEnv() (Sampler, error) {
+	name := strings.ToLower(os.Getenv(EnvTracesSampler))
+	if name == "" {
+		name = defaultSampler
+	}
+	arg := os.Getenv(EnvTracesSamplerArg)
+
+	root, parentBased := strings.CutPrefix(name, "parentbased_")
+	var sampler Sampler
+	switch root {
+	case "always_on":
+		sampler = AlwaysSample()
+	case "always_off":
+		sampler = NeverSample()
+	case "traceidratio":
+		ratio, err := parseSamplerArg(arg, 1)
+		if err != nil {
+			return nil, err
+		}
+		sampler = TraceIDRatioBased(ratio)
+	case "ratelimited":
+		perSecond, err := parseSamplerArg(arg, 10)
+		if err != nil {
+			return nil, err
+		}
+		sampler = MethodRateLimited(perSecond)
+	default:
+		return nil, fmt.Errorf("不支持的采样器 %s=%q", EnvTracesSampler, name)
+	}
+	if parentBased {
+		sampler = ParentBased(sampler)
+	}
+	return sampler, nil
+}
+
+func parseSamplerArg(arg string, def float64) (float64, error) {
+	if arg == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的 %s=%q: %w", EnvTracesSamplerArg, arg, err)
+	}
+	return v, nil
+}
+
+func otlpEndpointFromEnv() string {
+	if endpoint := os.Getenv(EnvOTLPTracesEndpoint); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv(EnvOTLPEndpoint); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + otlpTracesPath
+	}
+	return DefaultOTLPEndpoint
+}
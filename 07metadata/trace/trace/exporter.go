@@ -0,0 +1,78 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// StdoutExporter 每个跨度输出一行 JSON
+type StdoutExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewStdoutExporter 创建 JSON 导出器，w 为 nil 时写到标准输出
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StdoutExporter{enc: json.NewEncoder(w)}
+}
+
+// ExportSpans 实现 Exporter
+func (e *StdoutExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range spans {
+		if err := e.enc.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown 实现 Exporter
+func (e *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// InMemoryExporter 把跨度保存在内存中，用于测试和检查调用树
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter 创建内存导出器
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpans 实现 Exporter
+func (e *InMemoryExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Shutdown 实现 Exporter，已保存的跨度仍然可以读取
+func (e *InMemoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Spans 返回已导出跨度的副本
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset 清空已保存的跨度
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
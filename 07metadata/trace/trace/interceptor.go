@@ -0,0 +1,203 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// startServerSpan 为收到的请求开始服务端跨度：
+// 有上游追踪信息时作为其子跨度，否则开始新的追踪
+func startServerSpan(ctx context.Context, t *Tracer, fullMethod string) (context.Context, *Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	parent, _ := Extract(md)
+	ctx, span := t.Start(NewContext(ctx, parent), fullMethod, SpanKindServer)
+	setRPCAttributes(span, fullMethod)
+	return ctx, span
+}
+
+// startClientSpan 为发出的调用开始客户端跨度并写入出站元数据。
+// 父跨度依次取自 context 中的当前跨度、调用方手动设置的追踪头部，都没有时开始新的追踪。
+func startClientSpan(ctx context.Context, t *Tracer, method string) (context.Context, *Span) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	if _, ok := FromContext(ctx); !ok {
+		if parent, ok := Extract(md); ok {
+			ctx = NewContext(ctx, parent)
+		}
+	}
+	ctx, span := t.Start(ctx, method, SpanKindClient)
+	setRPCAttributes(span, method)
+	Inject(md, span.TraceInfo())
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// setRPCAttributes 按 OpenTelemetry 语义约定设置 rpc.* 属性
+func setRPCAttributes(span *Span, fullMethod string) {
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttribute("rpc.system", "grpc")
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if ok {
+		span.SetAttribute("rpc.service", service)
+		span.SetAttribute("rpc.method", method)
+	}
+}
+
+// endSpan 记录状态码并结束跨度
+func endSpan(span *Span, err error) {
+	if !span.IsRecording() {
+		return
+	}
+	st, _ := status.FromError(err)
+	span.SetAttribute("rpc.grpc.status_code", int64(st.Code()))
+	if st.Code() != codes.OK {
+		span.SetStatus(StatusError, st.Message())
+	}
+	span.End()
+}
+
+// UnaryServerInterceptor 返回一元调用的服务端追踪拦截器。
+// 处理函数可以通过 FromContext 取得追踪信息，通过 SpanFromContext 添加属性和事件。
+func UnaryServerInterceptor(t *Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, span := startServerSpan(ctx, t, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	}
+}
+
+// tracedServerStream 替换流的 context，并把收发的消息记录为事件
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx            context.Context
+	span           *Span
+	sent, received atomic.Int64
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *tracedServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		messageEvent(s.span, "SENT", s.sent.Add(1))
+	}
+	return err
+}
+
+func (s *tracedServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		messageEvent(s.span, "RECEIVED", s.received.Add(1))
+	}
+	return err
+}
+
+func messageEvent(span *Span, typ string, id int64) {
+	if !span.IsRecording() {
+		return
+	}
+	span.AddEvent("message", map[string]any{"message.type": typ, "message.id": id})
+}
+
+// StreamServerInterceptor 返回流式调用的服务端追踪拦截器
+func StreamServerInterceptor(t *Tracer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(ss.Context(), t, info.FullMethod)
+		err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx, span: span})
+		endSpan(span, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor 返回一元调用的客户端追踪拦截器
+func UnaryClientInterceptor(t *Tracer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startClientSpan(ctx, t, method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// tracedClientStream 在流结束时结束客户端跨度：
+// RecvMsg 返回错误（io.EOF 视为成功）即表示流已结束；
+// 服务端不以流返回时（一元和客户端流），第一次成功接收响应后流也已结束。
+type tracedClientStream struct {
+	grpc.ClientStream
+	span           *Span
+	serverStreams  bool
+	once           sync.Once
+	sent, received atomic.Int64
+}
+
+// finish 结束跨度，可以多次调用，只有第一次有效
+func (s *tracedClientStream) finish(err error) {
+	s.once.Do(func() {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		endSpan(s.span, err)
+	})
+}
+
+func (s *tracedClientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		messageEvent(s.span, "SENT", s.sent.Add(1))
+	}
+	return err
+}
+
+func (s *tracedClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.finish(err)
+		return err
+	}
+	messageEvent(s.span, "RECEIVED", s.received.Add(1))
+	// CloseAndRecv 只接收一次响应，不会再读到 io.EOF
+	if !s.serverStreams {
+		s.finish(nil)
+	}
+	return nil
+}
+
+func (s *tracedClientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.finish(err)
+	}
+	return md, err
+}
+
+// StreamClientInterceptor 返回流式调用的客户端追踪拦截器。
+// 跨度在流结束时结束：服务端流需要调用方把消息读到 io.EOF 或出错为止，
+// 客户端流在 CloseAndRecv 收到响应时结束。
+func StreamClientInterceptor(t *Tracer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, t, method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+		return &tracedClientStream{ClientStream: cs, span: span, serverStreams: desc.ServerStreams}, nil
+	}
+}
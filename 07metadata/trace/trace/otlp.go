@@ -0,0 +1,216 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultOTLPEndpoint OTLP/HTTP 的默认地址
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// instrumentationScope 导出时标识跨度来自本包
+const instrumentationScope = "github.com/clin211/grpc/metadata/trace/trace"
+
+// OTLPConfig OTLP/HTTP 导出器配置
+type OTLPConfig struct {
+	Endpoint string            // 完整地址，默认 DefaultOTLPEndpoint
+	Headers  map[string]string // 额外的请求头，如认证信息
+	Timeout  time.Duration     // 单次请求超时，默认 10s
+	Client   *http.Client
+}
+
+// OTLPExporter 以 OTLP/HTTP JSON 编码把跨度发送给收集器
+type OTLPExporter struct {
+	cfg OTLPConfig
+}
+
+// NewOTLPExporter 创建 OTLP/HTTP 导出器
+func NewOTLPExporter(cfg OTLPConfig) *OTLPExporter {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultOTLPEndpoint
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+	return &OTLPExporter{cfg: cfg}
+}
+
+// ExportSpans 实现 Exporter
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP 收集器返回 %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Shutdown 实现 Exporter
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.cfg.Client.CloseIdleConnections()
+	return nil
+}
+
+// 以下类型对应 ExportTraceServiceRequest 的 JSON 编码，
+// ID 使用十六进制字符串，64 位整数使用十进制字符串
+type (
+	otlpExportRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+// otlpRequest 按服务名分组，每个服务对应一个 resource
+func otlpRequest(spans []SpanData) *otlpExportRequest {
+	req := &otlpExportRequest{}
+	index := make(map[string]int)
+	for _, s := range spans {
+		i, ok := index[s.Service]
+		if !ok {
+			i = len(req.ResourceSpans)
+			index[s.Service] = i
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": s.Service})},
+				ScopeSpans: []otlpScopeSpans{{
+					Scope: otlpScope{Name: instrumentationScope},
+				}},
+			})
+		}
+		scope := &req.ResourceSpans[i].ScopeSpans[0]
+		scope.Spans = append(scope.Spans, otlpSpanOf(s))
+	}
+	return req
+}
+
+func otlpSpanOf(s SpanData) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentSpanID,
+		TraceState:        s.TraceState,
+		Name:              s.Name,
+		Kind:              int(s.Kind),
+		StartTimeUnixNano: unixNano(s.StartTime),
+		EndTimeUnixNano:   unixNano(s.EndTime),
+		Attributes:        otlpAttributes(s.Attributes),
+		Status:            otlpStatus{Code: int(s.Status.Code), Message: s.Status.Message},
+	}
+	for _, ev := range s.Events {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: unixNano(ev.Time),
+			Name:         ev.Name,
+			Attributes:   otlpAttributes(ev.Attributes),
+		})
+	}
+	return span
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpAttributes 按键排序转换属性，不支持的类型按字符串输出
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		var v map[string]any
+		switch x := attrs[k].(type) {
+		case string:
+			v = map[string]any{"stringValue": x}
+		case bool:
+			v = map[string]any{"boolValue": x}
+		case int:
+			v = map[string]any{"intValue": strconv.FormatInt(int64(x), 10)}
+		case int32:
+			v = map[string]any{"intValue": strconv.FormatInt(int64(x), 10)}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+		case uint32:
+			v = map[string]any{"intValue": strconv.FormatUint(uint64(x), 10)}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: v})
+	}
+	return kvs
+}
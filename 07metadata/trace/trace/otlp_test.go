@@ -0,0 +1,134 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporterEncoding(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header, body: body}
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1700000000, 123)
+	spans := []SpanData{
+		{
+			TraceInfo: TraceInfo{TraceID: testTraceID, SpanID: testSpanID, TraceState: "vendor=a"},
+			Service:   "UserService",
+			Name:      "/user.UserService/GetUser",
+			Kind:      SpanKindServer,
+			StartTime: start,
+			EndTime:   start.Add(time.Millisecond),
+			Attributes: map[string]any{
+				"rpc.system":           "grpc",
+				"rpc.grpc.status_code": uint32(5),
+				"retry":                true,
+				"ratio":                0.5,
+				"size":                 int64(1 << 40),
+				"peer":                 struct{ Host string }{"h"},
+			},
+			Events: []Event{{Name: "message", Time: start, Attributes: map[string]any{"id": 1}}},
+			Status: Status{Code: StatusError, Message: "not found"},
+		},
+		{
+			TraceInfo: TraceInfo{TraceID: testTraceID, SpanID: "b7ad6b7169203331", ParentSpanID: testSpanID},
+			Service:   "ProfileService",
+			Name:      "db.query",
+			Kind:      SpanKindInternal,
+			StartTime: start,
+			EndTime:   start,
+		},
+		{
+			TraceInfo: TraceInfo{TraceID: testTraceID, SpanID: "0102030405060708", ParentSpanID: testSpanID},
+			Service:   "UserService",
+			Name:      "/user.ProfileService/GetProfile",
+			Kind:      SpanKindClient,
+			StartTime: start,
+			EndTime:   start,
+			Status:    Status{Code: StatusOK},
+		},
+	}
+
+	e := NewOTLPExporter(OTLPConfig{Endpoint: srv.URL + "/v1/traces", Headers: map[string]string{"Authorization": "Bearer t"}})
+	if err := e.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatalf("ExportSpans: %v", err)
+	}
+	req := <-requests
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer t" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	// 与 ExportTraceServiceRequest 的 JSON 编码逐字段比较
+	want := `{"resourceSpans":[
+		{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"UserService"}}]},
+		 "scopeSpans":[{"scope":{"name":"github.com/clin211/grpc/metadata/trace/trace"},"spans":[
+			{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7","traceState":"vendor=a",
+			 "name":"/user.UserService/GetUser","kind":2,
+			 "startTimeUnixNano":"1700000000000000123","endTimeUnixNano":"1700000000001000123",
+			 "attributes":[
+				{"key":"peer","value":{"stringValue":"{h}"}},
+				{"key":"ratio","value":{"doubleValue":0.5}},
+				{"key":"retry","value":{"boolValue":true}},
+				{"key":"rpc.grpc.status_code","value":{"intValue":"5"}},
+				{"key":"rpc.system","value":{"stringValue":"grpc"}},
+				{"key":"size","value":{"intValue":"1099511627776"}}],
+			 "events":[{"timeUnixNano":"1700000000000000123","name":"message","attributes":[{"key":"id","value":{"intValue":"1"}}]}],
+			 "status":{"code":2,"message":"not found"}},
+			{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"0102030405060708","parentSpanId":"00f067aa0ba902b7",
+			 "name":"/user.ProfileService/GetProfile","kind":3,
+			 "startTimeUnixNano":"1700000000000000123","endTimeUnixNano":"1700000000000000123",
+			 "status":{"code":1}}]}]},
+		{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"ProfileService"}}]},
+		 "scopeSpans":[{"scope":{"name":"github.com/clin211/grpc/metadata/trace/trace"},"spans":[
+			{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"b7ad6b7169203331","parentSpanId":"00f067aa0ba902b7",
+			 "name":"db.query","kind":1,
+			 "startTimeUnixNano":"1700000000000000123","endTimeUnixNano":"1700000000000000123",
+			 "status":{}}]}]}]}`
+	var got, wantJSON any
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatalf("request body is not JSON: %v\n%s", err, req.body)
+	}
+	if err := json.Unmarshal([]byte(want), &wantJSON); err != nil {
+		t.Fatal(err)
+	}
+	gotNorm, _ := json.Marshal(got)
+	wantNorm, _ := json.Marshal(wantJSON)
+	if string(gotNorm) != string(wantNorm) {
+		t.Fatalf("request body:\n%s\nwant:\n%s", gotNorm, wantNorm)
+	}
+}
+
+func TestOTLPExporterErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	e := NewOTLPExporter(OTLPConfig{Endpoint: srv.URL})
+
+	// 没有跨度时不发送请求
+	if err := e.ExportSpans(context.Background(), nil); err != nil || calls != 0 {
+		t.Fatalf("ExportSpans(nil) = %v with %d requests", err, calls)
+	}
+	err := e.ExportSpans(context.Background(), []SpanData{{TraceInfo: TraceInfo{TraceID: testTraceID, SpanID: testSpanID}}})
+	if err == nil || !strings.Contains(err.Error(), "429") || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("ExportSpans: err = %v, want the collector's status and message", err)
+	}
+}
@@ -0,0 +1,207 @@
+package trace
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Exporter 把结束的跨度发送到某处
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// SpanProcessor 接收结束的跨度
+type SpanProcessor interface {
+	OnEnd(span SpanData)
+	// Shutdown 导出剩余的跨度并关闭导出器
+	Shutdown(ctx context.Context) error
+}
+
+// simpleProcessor 每个跨度结束时同步导出，适合测试和内存导出器
+type simpleProcessor struct {
+	exporter Exporter
+}
+
+// NewSimpleProcessor 创建同步导出的处理器
+func NewSimpleProcessor(exporter Exporter) SpanProcessor {
+	return &simpleProcessor{exporter: exporter}
+}
+
+func (p *simpleProcessor) OnEnd(span SpanData) {
+	if err := p.exporter.ExportSpans(context.Background(), []SpanData{span}); err != nil {
+		log.Printf("导出跨度失败: %v", err)
+	}
+}
+
+func (p *simpleProcessor) Shutdown(ctx context.Context) error {
+	return p.exporter.Shutdown(ctx)
+}
+
+// 批量处理器的默认参数，与 OpenTelemetry SDK 一致
+const (
+	DefaultMaxQueueSize  = 2048
+	DefaultMaxBatchSize  = 512
+	DefaultBatchTimeout  = 5 * time.Second
+	DefaultExportTimeout = 30 * time.Second
+)
+
+// BatchConfig 批量处理器配置，零值使用默认值
+type BatchConfig struct {
+	MaxQueueSize  int           // 队列满时丢弃新的跨度
+	MaxBatchSize  int           // 每次导出的最大跨度数
+	BatchTimeout  time.Duration // 不满一批时最长等待多久导出
+	ExportTimeout time.Duration // 单次导出的超时
+}
+
+// BatchProcessor 在后台按批导出跨度，OnEnd 不会阻塞调用方
+type BatchProcessor struct {
+	exporter Exporter
+	cfg      BatchConfig
+
+	queue   chan SpanData
+	flush   chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewBatchProcessor 创建批量处理器并启动后台导出
+func NewBatchProcessor(exporter Exporter, cfg BatchConfig) *BatchProcessor {
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = DefaultMaxQueueSize
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if cfg.MaxBatchSize > cfg.MaxQueueSize {
+		cfg.MaxBatchSize = cfg.MaxQueueSize
+	}
+	if cfg.BatchTimeout <= 0 {
+		cfg.BatchTimeout = DefaultBatchTimeout
+	}
+	if cfg.ExportTimeout <= 0 {
+		cfg.ExportTimeout = DefaultExportTimeout
+	}
+	p := &BatchProcessor{
+		exporter: exporter,
+		cfg:      cfg,
+		queue:    make(chan SpanData, cfg.MaxQueueSize),
+		flush:    make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// OnEnd 把跨度放入队列，队列已满时丢弃
+func (p *BatchProcessor) OnEnd(span SpanData) {
+	select {
+	case <-p.stop:
+		return
+	default:
+	}
+	select {
+	case p.queue <- span:
+	default:
+		p.mu.Lock()
+		p.dropped++
+		p.mu.Unlock()
+	}
+}
+
+// Dropped 返回因队列已满而丢弃的跨度数
+func (p *BatchProcessor) Dropped() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// ForceFlush 立即导出队列中的跨度
+func (p *BatchProcessor) ForceFlush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case p.flush <- ack:
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown 导出剩余的跨度后关闭导出器，之后的跨度会被忽略
+func (p *BatchProcessor) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.stop) })
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.exporter.Shutdown(ctx)
+}
+
+func (p *BatchProcessor) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.BatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, p.cfg.MaxBatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.ExportTimeout)
+		if err := p.exporter.ExportSpans(ctx, batch); err != nil {
+			log.Printf("导出 %d 个跨度失败: %v", len(batch), err)
+		}
+		cancel()
+		batch = make([]SpanData, 0, p.cfg.MaxBatchSize)
+	}
+	// drain 取出队列中已有的全部跨度
+	drain := func() {
+		for {
+			select {
+			case span := <-p.queue:
+				batch = append(batch, span)
+				if len(batch) == p.cfg.MaxBatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) == p.cfg.MaxBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-p.flush:
+			drain()
+			close(ack)
+		case <-p.stop:
+			drain()
+			if n := p.Dropped(); n > 0 {
+				log.Printf("队列已满，共丢弃 %d 个跨度", n)
+			}
+			return
+		}
+	}
+}
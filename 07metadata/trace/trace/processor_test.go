@@ -0,0 +1,211 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchExporter 记录每次导出的批次
+type batchExporter struct {
+	mu       sync.Mutex
+	batches  [][]SpanData
+	shutdown bool
+	exported chan int // 每次导出时发送批次大小
+}
+
+func newBatchExporter() *batchExporter {
+	return &batchExporter{exported: make(chan int, 100)}
+}
+
+func (e *batchExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	e.batches = append(e.batches, append([]SpanData(nil), spans...))
+	e.mu.Unlock()
+	e.exported <- len(spans)
+	return nil
+}
+
+func (e *batchExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+func (e *batchExporter) names() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var names []string
+	for _, b := range e.batches {
+		for _, s := range b {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// waitExport 等待下一次导出并返回批次大小
+func (e *batchExporter) waitExport(t *testing.T, timeout time.Duration) int {
+	t.Helper()
+	select {
+	case n := <-e.exported:
+		return n
+	case <-time.After(timeout):
+		t.Fatalf("no export within %v", timeout)
+		return 0
+	}
+}
+
+func (e *batchExporter) expectNoExport(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case n := <-e.exported:
+		t.Fatalf("unexpected export of %d spans", n)
+	case <-time.After(d):
+	}
+}
+
+func endSpans(p SpanProcessor, n int) {
+	for i := range n {
+		p.OnEnd(SpanData{Name: fmt.Sprintf("span-%d", i)})
+	}
+}
+
+func TestBatchProcessorFlushesOnSize(t *testing.T) {
+	e := newBatchExporter()
+	p := NewBatchProcessor(e, BatchConfig{MaxBatchSize: 3, BatchTimeout: time.Hour})
+	defer p.Shutdown(context.Background())
+
+	endSpans(p, 2)
+	e.expectNoExport(t, 50*time.Millisecond)
+	p.OnEnd(SpanData{Name: "span-2"})
+	if n := e.waitExport(t, time.Second); n != 3 {
+		t.Fatalf("exported a batch of %d, want 3", n)
+	}
+
+	endSpans(p, 7)
+	for range 2 {
+		if n := e.waitExport(t, time.Second); n != 3 {
+			t.Fatalf("exported a batch of %d, want 3", n)
+		}
+	}
+	// 剩下的一个跨度要等到超时或 Shutdown
+	e.expectNoExport(t, 50*time.Millisecond)
+}
+
+func TestBatchProcessorFlushesOnTimeout(t *testing.T) {
+	e := newBatchExporter()
+	p := NewBatchProcessor(e, BatchConfig{MaxBatchSize: 100, BatchTimeout: 50 * time.Millisecond})
+	defer p.Shutdown(context.Background())
+
+	start := time.Now()
+	endSpans(p, 4)
+	if n := e.waitExport(t, time.Second); n != 4 {
+		t.Fatalf("exported a batch of %d, want 4", n)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("partial batch exported after %v", d)
+	}
+	// 没有跨度时不导出空批次
+	e.expectNoExport(t, 150*time.Millisecond)
+}
+
+func TestBatchProcessorShutdown(t *testing.T) {
+	e := newBatchExporter()
+	p := NewBatchProcessor(e, BatchConfig{MaxBatchSize: 2, BatchTimeout: time.Hour})
+
+	endSpans(p, 5)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if got := e.names(); len(got) != 5 {
+		t.Fatalf("exported %v before Shutdown returned, want all 5 spans", got)
+	}
+	e.mu.Lock()
+	for _, b := range e.batches {
+		if len(b) > 2 {
+			t.Errorf("Shutdown exported a batch of %d, larger than MaxBatchSize", len(b))
+		}
+	}
+	shutdown := e.shutdown
+	e.mu.Unlock()
+	if !shutdown {
+		t.Fatal("exporter not shut down")
+	}
+
+	// Shutdown 之后的跨度被忽略，重复 Shutdown 不会出错
+	p.OnEnd(SpanData{Name: "late"})
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("second Shutdown: %v", err)
+	}
+	if got := e.names(); len(got) != 5 {
+		t.Fatalf("exported %v, want the late span ignored", got)
+	}
+	if err := p.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush after Shutdown: %v", err)
+	}
+}
+
+func TestBatchProcessorForceFlush(t *testing.T) {
+	e := newBatchExporter()
+	p := NewBatchProcessor(e, BatchConfig{MaxBatchSize: 100, BatchTimeout: time.Hour})
+	defer p.Shutdown(context.Background())
+
+	endSpans(p, 3)
+	if err := p.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+	if got := e.names(); len(got) != 3 {
+		t.Fatalf("exported %v after ForceFlush, want 3 spans", got)
+	}
+}
+
+// blockingExporter 在 release 关闭前阻塞导出
+type blockingExporter struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (e *blockingExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.once.Do(func() { close(e.started) })
+	<-e.release
+	return nil
+}
+
+func (e *blockingExporter) Shutdown(ctx context.Context) error { return nil }
+
+// 导出器阻塞时 OnEnd 不阻塞调用方，队列满后丢弃并计数；Shutdown 遵守 ctx 的期限
+func TestBatchProcessorDropsWhenQueueFull(t *testing.T) {
+	e := &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	p := NewBatchProcessor(e, BatchConfig{MaxQueueSize: 4, MaxBatchSize: 1, BatchTimeout: time.Hour})
+	defer func() {
+		close(e.release)
+		p.Shutdown(context.Background())
+	}()
+
+	p.OnEnd(SpanData{Name: "first"})
+	<-e.started
+	done := make(chan struct{})
+	go func() {
+		endSpans(p, 10)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnEnd blocked while the exporter was busy")
+	}
+	if got := p.Dropped(); got != 6 {
+		t.Fatalf("Dropped = %d, want 6", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown with a blocked exporter: err = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,152 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// W3C Trace Context 头部，见 https://www.w3.org/TR/trace-context/
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+const (
+	traceparentVersion = "00"
+	traceparentLen     = 55 // 00-<32位trace-id>-<16位parent-id>-<2位flags>
+	flagSampled        = 0x01
+)
+
+// ErrInvalidTraceparent traceparent 头部格式不正确
+var ErrInvalidTraceparent = errors.New("无效的traceparent")
+
+// Traceparent 按 W3C 格式编码追踪信息，ID 不合法时返回空字符串
+func (t *TraceInfo) Traceparent() string {
+	if !isValidID(t.TraceID, 32) || !isValidID(t.SpanID, 16) {
+		return ""
+	}
+	var flags byte
+	if t.Sampled {
+		flags |= flagSampled
+	}
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, t.TraceID, t.SpanID, flags)
+}
+
+// ParseTraceparent 解析 traceparent 头部，返回的 SpanID 是调用方的跨度ID。
+// 高于 00 的版本按规范只读取前 55 个字符。
+func ParseTraceparent(s string) (*TraceInfo, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < traceparentLen {
+		return nil, ErrInvalidTraceparent
+	}
+	version := s[:2]
+	if !isHex(version) || version == "ff" {
+		return nil, ErrInvalidTraceparent
+	}
+	if version == traceparentVersion && len(s) != traceparentLen {
+		return nil, ErrInvalidTraceparent
+	}
+	if len(s) > traceparentLen && s[traceparentLen] != '-' {
+		return nil, ErrInvalidTraceparent
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return nil, ErrInvalidTraceparent
+	}
+	traceID, spanID, flags := s[3:35], s[36:52], s[53:55]
+	if !isValidID(traceID, 32) || !isValidID(spanID, 16) || !isHex(flags) {
+		return nil, ErrInvalidTraceparent
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	return &TraceInfo{TraceID: traceID, SpanID: spanID, Sampled: f&flagSampled != 0}, nil
+}
+
+// isValidID 判断 id 是否为指定长度、非全零的小写十六进制串
+func isValidID(id string, n int) bool {
+	return len(id) == n && isHex(id) && strings.Trim(id, "0") != ""
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract 从元数据中提取调用方的追踪信息。
+// 优先使用 traceparent/tracestate，没有或无效时兼容旧的 x-trace-id/x-span-id 头部。
+func Extract(md metadata.MD) (*TraceInfo, bool) {
+	if tp := getFirstValue(md, HeaderTraceparent); tp != "" {
+		if info, err := ParseTraceparent(tp); err == nil {
+			// tracestate 可能被拆成多个头部，按规范合并
+			info.TraceState = strings.Join(md.Get(HeaderTracestate), ",")
+			return info, true
+		}
+	}
+
+	traceID := getFirstValue(md, HeaderTraceID)
+	if traceID == "" {
+		return nil, false
+	}
+	return &TraceInfo{
+		TraceID:      traceID,
+		SpanID:       getFirstValue(md, HeaderSpanID),
+		ParentSpanID: getFirstValue(md, HeaderParentSpanID),
+		// 旧的调用方不发送采样标记，它们的每个请求都会被追踪
+		Sampled: getFirstValue(md, HeaderSampled) != "0",
+	}, true
+}
+
+// Inject 将追踪信息写入元数据，同时写入 W3C 头部和旧的 x-* 头部，
+// 尚未升级的下游服务仍能读取。已有的追踪头部会被覆盖。
+func Inject(md metadata.MD, t *TraceInfo) {
+	for _, key := range []string{HeaderTraceparent, HeaderTracestate, HeaderTraceID, HeaderSpanID, HeaderParentSpanID, HeaderSampled} {
+		md.Delete(key)
+	}
+	if tp := t.Traceparent(); tp != "" {
+		md.Set(HeaderTraceparent, tp)
+		if t.TraceState != "" {
+			md.Set(HeaderTracestate, t.TraceState)
+		}
+	}
+	md.Set(HeaderTraceID, t.TraceID)
+	md.Set(HeaderSpanID, t.SpanID)
+	if t.ParentSpanID != "" {
+		md.Set(HeaderParentSpanID, t.ParentSpanID)
+	}
+	if t.Sampled {
+		md.Set(HeaderSampled, "1")
+	} else {
+		md.Set(HeaderSampled, "0")
+	}
+}
+
+// getFirstValue 获取元数据中的第一个值
+func getFirstValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+type traceInfoKey struct{}
+
+// NewContext 返回携带当前跨度的 context，
+// 客户端拦截器以它为父跨度，没有时开始新的追踪
+func NewContext(ctx context.Context, t *TraceInfo) context.Context {
+	return context.WithValue(ctx, traceInfoKey{}, t)
+}
+
+// FromContext 返回 context 中的当前跨度
+func FromContext(ctx context.Context) (*TraceInfo, bool) {
+	t, ok := ctx.Value(traceInfoKey{}).(*TraceInfo)
+	return t, ok && t != nil
+}
@@ -0,0 +1,159 @@
+package trace
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want *TraceInfo // 为 nil 表示应返回 ErrInvalidTraceparent
+	}{
+		{"sampled", "00-" + testTraceID + "-" + testSpanID + "-01", &TraceInfo{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}},
+		{"not sampled", "00-" + testTraceID + "-" + testSpanID + "-00", &TraceInfo{TraceID: testTraceID, SpanID: testSpanID}},
+		{"other flags ignored", "00-" + testTraceID + "-" + testSpanID + "-03", &TraceInfo{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}},
+		{"surrounding spaces", "  00-" + testTraceID + "-" + testSpanID + "-01 ", &TraceInfo{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}},
+		// 更高的版本只读取前 55 个字符
+		{"future version with extra fields", "01-" + testTraceID + "-" + testSpanID + "-01-extra", &TraceInfo{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}},
+		{"future version", "cc-" + testTraceID + "-" + testSpanID + "-00", &TraceInfo{TraceID: testTraceID, SpanID: testSpanID}},
+
+		{"empty", "", nil},
+		{"too short", "00-" + testTraceID + "-" + testSpanID + "-1", nil},
+		{"version 00 with extra fields", "00-" + testTraceID + "-" + testSpanID + "-01-extra", nil},
+		{"future version without separator", "01-" + testTraceID + "-" + testSpanID + "-01extra", nil},
+		{"version ff", "ff-" + testTraceID + "-" + testSpanID + "-01", nil},
+		{"non-hex version", "0x-" + testTraceID + "-" + testSpanID + "-01", nil},
+		{"all-zero trace id", "00-00000000000000000000000000000000-" + testSpanID + "-01", nil},
+		{"all-zero span id", "00-" + testTraceID + "-0000000000000000-01", nil},
+		{"uppercase trace id", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01", nil},
+		{"non-hex span id", "00-" + testTraceID + "-00f067aa0ba902bz-01", nil},
+		{"non-hex flags", "00-" + testTraceID + "-" + testSpanID + "-0g", nil},
+		{"wrong separator", "00_" + testTraceID + "-" + testSpanID + "-01", nil},
+		{"short trace id", "00-" + testTraceID[2:] + "-" + testSpanID + "ab-01", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTraceparent(tt.in)
+			if tt.want == nil {
+				if !errors.Is(err, ErrInvalidTraceparent) {
+					t.Fatalf("ParseTraceparent(%q) = %+v, %v, want ErrInvalidTraceparent", tt.in, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTraceparent(%q): %v", tt.in, err)
+			}
+			if *got != *tt.want {
+				t.Fatalf("ParseTraceparent(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceparentFormat(t *testing.T) {
+	tests := []struct {
+		info TraceInfo
+		want string
+	}{
+		{TraceInfo{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}, "00-" + testTraceID + "-" + testSpanID + "-01"},
+		{TraceInfo{TraceID: testTraceID, SpanID: testSpanID}, "00-" + testTraceID + "-" + testSpanID + "-00"},
+		// 旧格式或全零的 ID 不能编码为 traceparent
+		{TraceInfo{TraceID: "trace-123", SpanID: testSpanID}, ""},
+		{TraceInfo{TraceID: "00000000000000000000000000000000", SpanID: testSpanID}, ""},
+		{TraceInfo{TraceID: testTraceID, SpanID: "0000000000000000"}, ""},
+		{TraceInfo{TraceID: testTraceID}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.info.Traceparent(); got != tt.want {
+			t.Errorf("Traceparent(%+v) = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+
+	// 生成的 ID 编码后能原样解析回来
+	info := NewTraceInfo()
+	got, err := ParseTraceparent(info.Traceparent())
+	if err != nil {
+		t.Fatalf("ParseTraceparent(%q): %v", info.Traceparent(), err)
+	}
+	if got.TraceID != info.TraceID || got.SpanID != info.SpanID || got.Sampled != info.Sampled {
+		t.Fatalf("round trip = %+v, want %+v", got, info)
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	md := metadata.Pairs(HeaderTraceID, "stale", HeaderTracestate, "stale=1")
+	info := &TraceInfo{TraceID: testTraceID, SpanID: testSpanID, ParentSpanID: "b7ad6b7169203331", TraceState: "vendor=a", Sampled: true}
+	Inject(md, info)
+
+	if got := md.Get(HeaderTraceparent); len(got) != 1 || got[0] != "00-"+testTraceID+"-"+testSpanID+"-01" {
+		t.Fatalf("traceparent = %v", got)
+	}
+	if got := md.Get(HeaderTraceID); len(got) != 1 || got[0] != testTraceID {
+		t.Fatalf("%s = %v, want the injected trace id only", HeaderTraceID, got)
+	}
+	if got := md.Get(HeaderSampled); len(got) != 1 || got[0] != "1" {
+		t.Fatalf("%s = %v, want 1", HeaderSampled, got)
+	}
+
+	got, ok := Extract(md)
+	if !ok {
+		t.Fatal("Extract found no trace info")
+	}
+	// traceparent 不携带 ParentSpanID，下游以 SpanID 作为父跨度
+	want := TraceInfo{TraceID: testTraceID, SpanID: testSpanID, TraceState: "vendor=a", Sampled: true}
+	if *got != want {
+		t.Fatalf("Extract = %+v, want %+v", got, want)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want *TraceInfo
+	}{
+		{
+			name: "tracestate split across headers",
+			md:   metadata.MD{HeaderTraceparent: {"00-" + testTraceID + "-" + testSpanID + "-00"}, HeaderTracestate: {"a=1", "b=2"}},
+			want: &TraceInfo{TraceID: testTraceID, SpanID: testSpanID, TraceState: "a=1,b=2"},
+		},
+		{
+			name: "invalid traceparent falls back to legacy headers",
+			md:   metadata.Pairs(HeaderTraceparent, "00-00000000000000000000000000000000-"+testSpanID+"-01", HeaderTraceID, "legacy", HeaderSpanID, "span", HeaderSampled, "0"),
+			want: &TraceInfo{TraceID: "legacy", SpanID: "span"},
+		},
+		{
+			// 旧的调用方不发送采样标记
+			name: "legacy headers without sampled flag",
+			md:   metadata.Pairs(HeaderTraceID, "legacy", HeaderSpanID, "span", HeaderParentSpanID, "parent"),
+			want: &TraceInfo{TraceID: "legacy", SpanID: "span", ParentSpanID: "parent", Sampled: true},
+		},
+		{
+			name: "no trace headers",
+			md:   metadata.Pairs("x-other", "1"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Extract(tt.md)
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("Extract = %+v, want none", got)
+				}
+				return
+			}
+			if !ok || *got != *tt.want {
+				t.Fatalf("Extract = %+v, %v, want %+v", got, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package trace
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SamplingParameters 做采样决定时可用的信息
+type SamplingParameters struct {
+	Parent  *TraceInfo // 父跨度，开始新的追踪时为 nil
+	TraceID string
+	Name    string // 跨度名，RPC 跨度为完整方法名
+	Kind    SpanKind
+}
+
+// Sampler 在跨度开始时决定是否记录（头部采样）。
+// 决定通过 traceparent 的 sampled 标记传给下游。
+type Sampler interface {
+	ShouldSample(p SamplingParameters) bool
+	Description() string
+}
+
+type alwaysSample struct{}
+
+// AlwaysSample 记录所有跨度
+func AlwaysSample() Sampler { return alwaysSample{} }
+
+func (alwaysSample) ShouldSample(SamplingParameters) bool { return true }
+func (alwaysSample) Description() string                  { return "AlwaysOn" }
+
+type neverSample struct{}
+
+// NeverSample 不记录任何跨度，追踪信息仍会向下游传递
+func NeverSample() Sampler { return neverSample{} }
+
+func (neverSample) ShouldSample(SamplingParameters) bool { return false }
+func (neverSample) Description() string                  { return "AlwaysOff" }
+
+// traceIDRatio 按 TraceID 的低 64 位采样，同一追踪在各个服务上的决定一致
+type traceIDRatio struct {
+	fraction  float64
+	threshold uint64
+}
+
+// TraceIDRatioBased 按比例采样，fraction >= 1 时全部采样，<= 0 时全不采样
+func TraceIDRatioBased(fraction float64) Sampler {
+	if fraction >= 1 {
+		return AlwaysSample()
+	}
+	if fraction <= 0 {
+		fraction = 0
+	}
+	return &traceIDRatio{fraction: fraction, threshold: uint64(fraction * (1 << 63))}
+}
+
+func (s *traceIDRatio) ShouldSample(p SamplingParameters) bool {
+	return traceIDBits(p.TraceID)>>1 < s.threshold
+}
+
+func (s *traceIDRatio) Description() string {
+	return fmt.Sprintf("TraceIDRatioBased{%g}", s.fraction)
+}
+
+// traceIDBits 取 W3C TraceID 的低 64 位，旧格式的 ID 取其哈希值
+func traceIDBits(traceID string) uint64 {
+	if len(traceID) == 32 {
+		if n, err := strconv.ParseUint(traceID[16:], 16, 64); err == nil {
+			return n
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(traceID))
+	return h.Sum64()
+}
+
+// parentBased 有父跨度时沿用父跨度的决定，否则交给 root
+type parentBased struct {
+	root Sampler
+}
+
+// ParentBased 有上游追踪信息时沿用上游的采样决定，开始新的追踪时由 root 决定
+func ParentBased(root Sampler) Sampler {
+	return &parentBased{root: root}
+}
+
+func (s *parentBased) ShouldSample(p SamplingParameters) bool {
+	if p.Parent != nil {
+		return p.Parent.Sampled
+	}
+	return s.root.ShouldSample(p)
+}
+
+func (s *parentBased) Description() string {
+	return fmt.Sprintf("ParentBased{root:%s}", s.root.Description())
+}
+
+// methodRateLimiter 每个方法一个令牌桶
+type methodRateLimiter struct {
+	perSecond float64
+	burst     float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MethodRateLimited 限制每个方法（跨度名）每秒最多采样 perSecond 个跨度，
+// 调用量大的方法不会挤占其他方法的追踪
+func MethodRateLimited(perSecond float64) Sampler {
+	burst := perSecond
+	if burst < 1 {
+		burst = 1
+	}
+	return &methodRateLimiter{
+		perSecond: perSecond,
+		burst:     burst,
+		buckets:   make(map[string]*tokenBucket),
+	}
+}
+
+func (s *methodRateLimiter) ShouldSample(p SamplingParameters) bool {
+	if s.perSecond <= 0 {
+		return false
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[p.Name]
+	if !ok {
+		b = &tokenBucket{tokens: s.burst, last: now}
+		s.buckets[p.Name] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * s.perSecond
+	if b.tokens > s.burst {
+		b.tokens = s.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (s *methodRateLimiter) Description() string {
+	return fmt.Sprintf("MethodRateLimited{%g/s}", s.perSecond)
+}
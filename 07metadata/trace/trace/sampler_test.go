@@ -0,0 +1,112 @@
+package trace
+
+import (
+	"fmt"
+	"testing"
+)
+
+// traceIDWithLow 返回低 64 位为 low 的 TraceID
+func traceIDWithLow(low uint64) string {
+	return fmt.Sprintf("4bf92f3577b34da6%016x", low)
+}
+
+func TestTraceIDRatioBased(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		low      uint64
+		want     bool
+	}{
+		{0.5, 0, true},
+		{0.5, 1<<63 - 1, true},
+		{0.5, 1 << 63, false},
+		{0.5, 1<<64 - 1, false},
+		{0.25, 1<<62 - 1, true},
+		{0.25, 1 << 62, false},
+		{0, 0, false},
+		{-1, 0, false},
+		{1, 1<<64 - 1, true},
+		{2, 1<<64 - 1, true},
+	}
+	for _, tt := range tests {
+		s := TraceIDRatioBased(tt.fraction)
+		if got := s.ShouldSample(SamplingParameters{TraceID: traceIDWithLow(tt.low)}); got != tt.want {
+			t.Errorf("%s.ShouldSample(low=%#x) = %v, want %v", s.Description(), tt.low, got, tt.want)
+		}
+	}
+}
+
+// 随机 TraceID 的采样比例接近 fraction，同一 TraceID 的决定总是相同
+func TestTraceIDRatioBasedFraction(t *testing.T) {
+	const n = 20000
+	s := TraceIDRatioBased(0.1)
+	sampled := 0
+	for range n {
+		id := generateTraceID()
+		got := s.ShouldSample(SamplingParameters{TraceID: id})
+		if got {
+			sampled++
+		}
+		if again := s.ShouldSample(SamplingParameters{TraceID: id}); again != got {
+			t.Fatalf("decision for %s changed from %v to %v", id, got, again)
+		}
+	}
+	if ratio := float64(sampled) / n; ratio < 0.08 || ratio > 0.12 {
+		t.Fatalf("sampled %.3f of trace ids, want about 0.1", ratio)
+	}
+
+	// 旧格式的 ID 使用哈希，决定同样稳定
+	legacy := SamplingParameters{TraceID: "trace-1700000000-42"}
+	if s.ShouldSample(legacy) != s.ShouldSample(legacy) {
+		t.Fatal("decision for a legacy trace id is not stable")
+	}
+}
+
+func TestParentBased(t *testing.T) {
+	tests := []struct {
+		name   string
+		root   Sampler
+		parent *TraceInfo
+		want   bool
+	}{
+		{"sampled parent overrides AlwaysOff", NeverSample(), &TraceInfo{Sampled: true}, true},
+		{"unsampled parent overrides AlwaysOn", AlwaysSample(), &TraceInfo{Sampled: false}, false},
+		{"root AlwaysOn", AlwaysSample(), nil, true},
+		{"root AlwaysOff", NeverSample(), nil, false},
+		{"root ratio", TraceIDRatioBased(0.5), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ParentBased(tt.root)
+			p := SamplingParameters{Parent: tt.parent, TraceID: traceIDWithLow(0)}
+			if got := s.ShouldSample(p); got != tt.want {
+				t.Fatalf("%s.ShouldSample = %v, want %v", s.Description(), got, tt.want)
+			}
+		})
+	}
+	if got, want := ParentBased(TraceIDRatioBased(0.25)).Description(), "ParentBased{root:TraceIDRatioBased{0.25}}"; got != want {
+		t.Fatalf("Description = %q, want %q", got, want)
+	}
+}
+
+func TestMethodRateLimited(t *testing.T) {
+	s := MethodRateLimited(3)
+	count := func(method string) int {
+		n := 0
+		for range 10 {
+			if s.ShouldSample(SamplingParameters{Name: method}) {
+				n++
+			}
+		}
+		return n
+	}
+	// 每个方法各有自己的令牌桶，突发上限为每秒的数量
+	if got := count("/user.UserService/GetUser"); got != 3 {
+		t.Fatalf("GetUser sampled %d of 10, want 3", got)
+	}
+	if got := count("/user.UserService/Login"); got != 3 {
+		t.Fatalf("Login sampled %d of 10, want 3", got)
+	}
+	if MethodRateLimited(0).ShouldSample(SamplingParameters{Name: "m"}) {
+		t.Fatal("MethodRateLimited(0) sampled a span")
+	}
+}
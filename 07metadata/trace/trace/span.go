@@ -0,0 +1,247 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind 跨度类型，取值与 OpenTelemetry 一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+// MarshalText 在 JSON 中输出为 "server"/"client"/"internal"
+func (k SpanKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// StatusCode 跨度状态，取值与 OpenTelemetry 一致
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case StatusOK:
+		return "OK"
+	case StatusError:
+		return "ERROR"
+	default:
+		return "UNSET"
+	}
+}
+
+// MarshalText 在 JSON 中输出为 "UNSET"/"OK"/"ERROR"
+func (c StatusCode) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Status 跨度的最终状态
+type Status struct {
+	Code    StatusCode `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+// Event 跨度中发生的事件
+type Event struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// SpanData 已结束跨度的快照，交给导出器
+type SpanData struct {
+	TraceInfo
+	Service    string         `json:"service"`
+	Name       string         `json:"name"`
+	Kind       SpanKind       `json:"kind"`
+	StartTime  time.Time      `json:"start_time"`
+	EndTime    time.Time      `json:"end_time"`
+	Duration   time.Duration  `json:"duration_ns"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Events     []Event        `json:"events,omitempty"`
+	Status     Status         `json:"status"`
+}
+
+// Span 一个跨度，由 Tracer.Start 创建，调用 End 后交给处理器。
+// 方法可以并发调用，End 之后的修改会被忽略。
+// 未被采样的跨度只传递追踪信息，其余方法都不做任何事。
+type Span struct {
+	tracer    *Tracer
+	info      *TraceInfo
+	recording bool
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// TraceInfo 返回跨度的追踪信息
+func (s *Span) TraceInfo() *TraceInfo {
+	return s.info
+}
+
+// IsRecording 报告跨度是否被采样，未采样时可以跳过准备属性等工作
+func (s *Span) IsRecording() bool {
+	return s.recording
+}
+
+// SetAttribute 设置属性，值应为字符串、数字或布尔值
+func (s *Span) SetAttribute(key string, value any) {
+	if !s.recording {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any)
+	}
+	s.data.Attributes[key] = value
+}
+
+// AddEvent 记录一个事件
+func (s *Span) AddEvent(name string, attrs map[string]any) {
+	if !s.recording {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+}
+
+// SetStatus 设置跨度状态
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if !s.recording {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Status = Status{Code: code, Message: message}
+}
+
+// RecordError 记录一个 exception 事件并把状态置为 ERROR，err 为 nil 时什么也不做
+func (s *Span) RecordError(err error) {
+	if err == nil || !s.recording {
+		return
+	}
+	s.AddEvent("exception", map[string]any{"exception.message": err.Error()})
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End 结束跨度，只有第一次调用有效
+func (s *Span) End() {
+	if !s.recording {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	s.data.Duration = s.data.EndTime.Sub(s.data.StartTime)
+	data := s.data
+	s.mu.Unlock()
+
+	for _, p := range s.tracer.processors {
+		p.OnEnd(data)
+	}
+}
+
+// Tracer 创建跨度并把结束的跨度交给处理器
+type Tracer struct {
+	service    string
+	sampler    Sampler
+	processors []SpanProcessor
+}
+
+// NewTracer 创建 Tracer。sampler 为 nil 时使用 ParentBased(AlwaysSample())；
+// 没有处理器时跨度只在进程内传递追踪信息。
+func NewTracer(service string, sampler Sampler, processors ...SpanProcessor) *Tracer {
+	if sampler == nil {
+		sampler = ParentBased(AlwaysSample())
+	}
+	return &Tracer{service: service, sampler: sampler, processors: processors}
+}
+
+// Start 开始一个跨度，以 ctx 中的当前跨度为父跨度，没有时开始新的追踪。
+// 返回的 context 携带新跨度。是否记录由 Tracer 的采样器决定，
+// 决定保存在 TraceInfo.Sampled 中随元数据传给下游。
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent, _ := FromContext(ctx)
+	var info *TraceInfo
+	if parent != nil {
+		info = parent.NewChildSpan()
+	} else {
+		info = NewTraceInfo()
+	}
+	info.Sampled = t.sampler.ShouldSample(SamplingParameters{
+		Parent:  parent,
+		TraceID: info.TraceID,
+		Name:    name,
+		Kind:    kind,
+	})
+
+	s := &Span{tracer: t, info: info, recording: info.Sampled}
+	if s.recording {
+		s.data = SpanData{
+			TraceInfo: *info,
+			Service:   t.service,
+			Name:      name,
+			Kind:      kind,
+			StartTime: time.Now(),
+		}
+	}
+	ctx = context.WithValue(NewContext(ctx, info), spanKey{}, s)
+	return ctx, s
+}
+
+// Shutdown 导出尚未导出的跨度并关闭所有处理器
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	var first error
+	for _, p := range t.processors {
+		if err := p.Shutdown(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type spanKey struct{}
+
+// SpanFromContext 返回 ctx 中正在记录的跨度，
+// 处理函数可以用它添加属性和事件
+func SpanFromContext(ctx context.Context) (*Span, bool) {
+	s, ok := ctx.Value(spanKey{}).(*Span)
+	return s, ok
+}
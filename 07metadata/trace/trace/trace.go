@@ -10,6 +10,7 @@ const (
 	HeaderTraceID      = "x-trace-id"       // 追踪ID
 	HeaderSpanID       = "x-span-id"        // 跨度ID
 	HeaderParentSpanID = "x-parent-span-id" // 父跨度ID
+	HeaderSampled      = "x-trace-sampled"  // 采样标记，"1" 或 "0"，没有时视为已采样
 )
 
 // TraceInfo 追踪信息结构
@@ -17,6 +18,9 @@ type TraceInfo struct {
 	TraceID      string `json:"trace_id"`
 	SpanID       string `json:"span_id"`
 	ParentSpanID string `json:"parent_span_id,omitempty"`
+	TraceState   string `json:"trace_state,omitempty"` // W3C tracestate，原样向下游传递
+	// Sampled 上游的采样决定，下游服务沿用它（见 ParentBased）
+	Sampled bool `json:"-"`
 }
 
 // generateTraceID 生成追踪ID
@@ -40,6 +44,7 @@ func NewTraceInfo() *TraceInfo {
 	return &TraceInfo{
 		TraceID: generateTraceID(),
 		SpanID:  generateSpanID(),
+		Sampled: true,
 	}
 }
 
@@ -49,5 +54,7 @@ func (t *TraceInfo) NewChildSpan() *TraceInfo {
 		TraceID:      t.TraceID,
 		SpanID:       generateSpanID(),
 		ParentSpanID: t.SpanID,
+		TraceState:   t.TraceState,
+		Sampled:      t.Sampled,
 	}
 }
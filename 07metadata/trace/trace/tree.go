@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SpanNode 调用树中的一个跨度
+type SpanNode struct {
+	Span     SpanData
+	Children []*SpanNode
+}
+
+// BuildTree 按 TraceID 和父子关系把跨度还原成调用树，返回各棵树的根，
+// 按开始时间排序。父跨度没有被导出（如来自未接入的服务）的跨度也作为根。
+func BuildTree(spans []SpanData) []*SpanNode {
+	nodes := make(map[string]*SpanNode, len(spans))
+	for _, s := range spans {
+		nodes[s.TraceID+"/"+s.SpanID] = &SpanNode{Span: s}
+	}
+
+	var roots []*SpanNode
+	for _, n := range nodes {
+		parent, ok := nodes[n.Span.TraceID+"/"+n.Span.ParentSpanID]
+		if n.Span.ParentSpanID == "" || !ok {
+			roots = append(roots, n)
+			continue
+		}
+		parent.Children = append(parent.Children, n)
+	}
+	for _, n := range nodes {
+		sortNodes(n.Children)
+	}
+	sortNodes(roots)
+	return roots
+}
+
+func sortNodes(nodes []*SpanNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Span.StartTime.Before(nodes[j].Span.StartTime)
+	})
+}
+
+// PrintTree 以缩进形式输出调用树
+func PrintTree(w io.Writer, roots []*SpanNode) {
+	for _, root := range roots {
+		fmt.Fprintf(w, "TraceID: %s\n", root.Span.TraceID)
+		printNode(w, root, 1)
+	}
+}
+
+func printNode(w io.Writer, n *SpanNode, depth int) {
+	s := n.Span
+	fmt.Fprintf(w, "%s[%s] %s %s (%s, %v, span %s)\n",
+		strings.Repeat("  ", depth), s.Service, s.Kind, s.Name, s.Status.Code, s.Duration, s.SpanID)
+	for _, c := range n.Children {
+		printNode(w, c, depth+1)
+	}
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"flag"
 	"fmt"
 	"log"
 	"net"
-	"strings"
+	"os"
 	"time"
 
 	"google.golang.org/grpc"
@@ -13,12 +17,102 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/clin211/grpc/health/health"
+	"github.com/clin211/grpc/health/lifecycle"
+	healthpb "github.com/clin211/grpc/health/rpc"
+	"github.com/clin211/grpc/metadata/auth"
+	"github.com/clin211/grpc/metadata/policy"
 	rpc "github.com/clin211/grpc/metadata/proto"
+	profilepb "github.com/clin211/grpc/metadata/trace/proto"
+	"github.com/clin211/grpc/metadata/trace/trace"
+	"github.com/clin211/grpc/mtls"
 )
 
+// account 示例用户账号
+type account struct {
+	password  string
+	principal *auth.Principal
+}
+
+// accounts 示例用户表
+var accounts = map[string]account{
+	"admin": {
+		password: "123456",
+		principal: &auth.Principal{
+			UserID:   "user_001",
+			Username: "admin",
+			Roles:    []string{"admin"},
+		},
+	},
+	"guest": {
+		password: "guest",
+		principal: &auth.Principal{
+			UserID:   "user_002",
+			Username: "guest",
+			Roles:    []string{"viewer", "editor"},
+		},
+	},
+	"ops": {
+		password: "ops",
+		principal: &auth.Principal{
+			UserID:   "user_003",
+			Username: "ops",
+			Roles:    []string{"admin", "auditor"},
+		},
+	},
+}
+
+// newPolicyEngine 创建授权策略引擎，动作为完整的 gRPC 方法名
+func newPolicyEngine() *policy.Engine {
+	engine := policy.NewEngine()
+
+	// admin 可以调用用户服务的所有方法
+	engine.SetUserPermissions(&rpc.UserPermissions{
+		UserId: "user_001",
+		RolePermissions: map[string]*rpc.RolePermission{
+			"admin": {AllowedActions: []string{"/user.UserService/*"}},
+		},
+	})
+
+	// guest 只能查询用户；editor 角色已过期，不能再创建用户
+	engine.SetUserPermissions(&rpc.UserPermissions{
+		UserId: "user_002",
+		RolePermissions: map[string]*rpc.RolePermission{
+			"viewer": {AllowedActions: []string{
+				rpc.UserService_GetUser_FullMethodName,
+				rpc.UserService_Logout_FullMethodName,
+			}},
+			"editor": {
+				AllowedActions: []string{rpc.UserService_CreateUser_FullMethodName},
+				ExpiresAt:      time.Now().Add(-time.Hour).Unix(),
+			},
+		},
+	})
+
+	// ops 拥有 admin 角色，但 auditor 角色明确拒绝创建用户，拒绝优先
+	engine.SetUserPermissions(&rpc.UserPermissions{
+		UserId: "user_003",
+		RolePermissions: map[string]*rpc.RolePermission{
+			"admin":   {AllowedActions: []string{"/user.UserService/*"}},
+			"auditor": {DeniedActions: []string{rpc.UserService_CreateUser_FullMethodName}},
+		},
+	})
+	return engine
+}
+
+// rules 方法访问规则：只有 Login 和健康检查是公开的，其余方法都需要认证
+var rules = auth.Rules{
+	rpc.UserService_Login_FullMethodName:        {Public: true},
+	rpc.UserService_RefreshToken_FullMethodName: {Public: true},
+	"/grpc.health.v1.Health/*":                  {Public: true},
+}
+
 // UserServer 实现用户服务
 type UserServer struct {
 	rpc.UnimplementedUserServiceServer
+	tokens *auth.JWTManager
+	// profiles 资料服务客户端，为 nil 时不查询用户资料
+	profiles profilepb.ProfileServiceClient
 }
 
 // getMetadataValue 获取元数据的第一个值
@@ -50,23 +144,22 @@ func (s *UserServer) GetUser(ctx context.Context, req *rpc.GetUserRequest) (*rpc
 	} else {
 		printRequestMetadata(md)
 
-		// 验证认证信息
-		authToken := getMetadataValue(md, "authorization")
-		if authToken == "" {
-			return nil, status.Error(codes.Unauthenticated, "缺少认证信息")
-		}
-
-		if !strings.HasPrefix(authToken, "Bearer ") {
-			return nil, status.Error(codes.Unauthenticated, "无效的认证格式")
-		}
+		// 认证已由拦截器完成，这里只读取调用方身份
+		principal, _ := auth.FromContext(ctx)
 
 		// 获取其他元数据
 		userAgent := getMetadataValue(md, "user-agent")
 		clientVersion := getMetadataValue(md, "client-version")
-		traceID := getMetadataValue(md, "x-trace-id")
+		// 追踪拦截器已兼容 traceparent 和 x-trace-id 头部
+		traceInfo, _ := trace.FromContext(ctx)
 
-		log.Printf("处理GetUser请求 - UserID: %s, TraceID: %s, ClientVersion: %s, UserAgent: %s",
-			req.GetUserId(), traceID, clientVersion, userAgent)
+		// 开启双向 TLS 时记录客户端证书中的身份
+		if id, ok := mtls.PeerIdentity(ctx); ok {
+			log.Printf("对端证书身份: %v, DNS: %v, CN: %s", id, id.DNSNames, id.CommonName)
+		}
+
+		log.Printf("处理GetUser请求 - UserID: %s, Caller: %s, TraceID: %s, ClientVersion: %s, UserAgent: %s",
+			req.GetUserId(), principal.Username, traceInfo.TraceID, clientVersion, userAgent)
 	}
 
 	// 发送头部元数据
@@ -83,6 +176,20 @@ func (s *UserServer) GetUser(ctx context.Context, req *rpc.GetUserRequest) (*rpc
 	// 模拟业务逻辑处理
 	time.Sleep(100 * time.Millisecond)
 
+	// 调用下游资料服务，ctx 中的跨度经追踪拦截器传递过去，两边的跨度属于同一棵调用树
+	if s.profiles != nil {
+		profileCtx, cancel := context.WithTimeout(ctx, time.Second)
+		profile, err := s.profiles.GetProfile(profileCtx, &profilepb.GetProfileRequest{UserId: req.GetUserId()})
+		cancel()
+		if err != nil {
+			// 资料只用于丰富日志，查询失败不影响 GetUser
+			log.Printf("查询用户资料失败: %v", err)
+		} else {
+			log.Printf("用户资料 - Nickname: %s, Location: %s",
+				profile.GetProfile().GetNickname(), profile.GetProfile().GetLocation())
+		}
+	}
+
 	// 构造响应
 	response := &rpc.GetUserResponse{
 		UserId:    req.GetUserId(),
@@ -117,26 +224,15 @@ func (s *UserServer) CreateUser(ctx context.Context, req *rpc.CreateUserRequest)
 
 	printRequestMetadata(md)
 
-	// 验证权限
-	permissions := md.Get("x-permission")
-	hasCreatePermission := false
-	for _, perm := range permissions {
-		if perm == "create" || perm == "admin" {
-			hasCreatePermission = true
-			break
-		}
-	}
-
-	if !hasCreatePermission {
-		return nil, status.Error(codes.PermissionDenied, "权限不足，无法创建用户")
-	}
+	// 权限已由授权拦截器按策略检查
+	principal, _ := auth.FromContext(ctx)
 
 	// 获取请求来源信息
 	clientIP := getMetadataValue(md, "x-client-ip")
 	requestID := getMetadataValue(md, "x-request-id")
 
-	log.Printf("处理CreateUser请求 - Username: %s, ClientIP: %s, RequestID: %s",
-		req.GetUsername(), clientIP, requestID)
+	log.Printf("处理CreateUser请求 - Username: %s, Caller: %s, ClientIP: %s, RequestID: %s",
+		req.GetUsername(), principal.Username, clientIP, requestID)
 
 	// 发送头部元数据
 	header := metadata.Pairs(
@@ -194,23 +290,29 @@ func (s *UserServer) Login(ctx context.Context, req *rpc.LoginRequest) (*rpc.Log
 	time.Sleep(150 * time.Millisecond)
 
 	// 简单的用户名密码验证
-	if req.GetUsername() == "admin" && req.GetPassword() == "123456" {
-		// 登录成功
-		token := fmt.Sprintf("token_%d", time.Now().Unix())
-		userID := "user_001"
+	if acc, ok := accounts[req.GetUsername()]; ok && acc.password == req.GetPassword() {
+		// 登录成功，签发访问令牌和刷新令牌
+		pair, err := s.tokens.Issue(acc.principal)
+		if err != nil {
+			log.Printf("签发令牌失败: %v", err)
+			return nil, status.Error(codes.Internal, "签发令牌失败")
+		}
 
 		// 设置成功的尾部元数据
 		trailer := metadata.Pairs(
 			"processing-time", time.Since(startTime).String(),
 			"login-result", "success",
 			"session-created", "true",
+			"token-expires-at", pair.ExpiresAt.Format(time.RFC3339),
 		)
 		grpc.SetTrailer(ctx, trailer)
 
 		return &rpc.LoginResponse{
-			Token:   token,
-			UserId:  userID,
-			Message: "登录成功",
+			Token:        pair.AccessToken,
+			UserId:       acc.principal.UserID,
+			Message:      "登录成功",
+			RefreshToken: pair.RefreshToken,
+			ExpiresAt:    pair.ExpiresAt.Unix(),
 		}, nil
 	} else {
 		// 登录失败
@@ -225,24 +327,169 @@ func (s *UserServer) Login(ctx context.Context, req *rpc.LoginRequest) (*rpc.Log
 	}
 }
 
+// RefreshToken 使用刷新令牌换取新令牌
+func (s *UserServer) RefreshToken(ctx context.Context, req *rpc.RefreshTokenRequest) (*rpc.LoginResponse, error) {
+	pair, principal, err := s.tokens.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		log.Printf("刷新令牌失败: %v", err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	log.Printf("刷新令牌成功 - UserID: %s", principal.UserID)
+
+	return &rpc.LoginResponse{
+		Token:        pair.AccessToken,
+		UserId:       principal.UserID,
+		Message:      "刷新成功",
+		RefreshToken: pair.RefreshToken,
+		ExpiresAt:    pair.ExpiresAt.Unix(),
+	}, nil
+}
+
+// Logout 退出登录，吊销当前访问令牌所属会话的所有令牌
+func (s *UserServer) Logout(ctx context.Context, req *rpc.LogoutRequest) (*rpc.LogoutResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, err := auth.BearerToken(md)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := s.tokens.Revoke(ctx, token); err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	principal, _ := auth.FromContext(ctx)
+	log.Printf("退出登录 - UserID: %s", principal.UserID)
+	return &rpc.LogoutResponse{Message: "已退出登录"}, nil
+}
+
+// newTokenManager 创建 JWT 管理器。
+// 同时注册 HS256、RS256 和 EdDSA 三种密钥，signingKey 决定签发时使用哪一个，
+// 用其他密钥签发的令牌在有效期内仍然可以通过校验，便于演示密钥轮换。
+func newTokenManager(signingKey string) (*auth.JWTManager, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = "grpc-metadata-demo-secret"
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewJWTManager(auth.JWTConfig{
+		Issuer: "user-service",
+		Keys: []auth.Key{
+			auth.NewHMACKey("hs-1", []byte(secret)),
+			auth.NewRSAKey("rs-1", rsaKey),
+			auth.NewEd25519Key("ed-1", edKey),
+		},
+		SigningKeyID: signingKey,
+		AccessTTL:    15 * time.Minute,
+		RefreshTTL:   24 * time.Hour,
+	})
+}
+
 func main() {
+	signingKey := flag.String("signing-key", "hs-1", "JWT signing key id: hs-1 (HS256), rs-1 (RS256) or ed-1 (EdDSA)")
+	profileAddr := flag.String("profile-addr", "localhost:50051", "address of the ProfileService called by GetUser, empty to disable")
+	flag.Parse()
+
 	// 监听端口
 	lis, err := net.Listen("tcp", ":8080")
 	if err != nil {
 		log.Fatalf("监听端口失败: %v", err)
 	}
 
-	// 创建gRPC服务器
-	server := grpc.NewServer()
+	// JWT 管理器，同时作为拦截器的 Authenticator
+	tokens, err := newTokenManager(*signingKey)
+	if err != nil {
+		log.Fatalf("创建JWT管理器失败: %v", err)
+	}
+
+	// 设置 GRPC_TLS_* 环境变量时使用（双向）TLS，否则使用明文；tlsCtx 结束后不再重新加载证书
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	creds, err := mtls.ServerOption(tlsCtx, mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("加载TLS证书失败: %v", err)
+	}
+
+	// 按 OTEL_TRACES_EXPORTER 等环境变量导出跨度
+	tracer, err := trace.NewTracerFromEnv("UserService")
+	if err != nil {
+		log.Fatalf("创建Tracer失败: %v", err)
+	}
+
+	userServer := &UserServer{tokens: tokens}
+	if *profileAddr != "" {
+		dialCreds, err := mtls.DialOption(tlsCtx, mtls.ConfigFromEnv())
+		if err != nil {
+			log.Fatalf("加载TLS证书失败: %v", err)
+		}
+		conn, err := grpc.NewClient(*profileAddr, dialCreds,
+			grpc.WithChainUnaryInterceptor(trace.UnaryClientInterceptor(tracer)),
+			grpc.WithChainStreamInterceptor(trace.StreamClientInterceptor(tracer)),
+		)
+		if err != nil {
+			log.Fatalf("连接资料服务失败: %v", err)
+		}
+		defer conn.Close()
+		userServer.profiles = profilepb.NewProfileServiceClient(conn)
+	}
+
+	// 创建gRPC服务器，追踪拦截器在最外层，认证和授权失败的调用也会记录跨度；
+	// 然后由认证拦截器确定调用方身份，再由策略引擎授权
+	engine := newPolicyEngine()
+	server := grpc.NewServer(
+		creds,
+		grpc.ChainUnaryInterceptor(
+			trace.UnaryServerInterceptor(tracer),
+			auth.UnaryServerInterceptor(tokens, rules),
+			policy.UnaryServerInterceptor(engine),
+		),
+		grpc.ChainStreamInterceptor(
+			trace.StreamServerInterceptor(tracer),
+			auth.StreamServerInterceptor(tokens, rules),
+			policy.StreamServerInterceptor(engine),
+		),
+	)
 
 	// 注册用户服务
-	rpc.RegisterUserServiceServer(server, &UserServer{})
+	rpc.RegisterUserServiceServer(server, userServer)
+
+	// 注册健康检查服务，整体状态（空服务名）表示用户服务是否可用
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	// 收到 SIGINT/SIGTERM 时置为 NOT_SERVING、等待排空后 GracefulStop，超时后 Stop；
+	// 服务器停止后再导出剩余的跨度，保证最后一批请求的跨度也被导出
+	lc := lifecycle.New(lifecycle.Config{
+		Servers: []*grpc.Server{server},
+		Health:  []*health.Server{hs},
+		// 关闭时停止监视证书文件
+		OnStop: []func(context.Context) error{func(context.Context) error { stopTLS(); return nil }},
+	})
 
 	log.Println("gRPC服务器启动成功，监听端口 :8080")
 	log.Println("等待客户端连接...")
 
 	// 启动服务器
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("服务器启动失败: %v", err)
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("服务器启动失败: %v", err)
+		}
+	}()
+
+	// 等待关闭流程结束
+	lc.Wait()
+
+	// 导出剩余的跨度
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		log.Printf("导出跨度失败: %v", err)
 	}
+	log.Println("服务器已关闭")
 }
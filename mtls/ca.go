@@ -0,0 +1,118 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// CA 用于示例和测试的临时证书颁发机构，只保存在内存中，通过 CertPEM 把证书交给对端
+type CA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// Leaf 由 CA 签发的证书
+type Leaf struct {
+	CommonName string
+	DNSNames   []string
+	IPs        []net.IP
+	// SPIFFEID 不为空时作为 URI SAN 写入，例如 spiffe://example.org/user
+	SPIFFEID string
+	// Client 为 true 时只签发客户端证书，服务端证书也可以作为客户端证书使用
+	Client bool
+	// TTL 有效期，默认 24 小时
+	TTL time.Duration
+}
+
+// NewCA 创建有效期一年的自签名 CA
+func NewCA(commonName string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
+
+// CertPEM 返回 PEM 格式的 CA 证书
+func (ca *CA) CertPEM() []byte {
+	return ca.pem
+}
+
+// Issue 签发新证书，返回 PEM 格式的证书和私钥
+func (ca *CA) Issue(leaf Leaf) (certPEM, keyPEM []byte, err error) {
+	if leaf.TTL <= 0 {
+		leaf.TTL = 24 * time.Hour
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: leaf.CommonName},
+		DNSNames:     leaf.DNSNames,
+		IPAddresses:  leaf.IPs,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(leaf.TTL),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		// 服务端经常调用其它服务端，所以与 SPIFFE X.509-SVID 一样，证书两个方向都能使用
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if leaf.Client {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if leaf.SPIFFEID != "" {
+		u, err := url.Parse(leaf.SPIFFEID)
+		if err != nil || u.Scheme != "spiffe" {
+			return nil, nil, fmt.Errorf("mtls: invalid SPIFFE ID %q", leaf.SPIFFEID)
+		}
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func serialNumber() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return n
+}
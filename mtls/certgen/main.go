@@ -0,0 +1,84 @@
+// certgen 生成示例用的 CA、服务端证书和客户端证书，用于开启双向 TLS。
+// 重新运行会覆盖原有文件，正在运行的服务端和客户端会自动加载新证书。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/clin211/grpc/mtls"
+)
+
+var (
+	out         = flag.String("out", "certs", "directory to write the PEM files to")
+	trustDomain = flag.String("trust-domain", "example.org", "SPIFFE trust domain of the issued certificates")
+	ttl         = flag.Duration("ttl", 24*time.Hour, "validity of the server and client certificates")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("failed to create %s: %v", *out, err)
+	}
+
+	ca, err := mtls.NewCA("grpc-example-ca")
+	if err != nil {
+		log.Fatalf("failed to create CA: %v", err)
+	}
+	write("ca.pem", ca.CertPEM(), 0o644)
+
+	// 服务端证书同时对 localhost 和 127.0.0.1 有效
+	issue(ca, "server", mtls.Leaf{
+		CommonName: "server",
+		DNSNames:   []string{"localhost"},
+		IPs:        []net.IP{net.ParseIP("127.0.0.1"), net.IPv6loopback},
+		SPIFFEID:   fmt.Sprintf("spiffe://%s/server", *trustDomain),
+		TTL:        *ttl,
+	})
+	issue(ca, "client", mtls.Leaf{
+		CommonName: "client",
+		SPIFFEID:   fmt.Sprintf("spiffe://%s/client", *trustDomain),
+		Client:     true,
+		TTL:        *ttl,
+	})
+
+	abs, _ := filepath.Abs(*out)
+	fmt.Printf("# server\n")
+	fmt.Printf("export %s=%s %s=%s %s=%s\n",
+		mtls.EnvCertFile, filepath.Join(abs, "server.pem"),
+		mtls.EnvKeyFile, filepath.Join(abs, "server-key.pem"),
+		mtls.EnvCAFile, filepath.Join(abs, "ca.pem"))
+	fmt.Printf("# client, %s is needed when the dial target is not localhost/127.0.0.1\n", mtls.EnvServerName)
+	fmt.Printf("export %s=%s %s=%s %s=%s %s=localhost\n",
+		mtls.EnvCertFile, filepath.Join(abs, "client.pem"),
+		mtls.EnvKeyFile, filepath.Join(abs, "client-key.pem"),
+		mtls.EnvCAFile, filepath.Join(abs, "ca.pem"),
+		mtls.EnvServerName)
+}
+
+func issue(ca *mtls.CA, name string, leaf mtls.Leaf) {
+	certPEM, keyPEM, err := ca.Issue(leaf)
+	if err != nil {
+		log.Fatalf("failed to issue %s certificate: %v", name, err)
+	}
+	write(name+"-key.pem", keyPEM, 0o600)
+	write(name+".pem", certPEM, 0o644)
+}
+
+func write(name string, data []byte, perm os.FileMode) {
+	path := filepath.Join(*out, name)
+	// 先写临时文件再改名，正在监视文件的进程不会读到写了一半的内容
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		log.Fatalf("failed to write %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Fatalf("failed to rename %s: %v", tmp, err)
+	}
+}
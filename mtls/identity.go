@@ -0,0 +1,57 @@
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Identity 从验证过的对端证书中得到的身份
+type Identity struct {
+	// SPIFFEID 第一个 spiffe:// 开头的 URI SAN，没有时为空
+	SPIFFEID   string
+	URIs       []string
+	DNSNames   []string
+	CommonName string
+}
+
+// PeerIdentity 返回 ctx 中对端证书的身份。只有使用双向 TLS 的服务端和客户端能取到，明文连接返回 false。
+func PeerIdentity(ctx context.Context) (*Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil, false
+	}
+	return identityOf(info.State.PeerCertificates[0]), true
+}
+
+func identityOf(cert *x509.Certificate) *Identity {
+	id := &Identity{
+		DNSNames:   cert.DNSNames,
+		CommonName: cert.Subject.CommonName,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+		if u.Scheme == "spiffe" && id.SPIFFEID == "" {
+			id.SPIFFEID = u.String()
+		}
+	}
+	return id
+}
+
+// String 返回身份中最具体的名称
+func (id *Identity) String() string {
+	switch {
+	case id.SPIFFEID != "":
+		return id.SPIFFEID
+	case len(id.DNSNames) > 0:
+		return id.DNSNames[0]
+	default:
+		return id.CommonName
+	}
+}
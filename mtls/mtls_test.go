@@ -0,0 +1,290 @@
+package mtls
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const testReloadInterval = 10 * time.Millisecond
+
+func newCA(t *testing.T, name string) *CA {
+	t.Helper()
+	ca, err := NewCA(name)
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	return ca
+}
+
+// writeFile 先写临时文件再改名，重新加载时不会读到写了一半的文件
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeLeaf 用 ca 签发 leaf，写入 dir 下的 name.crt 和 name.key，trusted 中的 CA 证书写入 name-ca.crt
+func writeLeaf(t *testing.T, dir, name string, ca *CA, leaf Leaf, trusted ...*CA) Config {
+	t.Helper()
+	cfg := Config{ReloadInterval: testReloadInterval, ServerName: "localhost"}
+	if ca != nil {
+		certPEM, keyPEM, err := ca.Issue(leaf)
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		cfg.CertFile = filepath.Join(dir, name+".crt")
+		cfg.KeyFile = filepath.Join(dir, name+".key")
+		// 先写私钥，重新加载时证书和私钥才能对上
+		writeFile(t, cfg.KeyFile, keyPEM)
+		writeFile(t, cfg.CertFile, certPEM)
+	}
+	if len(trusted) > 0 {
+		var pem []byte
+		for _, ca := range trusted {
+			pem = append(pem, ca.CertPEM()...)
+		}
+		cfg.CAFile = filepath.Join(dir, name+"-ca.crt")
+		writeFile(t, cfg.CAFile, pem)
+	}
+	return cfg
+}
+
+var serverLeaf = Leaf{CommonName: "server", DNSNames: []string{"localhost"}, SPIFFEID: "spiffe://example.org/server"}
+
+// startServer 启动使用 cfg 的服务端，返回地址和收到的请求的对端身份
+func startServer(t *testing.T, cfg Config) (string, <-chan *Identity) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	creds, err := ServerOption(ctx, cfg)
+	if err != nil {
+		t.Fatalf("ServerOption: %v", err)
+	}
+	identities := make(chan *Identity, 10)
+	s := grpc.NewServer(creds, grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if id, ok := PeerIdentity(ctx); ok {
+			identities <- id
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String(), identities
+}
+
+// check 用 cfg 新建连接并调用一次 Check，返回服务端证书的身份
+func check(t *testing.T, addr string, cfg Config) (*Identity, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	creds, err := DialOption(ctx, cfg)
+	if err != nil {
+		t.Fatalf("DialOption: %v", err)
+	}
+	conn, err := grpc.NewClient(addr, creds)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	var p peer.Peer
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p)); err != nil {
+		return nil, err
+	}
+	id, ok := PeerIdentity(peer.NewContext(ctx, &p))
+	if !ok {
+		t.Fatal("no server identity on a TLS connection")
+	}
+	return id, nil
+}
+
+func TestHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	addr, _ := startServer(t, writeLeaf(t, dir, "server", ca, serverLeaf, ca))
+
+	id, err := check(t, addr, writeLeaf(t, dir, "client", ca, Leaf{CommonName: "client", Client: true}, ca))
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if id.SPIFFEID != serverLeaf.SPIFFEID {
+		t.Fatalf("server identity = %v, want %s", id, serverLeaf.SPIFFEID)
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	untrusted := newCA(t, "untrusted")
+	addr, _ := startServer(t, writeLeaf(t, dir, "server", ca, serverLeaf, ca))
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no client certificate", writeLeaf(t, dir, "anonymous", nil, Leaf{}, ca)},
+		{"client certificate from an untrusted CA", writeLeaf(t, dir, "rogue", untrusted, Leaf{CommonName: "rogue", Client: true}, ca)},
+		{"server certificate from an untrusted CA", writeLeaf(t, dir, "distrust", ca, Leaf{CommonName: "client", Client: true}, untrusted)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := check(t, addr, tt.cfg); status.Code(err) != codes.Unavailable {
+				t.Fatalf("Check: err = %v, want Unavailable", err)
+			}
+		})
+	}
+}
+
+// 证书和 CA 文件被替换后，新的握手使用新文件
+func TestReloaderPicksUpRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldCA, rotatedCA := newCA(t, "old"), newCA(t, "new")
+	serverCfg := writeLeaf(t, dir, "server", oldCA, serverLeaf, oldCA)
+	addr, _ := startServer(t, serverCfg)
+
+	clientCfg := writeLeaf(t, dir, "client", rotatedCA, Leaf{CommonName: "client", Client: true}, oldCA, rotatedCA)
+	if _, err := check(t, addr, clientCfg); err == nil {
+		t.Fatal("server accepted a client certificate from a CA it does not trust yet")
+	}
+
+	// 服务端换成新 CA 签发的证书，同时信任新 CA
+	rotated := serverLeaf
+	rotated.CommonName = "server-rotated"
+	writeLeaf(t, dir, "server", rotatedCA, rotated, rotatedCA)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		id, err := check(t, addr, clientCfg)
+		if err == nil {
+			if id.CommonName != rotated.CommonName {
+				t.Fatalf("server certificate CN = %s, want %s", id.CommonName, rotated.CommonName)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rotation not picked up: %v", err)
+		}
+		time.Sleep(testReloadInterval)
+	}
+}
+
+// ctx 结束后不再监视文件
+func TestReloaderStopsWithContext(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	cfg := writeLeaf(t, dir, "server", ca, serverLeaf, ca)
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := NewReloader(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	before := r.cert.Load()
+	cancel()
+	time.Sleep(2 * testReloadInterval)
+
+	writeLeaf(t, dir, "server", ca, serverLeaf, ca)
+	time.Sleep(5 * testReloadInterval)
+	if r.cert.Load() != before {
+		t.Fatal("certificate reloaded after ctx was canceled")
+	}
+	// 手动调用 Reload 仍然可用
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if r.cert.Load() == before {
+		t.Fatal("Reload did not load the new certificate")
+	}
+}
+
+func TestPeerIdentity(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	addr, identities := startServer(t, writeLeaf(t, dir, "server", ca, serverLeaf, ca))
+
+	tests := []struct {
+		leaf Leaf
+		want Identity
+		str  string
+	}{
+		{
+			leaf: Leaf{CommonName: "user", DNSNames: []string{"user.internal"}, SPIFFEID: "spiffe://example.org/user", Client: true},
+			want: Identity{SPIFFEID: "spiffe://example.org/user", CommonName: "user"},
+			str:  "spiffe://example.org/user",
+		},
+		{
+			leaf: Leaf{CommonName: "order", DNSNames: []string{"order.internal"}, Client: true},
+			want: Identity{CommonName: "order"},
+			str:  "order.internal",
+		},
+		{
+			leaf: Leaf{CommonName: "batch", Client: true},
+			want: Identity{CommonName: "batch"},
+			str:  "batch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.str, func(t *testing.T) {
+			if _, err := check(t, addr, writeLeaf(t, dir, tt.leaf.CommonName, ca, tt.leaf, ca)); err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			id := <-identities
+			if id.SPIFFEID != tt.want.SPIFFEID || id.CommonName != tt.want.CommonName || id.String() != tt.str {
+				t.Fatalf("PeerIdentity = %+v (%s), want %+v (%s)", id, id, tt.want, tt.str)
+			}
+		})
+	}
+
+	if _, ok := PeerIdentity(context.Background()); ok {
+		t.Fatal("PeerIdentity without a peer returned ok")
+	}
+	if _, ok := PeerIdentity(peer.NewContext(context.Background(), &peer.Peer{})); ok {
+		t.Fatal("PeerIdentity on a plaintext connection returned ok")
+	}
+}
+
+func TestServerOptionRequiresKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	full := writeLeaf(t, dir, "server", ca, serverLeaf, ca)
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"only CAFile", Config{CAFile: full.CAFile}},
+		{"CertFile without KeyFile", Config{CertFile: full.CertFile, CAFile: full.CAFile}},
+		{"KeyFile without CertFile", Config{KeyFile: full.KeyFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ServerOption(context.Background(), tt.cfg); err == nil {
+				t.Fatal("ServerOption succeeded without a key pair")
+			}
+			if _, err := ServerCredentials(context.Background(), tt.cfg); err == nil {
+				t.Fatal("ServerCredentials succeeded without a key pair")
+			}
+		})
+	}
+	// 没有配置任何文件时退回明文
+	if _, err := ServerOption(context.Background(), Config{}); err != nil {
+		t.Fatalf("ServerOption without files: %v", err)
+	}
+}
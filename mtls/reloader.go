@@ -0,0 +1,213 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader 保存按 Config 加载的当前证书和 CA，文件变化时重新加载。
+// 重新加载失败时输出日志，继续使用之前的证书。
+type Reloader struct {
+	cfg Config
+
+	cert atomic.Pointer[tls.Certificate]
+	pool atomic.Pointer[x509.CertPool]
+
+	mu    sync.Mutex
+	stamp map[string]fileStamp // 每个文件上次加载时的状态
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader 加载 cfg 指定的文件，cfg.ReloadInterval 不为负数时开始监视文件变化，
+// 直到 ctx 结束或调用 Close
+func NewReloader(ctx context.Context, cfg Config) (*Reloader, error) {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("mtls: CertFile and KeyFile must be set together")
+	}
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = DefaultReloadInterval
+	}
+	r := &Reloader{
+		cfg:   cfg,
+		stamp: make(map[string]fileStamp),
+		stop:  make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if cfg.ReloadInterval > 0 {
+		go r.watch(ctx)
+	}
+	return r, nil
+}
+
+// Reload 重新读取文件，出错时保留之前的证书
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp := make(map[string]fileStamp)
+	for _, name := range r.files() {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("mtls: %w", err)
+		}
+		stamp[name] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("mtls: load key pair: %w", err)
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("mtls: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("mtls: no certificate found in %s", r.cfg.CAFile)
+		}
+	}
+
+	r.cert.Store(cert)
+	r.pool.Store(pool)
+	r.stamp = stamp
+	return nil
+}
+
+// Close 停止监视文件
+func (r *Reloader) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+func (r *Reloader) files() []string {
+	var files []string
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile} {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// changed 报告是否有文件与上次成功加载时不同
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range r.files() {
+		fi, err := os.Stat(name)
+		if err != nil {
+			// 文件可能正在被替换，下次再检查
+			continue
+		}
+		if s := r.stamp[name]; !fi.ModTime().Equal(s.modTime) || fi.Size() != s.size {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-r.stop:
+			return
+		}
+		if !r.changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			log.Printf("mtls: reload failed, keeping previous certificates: %v", err)
+			continue
+		}
+		log.Printf("mtls: reloaded certificates from %v", r.files())
+	}
+}
+
+// ServerConfig 返回服务端的 tls.Config。每次握手使用最近加载的证书和客户端 CA，
+// 配置了 CA 时客户端必须出示由它签发的证书。
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert := r.cert.Load()
+			if cert == nil {
+				return nil, errors.New("mtls: no server certificate configured")
+			}
+			c := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				// 返回的配置会替换传给 credentials.NewTLS 的配置，需要自己声明 h2
+				NextProtos: []string{"h2"},
+			}
+			if pool := r.pool.Load(); pool != nil {
+				c.ClientCAs = pool
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return c, nil
+		},
+	}
+}
+
+// ClientConfig 返回客户端的 tls.Config。服务端证书使用最近加载的 CA 验证，没有配置 CA 时使用系统根证书；
+// 配置了客户端证书时使用最新加载的证书。
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.cfg.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.cert.Load(); cert != nil {
+				return cert, nil
+			}
+			// 没有证书时由服务端决定是否接受
+			return &tls.Certificate{}, nil
+		},
+		// 标准验证只使用连接开始时设置的 RootCAs，之后无法安全地替换，
+		// 改由 VerifyConnection 使用当前的 CA 重新验证
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyServer,
+	}
+}
+
+// verifyServer 完成 InsecureSkipVerify 跳过的验证：证书链能追溯到受信任的根证书，且证书对服务端名称有效
+func (r *Reloader) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("mtls: server presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         r.pool.Load(),
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}